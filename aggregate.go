@@ -0,0 +1,307 @@
+package cosy
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/uozi-tech/cosy/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Aggregate metrics
+const (
+	AggregateCount = "count"
+	AggregateSum   = "sum"
+	AggregateAvg   = "avg"
+	AggregateMin   = "min"
+	AggregateMax   = "max"
+)
+
+// Date buckets of the aggregate action
+const (
+	BucketDay   = "day"
+	BucketWeek  = "week"
+	BucketMonth = "month"
+)
+
+// defaultBucketColumn is the column of the date bucket if bucket_by is not specified,
+// it's the creation time of model.Model and can be bucketed without the aggregate directive
+const defaultBucketColumn = "created_at"
+
+// aggregateColumn is a column referenced by the aggregate query
+type aggregateColumn struct {
+	key    string
+	column string
+}
+
+// aggregateMetric is a metric of the aggregate query, the column is empty for count(*)
+type aggregateMetric struct {
+	fn     string
+	key    string
+	column string
+}
+
+// alias returns the key of the metric in the response, e.g. "count" or "sum_amount"
+func (m aggregateMetric) alias() string {
+	if m.key == "" {
+		return m.fn
+	}
+	return m.fn + "_" + m.key
+}
+
+// aggregateQuery is the parsed query of the aggregate action
+type aggregateQuery struct {
+	groups  []aggregateColumn
+	metrics []aggregateMetric
+	bucket  string
+	// bucketBy is the column of the date bucket, it's valid only if bucket is set
+	bucketBy aggregateColumn
+}
+
+// aggregateColumnOf returns the column of the json key if the field is marked with cosy:"aggregate"
+func aggregateColumnOf[T any](key string) (aggregateColumn, bool) {
+	resolved := model.GetResolvedModel[T]()
+	if resolved == nil {
+		return aggregateColumn{}, false
+	}
+	for _, field := range resolved.OrderedFields {
+		if field.JsonTag != key && field.CosyTag.GetJson() != key {
+			continue
+		}
+		if !field.CosyTag.GetAggregate() || field.DBName == "" {
+			return aggregateColumn{}, false
+		}
+		return aggregateColumn{key: key, column: field.DBName}, true
+	}
+	return aggregateColumn{}, false
+}
+
+// splitAggregateQuery splits the comma separated query, the empty items are ignored
+func splitAggregateQuery(value string) (items []string) {
+	for item := range strings.SplitSeq(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return
+}
+
+// parseAggregateQuery parses the group_by, metrics, bucket and bucket_by queries,
+// the errors are keyed by the queries
+func parseAggregateQuery[T any](c *gin.Context) (q aggregateQuery, errs gin.H) {
+	errs = make(gin.H)
+
+	for _, key := range splitAggregateQuery(c.Query("group_by")) {
+		column, ok := aggregateColumnOf[T](key)
+		if !ok {
+			errs["group_by"] = "aggregate"
+			break
+		}
+		q.groups = append(q.groups, column)
+	}
+
+	metrics := splitAggregateQuery(c.DefaultQuery("metrics", AggregateCount))
+	if len(metrics) == 0 {
+		errs["metrics"] = "required"
+	}
+	for _, metric := range metrics {
+		fn, key, _ := strings.Cut(metric, ":")
+		switch fn {
+		case AggregateCount:
+			if key == "" {
+				q.metrics = append(q.metrics, aggregateMetric{fn: fn})
+				continue
+			}
+		case AggregateSum, AggregateAvg, AggregateMin, AggregateMax:
+			if key == "" {
+				errs["metrics"] = "required"
+				continue
+			}
+		default:
+			errs["metrics"] = "oneof=count sum avg min max"
+			continue
+		}
+		column, ok := aggregateColumnOf[T](key)
+		if !ok {
+			errs["metrics"] = "aggregate"
+			continue
+		}
+		q.metrics = append(q.metrics, aggregateMetric{fn: fn, key: key, column: column.column})
+	}
+
+	q.bucket = c.Query("bucket")
+	switch q.bucket {
+	case "":
+	case BucketDay, BucketWeek, BucketMonth:
+		key := c.DefaultQuery("bucket_by", defaultBucketColumn)
+		column, ok := aggregateColumnOf[T](key)
+		if !ok && key == defaultBucketColumn {
+			column, ok = aggregateColumn{key: key, column: key}, true
+		}
+		if !ok {
+			errs["bucket_by"] = "aggregate"
+		}
+		q.bucketBy = column
+	default:
+		errs["bucket"] = "oneof=day week month"
+	}
+
+	return
+}
+
+// keys returns the json keys referenced by the query
+func (q aggregateQuery) keys() (keys []string) {
+	for _, group := range q.groups {
+		keys = append(keys, group.key)
+	}
+	for _, metric := range q.metrics {
+		if metric.key != "" {
+			keys = append(keys, metric.key)
+		}
+	}
+	if q.bucket != "" {
+		keys = append(keys, q.bucketBy.key)
+	}
+	return
+}
+
+// dateTruncExpr returns the expression truncating the quoted column to the first day of the bucket,
+// the weeks start on Monday
+func dateTruncExpr(dialect string, bucket string, column string) string {
+	switch dialect {
+	case "postgres":
+		return "date_trunc('" + bucket + "', " + column + ")::date"
+	case "mysql":
+		switch bucket {
+		case BucketWeek:
+			return "DATE(DATE_SUB(" + column + ", INTERVAL WEEKDAY(" + column + ") DAY))"
+		case BucketMonth:
+			return "DATE(DATE_FORMAT(" + column + ", '%Y-%m-01'))"
+		default:
+			return "DATE(" + column + ")"
+		}
+	default:
+		switch bucket {
+		case BucketWeek:
+			return "date(" + column + ", 'weekday 0', '-6 days')"
+		case BucketMonth:
+			return "date(" + column + ", 'start of month')"
+		default:
+			return "date(" + column + ")"
+		}
+	}
+}
+
+// aggregateScope selects the groups, the bucket and the metrics of the query
+func (c *Ctx[T]) aggregateScope(q aggregateQuery) func(tx *gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		table := c.table
+		if table == "" {
+			if s := c.schema(); s != nil {
+				table = s.Table
+			}
+		}
+		quote := func(column string) string {
+			return tx.Statement.Quote(clause.Column{Table: table, Name: column})
+		}
+
+		var groups, selects []string
+		if q.bucket != "" {
+			expr := dateTruncExpr(tx.Name(), q.bucket, quote(q.bucketBy.column))
+			groups = append(groups, expr)
+			selects = append(selects, expr+" AS "+tx.Statement.Quote("bucket"))
+		}
+		for _, group := range q.groups {
+			groups = append(groups, quote(group.column))
+			selects = append(selects, quote(group.column)+" AS "+tx.Statement.Quote(group.key))
+		}
+		for _, metric := range q.metrics {
+			column := "*"
+			if metric.column != "" {
+				column = quote(metric.column)
+			}
+			selects = append(selects, strings.ToUpper(metric.fn)+"("+column+") AS "+tx.Statement.Quote(metric.alias()))
+		}
+
+		tx = tx.Select(strings.Join(selects, ", "))
+		for _, group := range groups {
+			tx = tx.Group(group).Order(group)
+		}
+		return tx
+	}
+}
+
+// prepareAggregateHook applies the list filters and the hooks of "get list" without the preloads and the fieldset
+func (c *Ctx[T]) prepareAggregateHook(ctx *Ctx[T]) {
+	getListHook[T]()(ctx)
+	ctx.resolveJoinsWithScopes()
+	prepareHook(ctx)
+	if ctx.abort {
+		return
+	}
+	ctx.refuseUnreadableQueries()
+	if ctx.abort {
+		return
+	}
+	ctx.resolveFilterExpression()
+}
+
+// Aggregate responds the metrics of the records grouped by the group_by query and the date bucket,
+// e.g. ?group_by=status&metrics=count,sum:amount&bucket=day&bucket_by=paid_at.
+// The filters and the scopes of the list are applied, and only the fields marked with cosy:"aggregate"
+// can be grouped or aggregated.
+func (c *Ctx[T]) Aggregate() {
+	var q aggregateQuery
+	NewProcessChain(c).
+		SetPrepare(func(ctx *Ctx[T]) {
+			var errs gin.H
+			q, errs = parseAggregateQuery[T](c.Context)
+			if len(errs) > 0 {
+				c.JSON(http.StatusNotAcceptable, NewValidateError(errs))
+				c.Abort()
+				return
+			}
+
+			unreadable := c.unreadableKeys()
+			for _, key := range q.keys() {
+				if unreadable[key] {
+					c.JSON(http.StatusForbidden, ErrForbidden)
+					c.Abort()
+					return
+				}
+			}
+
+			c.prepareAggregateHook(ctx)
+		}).
+		SetBeforeExecute(beforeExecuteHook[T]).
+		SetGormAction(func(ctx *Ctx[T]) {
+			// the rows are ordered by the groups
+			c.WithoutSortOrder()
+			result := c.result()
+			if c.abort {
+				return
+			}
+
+			rows := make([]map[string]any, 0)
+			err := result.Scopes(c.aggregateScope(q)).Scan(&rows).Error
+			if err != nil {
+				ctx.AbortWithError(err)
+				return
+			}
+
+			defaultData := model.DataList{
+				Data: rows,
+			}
+			c.DefaultResponseData = defaultData
+			c.ResultData = defaultData
+		}).
+		SetExecuted(executedHook[T]).
+		SetResponse(func(ctx *Ctx[T]) {
+			c.dispatchQueryResponse(func(ctx *Ctx[T]) {
+				c.JSON(http.StatusOK, c.ResultData)
+			})
+		}).
+		GetOrGetList()
+}
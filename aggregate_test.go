@@ -0,0 +1,72 @@
+package cosy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/uozi-tech/cosy/model"
+)
+
+type aggregateModel struct {
+	model.Model
+	Status string    `json:"status" cosy:"aggregate"`
+	Amount float64   `json:"amount" cosy:"aggregate"`
+	Note   string    `json:"note"`
+	PaidAt time.Time `json:"paid_at" cosy:"aggregate"`
+}
+
+func TestParseAggregateQuery(t *testing.T) {
+	model.RegisterModels(aggregateModel{})
+	model.ResolvedModels()
+
+	parse := func(query string) (aggregateQuery, gin.H) {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/aggregate?"+query, nil)
+		return parseAggregateQuery[aggregateModel](c)
+	}
+
+	q, errs := parse("")
+	assert.Empty(t, errs)
+	assert.Equal(t, []aggregateMetric{{fn: AggregateCount}}, q.metrics)
+
+	q, errs = parse("group_by=status&metrics=count,sum:amount,max:paid_at&bucket=week&bucket_by=paid_at")
+	assert.Empty(t, errs)
+	assert.Equal(t, []aggregateColumn{{key: "status", column: "status"}}, q.groups)
+	assert.Equal(t, []string{"count", "sum_amount", "max_paid_at"}, []string{q.metrics[0].alias(), q.metrics[1].alias(), q.metrics[2].alias()})
+	assert.Equal(t, BucketWeek, q.bucket)
+	assert.Equal(t, "paid_at", q.bucketBy.column)
+	assert.Equal(t, []string{"status", "amount", "paid_at", "paid_at"}, q.keys())
+
+	// created_at is bucketed by default
+	q, errs = parse("bucket=day")
+	assert.Empty(t, errs)
+	assert.Equal(t, "created_at", q.bucketBy.column)
+
+	_, errs = parse("group_by=note")
+	assert.Equal(t, gin.H{"group_by": "aggregate"}, errs)
+
+	_, errs = parse("metrics=sum")
+	assert.Equal(t, gin.H{"metrics": "required"}, errs)
+
+	_, errs = parse("metrics=median:amount")
+	assert.Equal(t, gin.H{"metrics": "oneof=count sum avg min max"}, errs)
+
+	_, errs = parse("bucket=year")
+	assert.Equal(t, gin.H{"bucket": "oneof=day week month"}, errs)
+
+	_, errs = parse("bucket=day&bucket_by=note")
+	assert.Equal(t, gin.H{"bucket_by": "aggregate"}, errs)
+}
+
+func TestDateTruncExpr(t *testing.T) {
+	assert.Equal(t, `date_trunc('month', "paid_at")::date`, dateTruncExpr("postgres", BucketMonth, `"paid_at"`))
+	assert.Equal(t, "DATE(`paid_at`)", dateTruncExpr("mysql", BucketDay, "`paid_at`"))
+	assert.Equal(t, "DATE(DATE_SUB(`paid_at`, INTERVAL WEEKDAY(`paid_at`) DAY))", dateTruncExpr("mysql", BucketWeek, "`paid_at`"))
+	assert.Equal(t, "DATE(DATE_FORMAT(`paid_at`, '%Y-%m-01'))", dateTruncExpr("mysql", BucketMonth, "`paid_at`"))
+	assert.Equal(t, "date(`paid_at`, 'weekday 0', '-6 days')", dateTruncExpr("sqlite", BucketWeek, "`paid_at`"))
+	assert.Equal(t, "date(`paid_at`, 'start of month')", dateTruncExpr("sqlite", BucketMonth, "`paid_at`"))
+}
@@ -1,6 +1,8 @@
 package cosy
 
 import (
+	"time"
+
 	"github.com/gin-gonic/gin"
 )
 
@@ -11,18 +13,30 @@ type ICurd[T any] interface {
 	Modify() []gin.HandlerFunc
 	Destroy() []gin.HandlerFunc
 	Recover() []gin.HandlerFunc
+	BatchCreate() []gin.HandlerFunc
+	History() []gin.HandlerFunc
+	Stream() []gin.HandlerFunc
+	Move() []gin.HandlerFunc
 	BeforeCreate(...gin.HandlerFunc) ICurd[T]
 	BeforeModify(...gin.HandlerFunc) ICurd[T]
 	BeforeGet(...gin.HandlerFunc) ICurd[T]
 	BeforeGetList(...gin.HandlerFunc) ICurd[T]
 	BeforeDestroy(...gin.HandlerFunc) ICurd[T]
 	BeforeRecover(...gin.HandlerFunc) ICurd[T]
+	BeforeBatchCreate(...gin.HandlerFunc) ICurd[T]
 	GetHook(...func(*Ctx[T]))
 	GetListHook(...func(*Ctx[T]))
 	CreateHook(...func(*Ctx[T]))
 	ModifyHook(...func(*Ctx[T]))
 	DestroyHook(...func(*Ctx[T]))
 	RecoverHook(...func(*Ctx[T]))
+	BatchCreateHook(...func(*Ctx[T]))
+	WithBatchCreate() ICurd[T]
+	WithHistory() ICurd[T]
+	WithOutbox() ICurd[T]
+	WithChangeFeed() ICurd[T]
+	WithCache(time.Duration) ICurd[T]
+	WithIdempotency(time.Duration) ICurd[T]
 	WithoutCreate() ICurd[T]
 	WithoutModify() ICurd[T]
 	WithoutGet() ICurd[T]
@@ -35,25 +49,33 @@ type ICurd[T any] interface {
 
 type Curd[T any] struct {
 	ICurd[T]
-	baseUrl        string
-	getHook        []func(*Ctx[T])
-	getListHook    []func(*Ctx[T])
-	createHook     []func(*Ctx[T])
-	modifyHook     []func(*Ctx[T])
-	destroyHook    []func(*Ctx[T])
-	recoverHook    []func(*Ctx[T])
-	beforeCreate   []gin.HandlerFunc
-	beforeModify   []gin.HandlerFunc
-	beforeGet      []gin.HandlerFunc
-	beforeGetList  []gin.HandlerFunc
-	beforeDestroy  []gin.HandlerFunc
-	beforeRecover  []gin.HandlerFunc
-	getEnabled     bool
-	getListEnabled bool
-	createEnabled  bool
-	modifyEnabled  bool
-	destroyEnabled bool
-	recoverEnabled bool
+	baseUrl            string
+	getHook            []func(*Ctx[T])
+	getListHook        []func(*Ctx[T])
+	createHook         []func(*Ctx[T])
+	modifyHook         []func(*Ctx[T])
+	destroyHook        []func(*Ctx[T])
+	recoverHook        []func(*Ctx[T])
+	batchCreateHook    []func(*Ctx[T])
+	beforeCreate       []gin.HandlerFunc
+	beforeModify       []gin.HandlerFunc
+	beforeGet          []gin.HandlerFunc
+	beforeGetList      []gin.HandlerFunc
+	beforeDestroy      []gin.HandlerFunc
+	beforeRecover      []gin.HandlerFunc
+	beforeBatchCreate  []gin.HandlerFunc
+	getEnabled         bool
+	getListEnabled     bool
+	createEnabled      bool
+	modifyEnabled      bool
+	destroyEnabled     bool
+	recoverEnabled     bool
+	batchCreateEnabled bool
+	historyEnabled     bool
+	outboxEnabled      bool
+	changeFeedEnabled  bool
+	cacheTTL           time.Duration
+	idempotencyTTL     time.Duration
 }
 
 // Api returns a new instance of Curd
@@ -105,6 +127,12 @@ func (c *Curd[T]) BeforeRecover(hooks ...gin.HandlerFunc) ICurd[T] {
 	return c
 }
 
+// BeforeBatchCreate registers a hook function to be called before the batch creating action
+func (c *Curd[T]) BeforeBatchCreate(hooks ...gin.HandlerFunc) ICurd[T] {
+	c.beforeBatchCreate = append(c.beforeBatchCreate, hooks...)
+	return c
+}
+
 // GetHook registers a hook function to the queen, and it will be called before the get action
 func (c *Curd[T]) GetHook(hook ...func(*Ctx[T])) {
 	c.getHook = append(c.getHook, hook...)
@@ -135,6 +163,11 @@ func (c *Curd[T]) RecoverHook(hook ...func(*Ctx[T])) {
 	c.recoverHook = append(c.recoverHook, hook...)
 }
 
+// BatchCreateHook registers a hook function to the queen, and it will be called before the batch create action
+func (c *Curd[T]) BatchCreateHook(hook ...func(*Ctx[T])) {
+	c.batchCreateHook = append(c.batchCreateHook, hook...)
+}
+
 // InitRouter registers the CRUD routes to the gin router
 func (c *Curd[T]) InitRouter(r *gin.RouterGroup, middleware ...gin.HandlerFunc) {
 	g := r.Group(c.baseUrl, middleware...)
@@ -148,16 +181,29 @@ func (c *Curd[T]) InitRouter(r *gin.RouterGroup, middleware ...gin.HandlerFunc)
 		if c.createEnabled {
 			g.POST("", c.Create()...)
 		}
+		if c.batchCreateEnabled {
+			g.POST("/batch", c.BatchCreate()...)
+		}
 		if c.modifyEnabled {
 			g.POST("/:id", c.Modify()...)
 		}
+		if c.modifyEnabled && isTree[T]() {
+			g.POST("/:id/move", c.Move()...)
+		}
 		if c.destroyEnabled {
 			g.DELETE("/:id", c.Destroy()...)
 		}
 		if c.recoverEnabled {
 			g.PATCH("/:id", c.Recover()...)
 		}
+		if c.historyEnabled {
+			g.GET("/:id/history", c.History()...)
+		}
+		if c.changeFeedEnabled {
+			g.GET("/stream", c.Stream()...)
+		}
 	}
+	registerApi(c.describe(g.BasePath()))
 }
 
 // Get returns a gin.HandlerFunc that handles get item requests
@@ -167,6 +213,9 @@ func (c *Curd[T]) Get() (h []gin.HandlerFunc) {
 	}
 	h = append(h, func(ginCtx *gin.Context) {
 		core := Core[T](ginCtx)
+		if c.cacheTTL > 0 {
+			core.WithCache(c.cacheTTL)
+		}
 		core.PrepareHook(c.getHook...)
 		core.Get()
 	})
@@ -180,6 +229,9 @@ func (c *Curd[T]) GetList() (h []gin.HandlerFunc) {
 	}
 	h = append(h, func(ginCtx *gin.Context) {
 		core := Core[T](ginCtx)
+		if c.cacheTTL > 0 {
+			core.WithCache(c.cacheTTL)
+		}
 		core.PrepareHook(c.getListHook...)
 		core.PagingList()
 	})
@@ -189,30 +241,63 @@ func (c *Curd[T]) GetList() (h []gin.HandlerFunc) {
 // Create returns a gin.HandlerFunc that handles create item requests
 func (c *Curd[T]) Create() (h []gin.HandlerFunc) {
 	h = append(h, c.beforeCreate...)
+	if c.idempotencyTTL > 0 {
+		h = append(h, Idempotency(c.idempotencyTTL))
+	}
 	h = append(h, func(ginCtx *gin.Context) {
 		core := Core[T](ginCtx)
+		c.recordChanges(core)
 		core.PrepareHook(c.createHook...)
 		core.Create()
 	})
 	return
 }
 
+// BatchCreate returns a gin.HandlerFunc that handles batch create items requests
+func (c *Curd[T]) BatchCreate() (h []gin.HandlerFunc) {
+	h = append(h, c.beforeBatchCreate...)
+	if c.idempotencyTTL > 0 {
+		h = append(h, Idempotency(c.idempotencyTTL))
+	}
+	h = append(h, func(ginCtx *gin.Context) {
+		core := Core[T](ginCtx)
+		c.recordChanges(core)
+		core.PrepareHook(c.batchCreateHook...)
+		core.BatchCreate()
+	})
+	return
+}
+
 // Modify returns a gin.HandlerFunc that handles modify item requests
 func (c *Curd[T]) Modify() (h []gin.HandlerFunc) {
 	h = append(h, c.beforeModify...)
 	h = append(h, func(ginCtx *gin.Context) {
 		core := Core[T](ginCtx)
+		c.recordChanges(core)
 		core.PrepareHook(c.modifyHook...)
 		core.Modify()
 	})
 	return
 }
 
+// Move returns a gin.HandlerFunc that handles move tree node requests,
+// the middlewares registered by BeforeModify are applied
+func (c *Curd[T]) Move() (h []gin.HandlerFunc) {
+	h = append(h, c.beforeModify...)
+	h = append(h, func(ginCtx *gin.Context) {
+		core := Core[T](ginCtx)
+		c.recordChanges(core)
+		core.Move()
+	})
+	return
+}
+
 // Destroy returns a gin.HandlerFunc that handles delete item requests
 func (c *Curd[T]) Destroy() (h []gin.HandlerFunc) {
 	h = append(h, c.beforeDestroy...)
 	h = append(h, func(ginCtx *gin.Context) {
 		core := Core[T](ginCtx)
+		c.recordChanges(core)
 		core.PrepareHook(c.destroyHook...)
 		core.Destroy()
 	})
@@ -224,12 +309,93 @@ func (c *Curd[T]) Recover() (h []gin.HandlerFunc) {
 	h = append(h, c.beforeRecover...)
 	h = append(h, func(ginCtx *gin.Context) {
 		core := Core[T](ginCtx)
+		c.recordChanges(core)
 		core.PrepareHook(c.recoverHook...)
 		core.Recover()
 	})
 	return
 }
 
+// History returns a gin.HandlerFunc that handles get item history requests,
+// the middlewares registered by BeforeGet are applied
+func (c *Curd[T]) History() (h []gin.HandlerFunc) {
+	h = append(h, c.beforeGet...)
+	h = append(h, func(ginCtx *gin.Context) {
+		Core[T](ginCtx).History()
+	})
+	return
+}
+
+// recordChanges enables the history, the outbox and the change feed of the ctx if they're enabled,
+// the history and the events are written in the transaction of the changes, so that they're committed
+// or rolled back together
+func (c *Curd[T]) recordChanges(core *Ctx[T]) {
+	if c.historyEnabled {
+		core.WithHistory()
+	}
+	if c.outboxEnabled {
+		core.WithOutbox()
+	}
+	if c.changeFeedEnabled {
+		core.WithChangeFeed()
+	}
+	if c.historyEnabled || c.outboxEnabled {
+		core.WithTransaction()
+	}
+}
+
+// WithHistory enable recording the changes of create, batch create, modify, destroy and recover,
+// and the item history route
+func (c *Curd[T]) WithHistory() ICurd[T] {
+	c.historyEnabled = true
+	return c
+}
+
+// Stream returns a gin.HandlerFunc that handles the change feed requests,
+// the middlewares registered by BeforeGetList and the hooks registered by GetListHook are applied
+func (c *Curd[T]) Stream() (h []gin.HandlerFunc) {
+	h = append(h, c.beforeGetList...)
+	h = append(h, func(ginCtx *gin.Context) {
+		core := Core[T](ginCtx)
+		core.PrepareHook(c.getListHook...)
+		core.Stream()
+	})
+	return
+}
+
+// WithChangeFeed enable publishing the changes of create, batch create, modify, destroy and recover,
+// and the stream route
+func (c *Curd[T]) WithChangeFeed() ICurd[T] {
+	c.changeFeedEnabled = true
+	return c
+}
+
+// WithOutbox enable writing the events of create, batch create, modify, destroy and recover into the outbox,
+// in the transaction of the changes
+func (c *Curd[T]) WithOutbox() ICurd[T] {
+	c.outboxEnabled = true
+	return c
+}
+
+// WithCache enable caching the responses of get item and get items list in redis for the ttl
+func (c *Curd[T]) WithCache(ttl time.Duration) ICurd[T] {
+	c.cacheTTL = ttl
+	return c
+}
+
+// WithIdempotency enable replaying the responses of create item and batch create items
+// for the requests with the Idempotency-Key header, the responses are stored in redis for the ttl
+func (c *Curd[T]) WithIdempotency(ttl time.Duration) ICurd[T] {
+	c.idempotencyTTL = ttl
+	return c
+}
+
+// WithBatchCreate enable batch create items route
+func (c *Curd[T]) WithBatchCreate() ICurd[T] {
+	c.batchCreateEnabled = true
+	return c
+}
+
 // WithoutGet disable get item route
 func (c *Curd[T]) WithoutGet() ICurd[T] {
 	c.getEnabled = false
@@ -266,9 +432,10 @@ func (c *Curd[T]) WithoutRecover() ICurd[T] {
 	return c
 }
 
-// WithReadonly disable create, modify, destroy, recover item route
+// WithReadonly disable create, batch create, modify, destroy, recover item route
 func (c *Curd[T]) WithReadonly() ICurd[T] {
 	c.createEnabled = false
+	c.batchCreateEnabled = false
 	c.modifyEnabled = false
 	c.destroyEnabled = false
 	c.recoverEnabled = false
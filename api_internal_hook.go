@@ -26,10 +26,11 @@ func getHook[T any]() func(core *Ctx[T]) {
 		var preloads []string
 
 		for _, field := range resolved.OrderedFields {
-			dir := field.CosyTag.GetItem()
-			switch dir {
-			case Preload:
-				preloads = append(preloads, field.Name)
+			for _, dir := range field.CosyTag.GetItems() {
+				switch dir {
+				case Preload:
+					preloads = append(preloads, field.Name)
+				}
 			}
 		}
 		if len(preloads) > 0 {
@@ -44,6 +45,8 @@ func getListHook[T any]() func(core *Ctx[T]) {
 	return func(core *Ctx[T]) {
 		populateColumnMapping(core, resolved)
 
+		var fullText []string
+
 		for _, field := range resolved.OrderedFields {
 			dirs := field.CosyTag.GetList()
 
@@ -67,6 +70,14 @@ func getListHook[T any]() func(core *Ctx[T]) {
 					core.SetSearchFussyKeys(field.JsonTag)
 				case Between:
 					core.SetBetween(field.JsonTag)
+				case Filterable:
+					core.SetFilterable(field.JsonTag)
+				case Relation:
+					core.setRelationFilters(field.JsonTag)
+				case FullText:
+					fullText = append(fullText, field.JsonTag)
+				case JSON:
+					core.SetJSON(field.JsonTag)
 				default:
 					core.SetCustomFilter(field.JsonTag, dir)
 				}
@@ -76,6 +87,9 @@ func getListHook[T any]() func(core *Ctx[T]) {
 				core.SetUnique(field.JsonTag)
 			}
 		}
+		if len(fullText) > 0 {
+			core.SetFullTextSearch(fullText...)
+		}
 	}
 }
 
@@ -0,0 +1,98 @@
+package cosy
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/uozi-tech/cosy/model"
+)
+
+// ApiOperation is a route registered by Curd
+type ApiOperation string
+
+const (
+	OperationGet     ApiOperation = "get"
+	OperationGetList ApiOperation = "get_list"
+	OperationCreate  ApiOperation = "create"
+	OperationModify  ApiOperation = "modify"
+	OperationDestroy ApiOperation = "destroy"
+	OperationRecover ApiOperation = "recover"
+
+	OperationBatchCreate ApiOperation = "batch_create"
+	OperationHistory     ApiOperation = "history"
+	OperationStream      ApiOperation = "stream"
+	OperationMove        ApiOperation = "move"
+)
+
+// ApiDescriptor describes the routes registered by Curd.InitRouter
+type ApiDescriptor struct {
+	// Path is the full path of the route group, e.g. /api/users
+	Path string
+	// Model is the type of the model
+	Model reflect.Type
+	// Operations are the enabled routes
+	Operations []ApiOperation
+	// Resolved returns the resolved meta of the model, nil if the model is not registered
+	Resolved func() *model.ResolvedModel
+	// Idempotent reports whether the create routes replay the responses of the Idempotency-Key header
+	Idempotent bool
+}
+
+// HasOperation reports whether the route of the operation is registered
+func (d *ApiDescriptor) HasOperation(op ApiOperation) bool {
+	for _, v := range d.Operations {
+		if v == op {
+			return true
+		}
+	}
+	return false
+}
+
+var (
+	apiRegistry   []*ApiDescriptor
+	apiRegistryMu sync.RWMutex
+)
+
+// registerApi records the routes registered by Curd.InitRouter
+func registerApi(d *ApiDescriptor) {
+	apiRegistryMu.Lock()
+	defer apiRegistryMu.Unlock()
+	apiRegistry = append(apiRegistry, d)
+}
+
+// RegisteredApis returns the descriptors of all routes registered by Curd.InitRouter
+func RegisteredApis() []*ApiDescriptor {
+	apiRegistryMu.RLock()
+	defer apiRegistryMu.RUnlock()
+	return append([]*ApiDescriptor(nil), apiRegistry...)
+}
+
+// describe returns the descriptor of the enabled routes
+func (c *Curd[T]) describe(path string) *ApiDescriptor {
+	d := &ApiDescriptor{
+		Path:       path,
+		Model:      reflect.TypeFor[T](),
+		Resolved:   model.GetResolvedModel[T],
+		Idempotent: c.idempotencyTTL > 0,
+	}
+	for _, v := range []struct {
+		enabled bool
+		op      ApiOperation
+	}{
+		{c.getEnabled, OperationGet},
+		{c.getListEnabled, OperationGetList},
+		{c.createEnabled, OperationCreate},
+		{c.modifyEnabled, OperationModify},
+		{c.destroyEnabled, OperationDestroy},
+		{c.recoverEnabled, OperationRecover},
+		{c.batchCreateEnabled, OperationBatchCreate},
+		{c.historyEnabled, OperationHistory},
+		{c.changeFeedEnabled, OperationStream},
+		{c.modifyEnabled && isTree[T](), OperationMove},
+	} {
+		if v.enabled {
+			d.Operations = append(d.Operations, v.op)
+		}
+	}
+	return d
+}
@@ -0,0 +1,211 @@
+package cosy
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/samber/lo"
+	"github.com/spf13/cast"
+	"github.com/uozi-tech/cosy/history"
+	"github.com/uozi-tech/cosy/map2struct"
+	"github.com/uozi-tech/cosy/model"
+	"github.com/uozi-tech/cosy/outbox"
+	"github.com/uozi-tech/cosy/valid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DefaultBatchCreateSize is the default count of records inserted by a single statement of "batch create"
+const DefaultBatchCreateSize = 100
+
+// SetBatchCreateSize sets the count of records inserted by a single statement of "batch create"
+func (c *Ctx[T]) SetBatchCreateSize(size int) *Ctx[T] {
+	c.batchCreateSize = size
+	return c
+}
+
+// validateBatchCreate validates each element of the array payload against the rules,
+// the errors are keyed by the index of the element
+func validateBatchCreate[T any](c *Ctx[T]) (errs gin.H) {
+	var payloads []map[string]any
+	if err := c.ShouldBindJSON(&payloads); err != nil {
+		logJSONBindError(c.Context, err)
+		return gin.H{"body": err.Error()}
+	}
+	if len(payloads) == 0 {
+		return gin.H{"body": "required"}
+	}
+
+	itemErrs := c.validateItems(payloads)
+	if c.abort {
+		return nil
+	}
+	if len(itemErrs) > 0 {
+		errs = make(gin.H, len(itemErrs))
+		for i, v := range itemErrs {
+			errs[strconv.Itoa(i)] = v
+		}
+		return
+	}
+
+	c.BatchPayload = payloads
+	return nil
+}
+
+// validateItems validates each payload against the rules and the unique keys,
+// the values of the unique keys are also checked against the other payloads.
+// The errors are keyed by the index of the payload, and the payloads are filtered by the rules in place.
+func (c *Ctx[T]) validateItems(payloads []map[string]any) (errs map[int]gin.H) {
+	c.dropUnwritableRules()
+
+	// the unique keys may be registered by both the field name and the json tag
+	unique := lo.Uniq(c.unique)
+
+	errs = make(map[int]gin.H)
+	// value of the unique keys -> index of the first payload, to find the duplicates within the batch
+	seen := make(map[string]map[string]int, len(unique))
+	for _, key := range unique {
+		seen[key] = make(map[string]int)
+	}
+
+	for i, payload := range payloads {
+		if payload == nil {
+			payload = make(map[string]any)
+			payloads[i] = payload
+		}
+
+		itemErrs := v.ValidateMap(payload, c.rules)
+		for k := range itemErrs {
+			itemErrs[k] = c.rules[k]
+		}
+
+		for _, key := range unique {
+			if _, ok := itemErrs[key]; ok || payload[key] == nil {
+				continue
+			}
+			value := cast.ToString(payload[key])
+			if _, ok := seen[key][value]; ok {
+				itemErrs[key] = "db_unique"
+				continue
+			}
+			seen[key][value] = i
+		}
+
+		if len(itemErrs) > 0 {
+			errs[i] = itemErrs
+		}
+	}
+
+	if len(unique) > 0 {
+		for i, payload := range payloads {
+			if _, ok := errs[i]; ok {
+				continue
+			}
+			conflicts, err := valid.DbUnique[T](c.Context, payload, unique, c.columnMapping, c.scopeTenant)
+			if err != nil {
+				c.AbortWithError(err)
+				return nil
+			}
+			if len(conflicts) > 0 {
+				itemErrs := make(gin.H, len(conflicts))
+				for _, v := range conflicts {
+					itemErrs[v] = "db_unique"
+				}
+				errs[i] = itemErrs
+			}
+		}
+	}
+
+	// Make sure that the key in each payload is also the key of rules
+	for i, payload := range payloads {
+		validated := make(map[string]any)
+		for k, v := range payload {
+			if _, ok := c.rules[k]; ok {
+				validated[k] = v
+			}
+		}
+		payloads[i] = validated
+	}
+
+	return
+}
+
+// BatchCreate creates the records of an array payload in a transaction
+func (c *Ctx[T]) BatchCreate() {
+	NewProcessChain(c).
+		SetPrepare(func(ctx *Ctx[T]) {
+			createHook[T]()(ctx)
+			prepareHook(ctx)
+		}).
+		SetValidate(func(ctx *Ctx[T]) {
+			errs := validateBatchCreate(c)
+			if c.abort {
+				return
+			}
+			if len(errs) > 0 {
+				c.JSON(http.StatusNotAcceptable, NewValidateError(errs))
+				c.Abort()
+				return
+			}
+		}).
+		SetBeforeDecode(beforeDecodeHook[T]).
+		SetDecode(func(ctx *Ctx[T]) {
+			c.BatchModels = make([]T, len(c.BatchPayload))
+			for i, payload := range c.BatchPayload {
+				if err := map2struct.WeakDecode(payload, &c.BatchModels[i]); err != nil {
+					ctx.AbortWithError(err)
+					return
+				}
+				if err := c.setTenant(&c.BatchModels[i]); err != nil {
+					ctx.AbortWithError(err)
+					return
+				}
+			}
+		}).
+		SetBeforeExecute(beforeExecuteHook[T]).
+		SetGormAction(func(ctx *Ctx[T]) {
+			for i := range c.BatchModels {
+				c.setTreePath(&c.BatchModels[i])
+				if c.abort {
+					return
+				}
+			}
+			if err := c.createBatchModels(); err != nil {
+				ctx.AbortWithError(err)
+				return
+			}
+		}).
+		SetExecuted(executedHook[T]).
+		SetResponse(func(ctx *Ctx[T]) {
+			if c.nextHandler != nil {
+				(*c.nextHandler)(c.Context)
+			} else {
+				c.JSON(http.StatusOK, model.DataList{Data: c.pruneWithFieldset(c.BatchModels)})
+			}
+		}).CreateOrModify()
+}
+
+// createBatchModels inserts the BatchModels in chunks, the chunks are inserted all or nothing,
+// and the changes of the records are recorded in the same transaction
+func (c *Ctx[T]) createBatchModels() error {
+	size := c.batchCreateSize
+	if size <= 0 {
+		size = DefaultBatchCreateSize
+	}
+
+	create := func(tx *gorm.DB) error {
+		if c.table != "" {
+			tx = tx.Table(c.table, c.tableArgs...)
+		}
+		if c.skipAssociationsOnCreate {
+			tx = tx.Omit(clause.Associations)
+		}
+		if err := tx.CreateInBatches(&c.BatchModels, size).Error; err != nil {
+			return err
+		}
+		return c.recordBatch(tx, history.ActionCreate, outbox.ActionCreated, nil, c.BatchModels)
+	}
+
+	return c.transaction(create)
+}
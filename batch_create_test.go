@@ -0,0 +1,137 @@
+package cosy
+
+import (
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/uozi-tech/cosy/model"
+	"github.com/uozi-tech/cosy/router"
+	"github.com/uozi-tech/cosy/sandbox"
+)
+
+func TestCtx_BatchCreate(t *testing.T) {
+	sandbox.NewInstance("app.ini", "pgsql").
+		RegisterModels(User{}).Run(func(instance *sandbox.Instance) {
+		r := router.GetEngine()
+		err := r.SetTrustedProxies([]string{"127.0.0.1"})
+		if err != nil {
+			t.Error(err)
+			return
+		}
+
+		g := r.Group("/")
+		Api[User]("users").WithBatchCreate().InitRouter(g)
+		testBatchCreate(t, instance)
+	})
+}
+
+func batchCreateUser(i int) gin.H {
+	return gin.H{
+		"school_id":   fmt.Sprintf("02818%02d", i),
+		"name":        fmt.Sprintf("张三-%d", i),
+		"password":    "123457887",
+		"age":         20,
+		"college":     "大数据与互联网学院",
+		"direction":   "大数据与人工智能",
+		"email":       fmt.Sprintf("%d@aa.com", i),
+		"phone":       "123456789",
+		"employed_at": "2024-03-13T11:22:44.405374+08:00",
+	}
+}
+
+func testBatchCreate(t *testing.T, instance *sandbox.Instance) {
+	c := instance.GetClient()
+
+	// duplicated email within the batch
+	duplicated := batchCreateUser(3)
+	duplicated["email"] = "1@aa.com"
+	invalid := batchCreateUser(2)
+	delete(invalid, "name")
+
+	resp, err := c.Request(http.MethodPost, "/users/batch", []gin.H{
+		batchCreateUser(1), invalid, duplicated,
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Equal(t, http.StatusNotAcceptable, resp.StatusCode)
+
+	var validateErr ValidateError
+	err = resp.To(&validateErr)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Equal(t, map[string]any{
+		"1": map[string]any{"name": "required"},
+		"2": map[string]any{"email": "db_unique"},
+	}, validateErr.Errors)
+
+	resp, err = c.Request(http.MethodPost, "/users/batch", []gin.H{
+		batchCreateUser(1), batchCreateUser(2), batchCreateUser(3),
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var dataList struct {
+		Data []User `json:"data"`
+	}
+	err = resp.To(&dataList)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Len(t, dataList.Data, 3)
+	for i, user := range dataList.Data {
+		assert.NotZero(t, user.ID)
+		assert.Equal(t, fmt.Sprintf("%d@aa.com", i+1), user.Email)
+	}
+
+	// conflicts with the existing records
+	resp, err = c.Request(http.MethodPost, "/users/batch", []gin.H{
+		batchCreateUser(4), batchCreateUser(1),
+	})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Equal(t, http.StatusNotAcceptable, resp.StatusCode)
+
+	validateErr = ValidateError{}
+	err = resp.To(&validateErr)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Equal(t, map[string]any{
+		"1": map[string]any{"email": "db_unique"},
+	}, validateErr.Errors)
+
+	// nothing is created when the batch is rejected
+	resp, err = c.Get("/users")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	var list model.DataList
+	err = resp.To(&list)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Equal(t, int64(3), list.Pagination.Total)
+
+	resp, err = c.Request(http.MethodPost, "/users/batch", []gin.H{})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	assert.Equal(t, http.StatusNotAcceptable, resp.StatusCode)
+}
@@ -4,7 +4,10 @@ import (
 	"net/http"
 
 	"github.com/spf13/cast"
+	"github.com/uozi-tech/cosy/history"
 	"github.com/uozi-tech/cosy/model"
+	"github.com/uozi-tech/cosy/outbox"
+	"gorm.io/gorm"
 )
 
 type batchDeleteStruct[T any] struct {
@@ -38,7 +41,30 @@ func (c *Ctx[T]) BatchDestroy() {
 				ctx.Tx = ctx.Tx.Unscoped()
 			}
 			ctx.Tx = ctx.applyGormScopes(ctx.Tx)
-			err := ctx.Tx.Delete(&c.OriginModel, toBatchIDs(c.BatchEffectedIDs)).Error
+			ids := toBatchIDs(c.BatchEffectedIDs)
+			c.checkBatchPolicy(ctx.Tx, ids, Policy[T].CanDelete)
+			if c.abort {
+				return
+			}
+			err := c.transaction(func(tx *gorm.DB) error {
+				tx = tx.Session(&gorm.Session{})
+				var before []T
+				if c.recordsChanges() {
+					if err := tx.Where(c.itemKey+" IN ?", ids).Find(&before).Error; err != nil {
+						return err
+					}
+				}
+				// the children are resolved by the paths of the nodes before they're deleted
+				for _, id := range c.BatchEffectedIDs {
+					if err := c.deleteTreeChildren(tx, id); err != nil {
+						return err
+					}
+				}
+				if err := tx.Delete(&c.OriginModel, ids).Error; err != nil {
+					return err
+				}
+				return c.recordBatch(tx, history.ActionDelete, outbox.ActionDeleted, before, nil)
+			})
 			if err != nil {
 				ctx.AbortWithError(err)
 				return
@@ -72,17 +98,39 @@ func (c *Ctx[T]) BatchRecover() {
 		SetGormAction(func(ctx *Ctx[T]) {
 			ctx.Tx = ctx.Tx.Unscoped()
 			ctx.Tx = ctx.applyGormScopes(ctx.Tx)
-			result := ctx.Tx.Where(c.itemKey+" in ?", toBatchIDs(c.BatchEffectedIDs)).Model(&c.Model)
-
-			var err error
-			resolvedModel := model.GetResolvedModel[T]()
-			if deletedAt, ok := resolvedModel.Fields["DeletedAt"]; !ok ||
-				(deletedAt.DefaultValue == "" || deletedAt.DefaultValue == "null") {
-				err = result.Update("deleted_at", nil).Error
-			} else {
-				err = result.Update("deleted_at", 0).Error
+			ids := toBatchIDs(c.BatchEffectedIDs)
+			c.checkBatchPolicy(ctx.Tx, ids, Policy[T].CanDelete)
+			if c.abort {
+				return
 			}
+			err := c.transaction(func(tx *gorm.DB) error {
+				tx = tx.Session(&gorm.Session{})
+				var before []T
+				if c.recordsChanges() {
+					if err := tx.Where(c.itemKey+" in ?", ids).Find(&before).Error; err != nil {
+						return err
+					}
+				}
+
+				result := tx.Where(c.itemKey+" in ?", ids).Model(&c.Model)
+				var err error
+				resolvedModel := model.GetResolvedModel[T]()
+				if deletedAt, ok := resolvedModel.Fields["DeletedAt"]; !ok ||
+					(deletedAt.DefaultValue == "" || deletedAt.DefaultValue == "null") {
+					err = result.Update("deleted_at", nil).Error
+				} else {
+					err = result.Update("deleted_at", 0).Error
+				}
+				if err != nil || !c.recordsChanges() {
+					return err
+				}
 
+				var after []T
+				if err = tx.Where(c.itemKey+" in ?", ids).Find(&after).Error; err != nil {
+					return err
+				}
+				return c.recordBatch(tx, history.ActionRecover, outbox.ActionRecovered, before, after)
+			})
 			if err != nil {
 				ctx.AbortWithError(err)
 				return
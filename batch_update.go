@@ -1,11 +1,15 @@
 package cosy
 
 import (
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/uozi-tech/cosy/history"
 	"github.com/uozi-tech/cosy/map2struct"
 	"github.com/uozi-tech/cosy/model"
+	"github.com/uozi-tech/cosy/outbox"
+	"gorm.io/gorm"
 )
 
 type batchUpdateStruct[T any] struct {
@@ -14,6 +18,7 @@ type batchUpdateStruct[T any] struct {
 }
 
 func (c *Ctx[T]) BatchModify() {
+	version := versionField[T]()
 	NewProcessChain(c).
 		SetPrepare(func(ctx *Ctx[T]) {
 			errs := validateBatchUpdate(c)
@@ -53,8 +58,66 @@ func (c *Ctx[T]) BatchModify() {
 				ctx.Tx = ctx.Tx.Table(c.table, c.tableArgs...)
 			}
 
-			err := ctx.Tx.Model(&c.Model).Where(c.itemKey+" IN ?", toBatchIDs(c.BatchEffectedIDs)).
-				Select(c.GetSelectedFields()).Updates(&c.Model).Error
+			ids := toBatchIDs(c.BatchEffectedIDs)
+			c.checkBatchPolicy(ctx.Tx, ids, Policy[T].CanModify)
+			if c.abort {
+				return
+			}
+			var versions map[any]int64
+			if version != nil {
+				// the statements below must not share the conditions
+				ctx.Tx = ctx.Tx.Session(&gorm.Session{})
+				versions = c.checkBatchIfMatch(ctx.Tx, version, ids)
+				if c.abort {
+					return
+				}
+			}
+
+			update := func(tx *gorm.DB) error {
+				// the statements below must not share the conditions
+				tx = tx.Session(&gorm.Session{})
+				var before []T
+				if c.recordsChanges() {
+					if err := tx.Where(c.itemKey+" IN ?", ids).Find(&before).Error; err != nil {
+						return err
+					}
+				}
+
+				// the versions are bumped first, which locks the records until the transaction ends,
+				// and only the records of the checked versions are bumped
+				if version != nil {
+					bump := tx.Model(new(T)).Where(c.itemKey+" IN ?", ids)
+					if len(versions) > 0 {
+						bump = tx.Model(new(T)).Where(c.whereBatchVersions(version, versions))
+					}
+					result := bumpBatchVersion(bump, version)
+					if result.Error != nil {
+						return result.Error
+					}
+					// some records have been modified after their ETags were checked
+					if versions != nil && result.RowsAffected != int64(len(versions)) {
+						return ErrVersionConflict
+					}
+				}
+				err := tx.Model(&c.Model).Where(c.itemKey+" IN ?", ids).
+					Select(c.GetSelectedFields()).Updates(&c.Model).Error
+				if err != nil || !c.recordsChanges() {
+					return err
+				}
+
+				var after []T
+				if err = tx.Where(c.itemKey+" IN ?", ids).Find(&after).Error; err != nil {
+					return err
+				}
+				return c.recordBatch(tx, history.ActionUpdate, outbox.ActionUpdated, before, after)
+			}
+
+			err := c.transaction(update)
+			if errors.Is(err, ErrVersionConflict) {
+				c.JSON(http.StatusConflict, ErrVersionConflict)
+				c.Abort()
+				return
+			}
 			if err != nil {
 				ctx.AbortWithError(err)
 				return
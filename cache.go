@@ -0,0 +1,238 @@
+package cosy
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bsm/redislock"
+	"github.com/gin-gonic/gin"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/uozi-tech/cosy/logger"
+	"github.com/uozi-tech/cosy/redis"
+)
+
+const (
+	// cacheLockTTL is the time to live of the lock of a cold key,
+	// the requests waiting for the lock query the database after it
+	cacheLockTTL = 5 * time.Second
+	// cacheWaitInterval is the interval of checking the cache while another request holds the lock
+	cacheWaitInterval = 50 * time.Millisecond
+)
+
+// cacheEntry is the cached response of "get" and "get list"
+type cacheEntry struct {
+	ETag string          `json:"etag,omitempty"`
+	Data json.RawMessage `json:"data"`
+}
+
+var cacheVaryResolver func(c *gin.Context) string
+
+// SetCacheVaryResolver sets the function to resolve the vary key of the cached responses, e.g. the id of the user.
+// The tenant and the roles of the request are always varied, the models with an access policy are not cached
+// unless the resolver is set, because the visible records of the policy depend on the request.
+func SetCacheVaryResolver(resolver func(c *gin.Context) string) {
+	cacheVaryResolver = resolver
+}
+
+// WithCache caches the response data of "get" and "get list" in redis for the ttl,
+// the cache of the model is invalidated after any "create", "modify", "destroy", "recover"
+// or batch action. The cached response is responded without the GormAction and Executed stages,
+// so the cache is skipped if a response builder or an Executed hook is registered.
+func (c *Ctx[T]) WithCache(ttl time.Duration) *Ctx[T] {
+	c.cacheTTL = ttl
+	return c
+}
+
+// cacheModelName returns the name of the model in the cache keys
+func cacheModelName[T any]() string {
+	return reflect.TypeFor[T]().Name()
+}
+
+// cacheGenerationKey returns the key of the generation counter of the model
+func cacheGenerationKey[T any]() string {
+	return cacheGenerationKeyOf(cacheModelName[T]())
+}
+
+// cacheGenerationKeyOf returns the key of the generation counter of the model by its name
+func cacheGenerationKeyOf(name string) string {
+	return "cache:" + name + ":generation"
+}
+
+// InvalidateCache invalidates the cached responses of the model, it's called automatically
+// after the actions of cosy, and should be called after the model is changed in other ways
+func InvalidateCache[T any]() {
+	invalidateCache(cacheModelName[T]())
+}
+
+// invalidateCache invalidates the cached responses of the model by its name
+func invalidateCache(name string) {
+	if redis.GetClient() == nil {
+		return
+	}
+	if _, err := redis.Incr(cacheGenerationKeyOf(name)); err != nil {
+		logger.Error(err)
+	}
+}
+
+// cacheVaryKey returns the vary key of the request, false means the response can't be cached
+func (c *Ctx[T]) cacheVaryKey() (string, bool) {
+	if policyOf[T]() != nil && cacheVaryResolver == nil {
+		return "", false
+	}
+
+	var sb strings.Builder
+	if c.tenantScopeField() != nil {
+		tenant, _ := c.tenantOf()
+		fmt.Fprintf(&sb, "tenant=%v;", tenant)
+	}
+	roles := slices.Clone(c.rolesOf())
+	slices.Sort(roles)
+	sb.WriteString("roles=" + strings.Join(roles, "|") + ";")
+	if cacheVaryResolver != nil {
+		sb.WriteString("vary=" + cacheVaryResolver(c.Context))
+	}
+	return sb.String(), true
+}
+
+// cacheKey returns the key of the cached response of the request in the generation,
+// the key is the hash of the path, the normalized query string, the table and the vary key
+func (c *Ctx[T]) cacheKey(generation string) (string, bool) {
+	vary, ok := c.cacheVaryKey()
+	if !ok {
+		return "", false
+	}
+
+	hash := sha1.New()
+	for _, v := range []string{c.Request.URL.Path, c.Request.URL.Query().Encode(), c.table, vary} {
+		hash.Write([]byte(v))
+		hash.Write([]byte{0})
+	}
+	return "cache:" + cacheModelName[T]() + ":" + generation + ":" + hex.EncodeToString(hash.Sum(nil)), true
+}
+
+// getCacheEntry reads the cached response, false means the key is missing or the cache is unavailable
+func getCacheEntry(key string) (*cacheEntry, bool) {
+	value, err := redis.Get(key)
+	if err != nil {
+		if !errors.Is(err, goredis.Nil) {
+			logger.Error(err)
+		}
+		return nil, false
+	}
+	var entry cacheEntry
+	if err := json.Unmarshal([]byte(value), &entry); err != nil {
+		logger.Error(err)
+		return nil, false
+	}
+	return &entry, true
+}
+
+// useCacheEntry makes the cached response the result data of the request
+func (c *Ctx[T]) useCacheEntry(entry *cacheEntry) {
+	if entry.ETag != "" {
+		c.Header("ETag", entry.ETag)
+	}
+	c.DefaultResponseData = entry.Data
+	c.ResultData = entry.Data
+}
+
+// cacheable reports whether the response of the request can be cached, the response builder and the Executed hooks
+// may depend on the types of the result data, which can't be restored from the json of the cache
+func (c *Ctx[T]) cacheable() bool {
+	return c.cacheTTL > 0 && c.responseBuilder == nil && len(c.executedHookFunc) == 0
+}
+
+// loadCache responds the cached response if it exists, true means the database is not queried.
+// For a cold key only one request obtains the lock and queries the database, the others wait for
+// the cache to be stored until the lock is expired.
+func (c *Ctx[T]) loadCache() bool {
+	if !c.cacheable() || redis.GetClient() == nil {
+		return false
+	}
+
+	generation, err := redis.Get(cacheGenerationKey[T]())
+	if err != nil && !errors.Is(err, goredis.Nil) {
+		logger.Error(err)
+		return false
+	}
+	if generation == "" {
+		generation = "0"
+	}
+
+	key, ok := c.cacheKey(generation)
+	if !ok {
+		return false
+	}
+	c.cacheEntryKey = key
+
+	if entry, ok := getCacheEntry(key); ok {
+		c.useCacheEntry(entry)
+		return true
+	}
+
+	lock, err := redis.ObtainLock(key+":lock", cacheLockTTL, nil)
+	if err == nil {
+		c.cacheLock = lock
+		return false
+	}
+	if !errors.Is(err, redislock.ErrNotObtained) {
+		logger.Error(err)
+		return false
+	}
+
+	for deadline := time.Now().Add(cacheLockTTL); time.Now().Before(deadline); {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-time.After(cacheWaitInterval):
+		}
+		if entry, ok := getCacheEntry(key); ok {
+			c.useCacheEntry(entry)
+			return true
+		}
+	}
+	return false
+}
+
+// storeCache stores the result data of the request
+func (c *Ctx[T]) storeCache() {
+	if c.cacheEntryKey == "" || c.abort {
+		return
+	}
+
+	data, err := json.Marshal(c.ResultData)
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	value, err := json.Marshal(cacheEntry{
+		ETag: c.Writer.Header().Get("ETag"),
+		Data: data,
+	})
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	if err := redis.Set(c.cacheEntryKey, value, c.cacheTTL); err != nil {
+		logger.Error(err)
+	}
+}
+
+// releaseCacheLock releases the lock of the cold key obtained by the request
+func (c *Ctx[T]) releaseCacheLock() {
+	if c.cacheLock == nil {
+		return
+	}
+	if err := c.cacheLock.Release(context.Background()); err != nil && !errors.Is(err, redislock.ErrLockNotHeld) {
+		logger.Error(err)
+	}
+	c.cacheLock = nil
+}
@@ -0,0 +1,115 @@
+package cosy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/uozi-tech/cosy/model"
+	"gorm.io/gorm"
+)
+
+type cachedPolicyModel struct {
+	model.Model
+	OwnerID uint64 `json:"owner_id"`
+}
+
+type cachedOwnerPolicy struct{}
+
+func (cachedOwnerPolicy) Scope(c *gin.Context, tx *gorm.DB) *gorm.DB {
+	return tx.Where("owner_id = ?", c.GetHeader("X-User"))
+}
+
+func (cachedOwnerPolicy) CanModify(c *gin.Context, record *cachedPolicyModel) bool {
+	return true
+}
+
+func (cachedOwnerPolicy) CanDelete(c *gin.Context, record *cachedPolicyModel) bool {
+	return true
+}
+
+func newCacheContext(target string, tenant string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, target, nil)
+	if tenant != "" {
+		c.Request.Header.Set("X-Tenant", tenant)
+	}
+	return c
+}
+
+func TestCacheKey(t *testing.T) {
+	model.RegisterModels(tenantModel{}, cachedPolicyModel{})
+	model.ResolvedModels()
+
+	key := func(target string, tenant string) string {
+		k, ok := Core[tenantModel](newCacheContext(target, tenant)).cacheKey("1")
+		assert.True(t, ok)
+		return k
+	}
+
+	// the query string is normalized
+	assert.Equal(t, key("/tenants?b=2&a=1", ""), key("/tenants?a=1&b=2", ""))
+	assert.NotEqual(t, key("/tenants?a=1", ""), key("/tenants?a=2", ""))
+	assert.NotEqual(t, key("/tenants/1", ""), key("/tenants/2", ""))
+	assert.Contains(t, key("/tenants", ""), "cache:tenantModel:1:")
+
+	// varied by the tenant
+	SetTenantResolver(func(c *gin.Context) (any, bool) {
+		tenant := c.GetHeader("X-Tenant")
+		return tenant, tenant != ""
+	})
+	defer SetTenantResolver(nil)
+	assert.NotEqual(t, key("/tenants", "1"), key("/tenants", "2"))
+
+	// varied by the roles
+	SetRoleResolver(func(c *gin.Context) []string {
+		return c.QueryArray("role")
+	})
+	defer SetRoleResolver(nil)
+	assert.Equal(t, key("/tenants?role=a&role=b", "1"), key("/tenants?role=a&role=b", "1"))
+	assert.NotEqual(t, key("/tenants?role=a", "1"), key("/tenants?role=b", "1"))
+
+	// the models with policy are not cached without the vary resolver
+	RegisterPolicy[cachedPolicyModel](cachedOwnerPolicy{})
+	_, ok := Core[cachedPolicyModel](newCacheContext("/policies", "")).cacheKey("1")
+	assert.False(t, ok)
+
+	SetCacheVaryResolver(func(c *gin.Context) string {
+		return c.GetHeader("X-User")
+	})
+	defer SetCacheVaryResolver(nil)
+
+	a := newCacheContext("/policies", "")
+	a.Request.Header.Set("X-User", "1")
+	b := newCacheContext("/policies", "")
+	b.Request.Header.Set("X-User", "2")
+	keyA, ok := Core[cachedPolicyModel](a).cacheKey("1")
+	assert.True(t, ok)
+	keyB, _ := Core[cachedPolicyModel](b).cacheKey("1")
+	assert.NotEqual(t, keyA, keyB)
+}
+
+func TestCacheable(t *testing.T) {
+	core := Core[tenantModel](newCacheContext("/tenants", ""))
+	assert.False(t, core.cacheable())
+	core.WithCache(time.Minute)
+	assert.True(t, core.cacheable())
+
+	// the response builder and the Executed hooks may depend on the types of the result data
+	core.SetResponseBuilder(func(ctx *Ctx[tenantModel]) {})
+	assert.False(t, core.cacheable())
+	core = Core[tenantModel](newCacheContext("/tenants", "")).WithCache(time.Minute)
+	core.ExecutedHook(func(ctx *Ctx[tenantModel]) {})
+	assert.False(t, core.cacheable())
+}
+
+func TestCacheWithoutRedis(t *testing.T) {
+	core := Core[tenantModel](newCacheContext("/tenants", "")).WithCache(time.Minute)
+	assert.False(t, core.loadCache())
+	core.storeCache()
+	core.releaseCacheLock()
+	InvalidateCache[tenantModel]()
+}
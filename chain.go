@@ -11,6 +11,9 @@ package cosy
 // - Each Set* method registers the corresponding stage function.
 // - Stages are executed with the same core context (Ctx[T]).
 // - If ctx.abort becomes true during execution, remaining stages are not executed.
+// - The tenant of the request is resolved before Prepare for the models scoped to the tenant.
+// - Get/List responds the cached result data without GormAction and Executed if the cache is enabled.
+// - The cache of the model is invalidated after the other actions are succeeded.
 type ProcessChain[T any] struct {
 	core          *Ctx[T]
 	prepare       func(ctx *Ctx[T])
@@ -84,6 +87,7 @@ func (c *ProcessChain[T]) SetResponse(fn func(ctx *Ctx[T])) *ProcessChain[T] {
 // CreateOrModify executes the process chain for create or modify actions.
 func (c *ProcessChain[T]) CreateOrModify() {
 	chain := []func(ctx *Ctx[T]){
+		(*Ctx[T]).resolveTenant,
 		c.prepare,
 		c.validate,
 		c.beforeDecode,
@@ -107,6 +111,11 @@ func (c *ProcessChain[T]) CreateOrModify() {
 		c.core.Tx.Commit()
 	}
 
+	if c.core.abort == false {
+		InvalidateCache[T]()
+		c.core.publishChanges()
+	}
+
 	if c.core.abort == false && c.response != nil {
 		c.response(c.core)
 	}
@@ -114,17 +123,25 @@ func (c *ProcessChain[T]) CreateOrModify() {
 
 // GetOrGetList executes the process chain for get or get list actions.
 func (c *ProcessChain[T]) GetOrGetList() {
+	defer c.core.releaseCacheLock()
+
 	chain := []func(ctx *Ctx[T]){
+		(*Ctx[T]).resolveTenant,
 		c.prepare,
 		c.beforeExecute,
 		c.gormAction,
 		c.executed,
+		(*Ctx[T]).storeCache,
 	}
 
-	for _, fn := range chain {
+	for i, fn := range chain {
 		if fn == nil {
 			continue
 		}
+		// the cached result data is responded without querying
+		if i == 3 && c.core.loadCache() {
+			break
+		}
 		fn(c.core)
 		if c.core.abort {
 			break
@@ -139,6 +156,7 @@ func (c *ProcessChain[T]) GetOrGetList() {
 // DeleteOrRecover executes the process chain for delete or recover actions.
 func (c *ProcessChain[T]) DestroyOrRecover() {
 	chain := []func(ctx *Ctx[T]){
+		(*Ctx[T]).resolveTenant,
 		c.prepare,
 		c.beforeExecute,
 		c.gormAction,
@@ -158,6 +176,11 @@ func (c *ProcessChain[T]) DestroyOrRecover() {
 		c.core.Tx.Commit()
 	}
 
+	if c.core.abort == false {
+		InvalidateCache[T]()
+		c.core.publishChanges()
+	}
+
 	if c.core.abort == false && c.response != nil {
 		c.response(c.core)
 	}
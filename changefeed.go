@@ -0,0 +1,325 @@
+package cosy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/spf13/cast"
+	"github.com/uozi-tech/cosy/kernel"
+	"github.com/uozi-tech/cosy/logger"
+	"github.com/uozi-tech/cosy/model"
+	"github.com/uozi-tech/cosy/outbox"
+	"github.com/uozi-tech/cosy/redis"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// changeFeedHeartbeat is the interval of the heartbeats of the streams, which keep the idle connections alive
+	changeFeedHeartbeat = 15 * time.Second
+	// changeFeedBuffer is the count of the changes buffered for a stream, the changes are dropped for the slow streams
+	changeFeedBuffer = 64
+)
+
+// ChangeFeedEvent is the event pushed to the streams of the change feed, Data is the record
+// transformed by the transformer of the stream, it's omitted for the permanently deleted records
+type ChangeFeedEvent struct {
+	Action outbox.Action `json:"action"`
+	ID     string        `json:"id"`
+	Data   any           `json:"data,omitempty"`
+}
+
+// feedChange is the change published to the streams, the record is loaded by each stream,
+// so that the list filters of the stream are applied. Tenant is the tenant of the record
+// if the model is scoped to the tenant, which is checked when the record can't be loaded.
+type feedChange struct {
+	Action outbox.Action `json:"action"`
+	ID     string        `json:"id"`
+	Tenant string        `json:"tenant,omitempty"`
+}
+
+// changeFeedHub fans out the changes to the streams of the instance, the changes are received
+// from redis if it's initialized, so that the streams receive the changes of all the instances
+type changeFeedHub struct {
+	mu          sync.RWMutex
+	subscribers map[string]map[chan feedChange]struct{}
+	listening   map[string]bool
+}
+
+var feedHub = &changeFeedHub{
+	subscribers: make(map[string]map[chan feedChange]struct{}),
+	listening:   make(map[string]bool),
+}
+
+var changeFeedUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+}
+
+// SetChangeFeedCheckOrigin sets the function to check the origin of the websocket streams of the change feed,
+// only the requests of the same origin are accepted by default
+func SetChangeFeedCheckOrigin(check func(r *http.Request) bool) {
+	changeFeedUpgrader.CheckOrigin = check
+}
+
+// changeFeedChannel returns the redis channel of the changes of the model
+func changeFeedChannel[T any]() string {
+	return "change_feed:" + eventModelName[T]()
+}
+
+// subscribe returns the changes of the channel, the subscription is cancelled by the returned function
+func (h *changeFeedHub) subscribe(channel string) (<-chan feedChange, func()) {
+	ch := make(chan feedChange, changeFeedBuffer)
+
+	h.mu.Lock()
+	if h.subscribers[channel] == nil {
+		h.subscribers[channel] = make(map[chan feedChange]struct{})
+	}
+	h.subscribers[channel][ch] = struct{}{}
+	listen := redis.GetClient() != nil && !h.listening[channel]
+	if listen {
+		h.listening[channel] = true
+	}
+	h.mu.Unlock()
+
+	if listen {
+		go kernel.Run(context.Background(), "change-feed", func(ctx context.Context) {
+			h.listen(channel)
+		})
+	}
+
+	return ch, func() {
+		h.mu.Lock()
+		delete(h.subscribers[channel], ch)
+		h.mu.Unlock()
+	}
+}
+
+// listen broadcasts the changes of the redis channel to the streams of the instance
+func (h *changeFeedHub) listen(channel string) {
+	defer func() {
+		// the channel is listened again by the next stream
+		h.mu.Lock()
+		h.listening[channel] = false
+		h.mu.Unlock()
+	}()
+
+	pubsub := redis.Subscribe(channel)
+	defer pubsub.Close()
+	for message := range pubsub.Channel() {
+		var change feedChange
+		if err := json.Unmarshal([]byte(message.Payload), &change); err != nil {
+			logger.Error(err)
+			continue
+		}
+		h.broadcast(channel, change)
+	}
+}
+
+// broadcast sends the change to the streams of the instance
+func (h *changeFeedHub) broadcast(channel string, change feedChange) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for ch := range h.subscribers[channel] {
+		select {
+		case ch <- change:
+		default:
+		}
+	}
+}
+
+// publish publishes the changes to the streams of all the instances through redis,
+// or to the streams of the instance if redis isn't initialized
+func (h *changeFeedHub) publish(channel string, changes []feedChange) {
+	for _, change := range changes {
+		if redis.GetClient() == nil {
+			h.broadcast(channel, change)
+			continue
+		}
+		message, err := json.Marshal(change)
+		if err != nil {
+			logger.Error(err)
+			continue
+		}
+		if err = redis.Publish(channel, message); err != nil {
+			logger.Error(err)
+		}
+	}
+}
+
+// WithChangeFeed publishes the changes of "create", "modify", "destroy" and "recover" to the streams
+// of the model after the changes are committed
+func (c *Ctx[T]) WithChangeFeed() *Ctx[T] {
+	c.changeFeed = true
+	return c
+}
+
+// recordChange records the change of the record to be published after the changes are committed
+func (c *Ctx[T]) recordChange(action outbox.Action, id any) {
+	if !c.changeFeed {
+		return
+	}
+	change := feedChange{Action: action, ID: cast.ToString(id)}
+	if c.tenantScopeField() != nil {
+		tenant, _ := c.tenantOf()
+		change.Tenant = cast.ToString(tenant)
+	}
+	c.changes = append(c.changes, change)
+}
+
+// publishChanges publishes the recorded changes to the streams
+func (c *Ctx[T]) publishChanges() {
+	if len(c.changes) == 0 {
+		return
+	}
+	feedHub.publish(changeFeedChannel[T](), c.changes)
+	c.changes = nil
+}
+
+// Stream streams the changes of the records matching the list filters of the request, by server-sent events,
+// or by websocket if the request is a websocket upgrade. The records are transformed by the transformer.
+func (c *Ctx[T]) Stream() {
+	NewProcessChain(c).
+		SetPrepare(c.prepareListHook).
+		SetBeforeExecute(beforeExecuteHook[T]).
+		SetGormAction(func(ctx *Ctx[T]) {
+			c.handleTable()
+			c.combineStdSelectorRequest()
+
+			changes, cancel := feedHub.subscribe(changeFeedChannel[T]())
+			defer cancel()
+
+			if websocket.IsWebSocketUpgrade(c.Request) {
+				c.streamWebSocket(changes)
+			} else {
+				c.streamEvents(changes)
+			}
+		}).
+		GetOrGetList()
+}
+
+// changeFeedEvent returns the event of the change, false means the record doesn't match the list filters
+// of the request. The deleted records are loaded unscoped, the permanently deleted records can't be loaded,
+// so their events carry only the id and are sent to the streams of the same tenant regardless of the filters.
+func (c *Ctx[T]) changeFeedEvent(change feedChange) (*ChangeFeedEvent, bool) {
+	tx := model.UseDB(c.Request.Context()).Model(new(T))
+	if change.Action == outbox.ActionDeleted {
+		tx = tx.Unscoped()
+	}
+	tx = c.scopeTenant(tx)
+	tx = c.scopePolicy(tx)
+	for _, scope := range c.gormScopes {
+		tx = scope(tx)
+	}
+
+	var record T
+	result := tx.Where(clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: c.itemKey}, Value: change.ID}).
+		Limit(1).Find(&record)
+	if result.Error != nil {
+		logger.Error(result.Error)
+		return nil, false
+	}
+	if result.RowsAffected == 0 {
+		if change.Action != outbox.ActionDeleted || !c.sameTenant(change.Tenant) {
+			return nil, false
+		}
+		return &ChangeFeedEvent{Action: change.Action, ID: change.ID}, true
+	}
+
+	var data any = &record
+	if c.transformer != nil {
+		data = c.transformer(&record)
+	}
+	return &ChangeFeedEvent{Action: change.Action, ID: change.ID, Data: c.pruneWithFieldset(data)}, true
+}
+
+// sameTenant reports whether the tenant of the change is the tenant of the stream
+func (c *Ctx[T]) sameTenant(tenant string) bool {
+	if c.tenantScopeField() == nil {
+		return true
+	}
+	current, ok := c.tenantOf()
+	return ok && cast.ToString(current) == tenant
+}
+
+// streamEvents streams the changes by server-sent events until the request is cancelled
+func (c *Ctx[T]) streamEvents(changes <-chan feedChange) {
+	header := c.Writer.Header()
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+	header.Set("X-Accel-Buffering", "no")
+	c.Writer.WriteHeader(http.StatusOK)
+	c.Writer.Flush()
+
+	ticker := time.NewTicker(changeFeedHeartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.Request.Context().Done():
+			return
+		case <-ticker.C:
+			_, _ = fmt.Fprint(c.Writer, ": ping\n\n")
+		case change := <-changes:
+			event, ok := c.changeFeedEvent(change)
+			if !ok {
+				continue
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				logger.Error(err)
+				continue
+			}
+			_, _ = fmt.Fprintf(c.Writer, "event: %s\ndata: %s\n\n", event.Action, data)
+		}
+		c.Writer.Flush()
+	}
+}
+
+// streamWebSocket streams the changes by websocket until the connection is closed
+func (c *Ctx[T]) streamWebSocket(changes <-chan feedChange) {
+	conn, err := changeFeedUpgrader.Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	defer conn.Close()
+
+	// the messages of the client are discarded, reading detects the closed connection
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ticker := time.NewTicker(changeFeedHeartbeat)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case <-ticker.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(changeFeedHeartbeat)); err != nil {
+				return
+			}
+		case change := <-changes:
+			event, ok := c.changeFeedEvent(change)
+			if !ok {
+				continue
+			}
+			if err := conn.WriteJSON(event); err != nil {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package cosy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/uozi-tech/cosy/model"
+	"github.com/uozi-tech/cosy/outbox"
+	"gorm.io/driver/sqlite"
+)
+
+type changeFeedModel struct {
+	model.Model
+	Name string `json:"name"`
+}
+
+// hardDeleteModel has no DeletedAt, so its records are deleted permanently
+type hardDeleteModel struct {
+	ID       uint64 `json:"id" gorm:"primaryKey"`
+	TenantID string `json:"tenant_id" cosy:"tenant"`
+	Name     string `json:"name"`
+}
+
+func TestChangeFeedChannel(t *testing.T) {
+	assert.Equal(t, "change_feed:change_feed_model", changeFeedChannel[changeFeedModel]())
+}
+
+func TestChangeFeedHub(t *testing.T) {
+	hub := &changeFeedHub{
+		subscribers: make(map[string]map[chan feedChange]struct{}),
+		listening:   make(map[string]bool),
+	}
+
+	first, cancelFirst := hub.subscribe("feed")
+	second, cancelSecond := hub.subscribe("feed")
+	other, cancelOther := hub.subscribe("other")
+	defer cancelSecond()
+	defer cancelOther()
+
+	// the changes are broadcast to the streams of the instance without redis
+	hub.publish("feed", []feedChange{{Action: outbox.ActionCreated, ID: "1"}})
+	assert.Equal(t, feedChange{Action: outbox.ActionCreated, ID: "1"}, <-first)
+	assert.Equal(t, feedChange{Action: outbox.ActionCreated, ID: "1"}, <-second)
+	assert.Empty(t, other)
+
+	cancelFirst()
+	hub.publish("feed", []feedChange{{Action: outbox.ActionDeleted, ID: "1"}})
+	assert.Empty(t, first)
+	assert.Equal(t, feedChange{Action: outbox.ActionDeleted, ID: "1"}, <-second)
+
+	// the changes are dropped for the slow streams instead of blocking the publisher
+	for range changeFeedBuffer + 1 {
+		hub.publish("feed", []feedChange{{Action: outbox.ActionUpdated, ID: "1"}})
+	}
+	assert.Len(t, second, changeFeedBuffer)
+}
+
+func TestRecordChange(t *testing.T) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/", nil)
+
+	core := Core[changeFeedModel](c)
+	core.recordChange(outbox.ActionCreated, 1)
+	assert.Empty(t, core.changes)
+
+	changes, cancel := feedHub.subscribe(changeFeedChannel[changeFeedModel]())
+	defer cancel()
+
+	core.WithChangeFeed()
+	core.recordChange(outbox.ActionUpdated, uint64(1))
+	assert.Equal(t, []feedChange{{Action: outbox.ActionUpdated, ID: "1"}}, core.changes)
+
+	core.publishChanges()
+	assert.Empty(t, core.changes)
+	assert.Equal(t, feedChange{Action: outbox.ActionUpdated, ID: "1"}, <-changes)
+}
+
+func TestChangeFeedEventOfDeleted(t *testing.T) {
+	model.ClearCollection()
+	model.RegisterModels(hardDeleteModel{})
+	db := model.Init(sqlite.Open(filepath.Join(t.TempDir(), "changefeed.db")))
+	assert.NoError(t, db.Create(&hardDeleteModel{ID: 1, TenantID: "a", Name: "kept"}).Error)
+
+	SetTenantResolver(func(c *gin.Context) (any, bool) {
+		tenant := c.GetHeader("X-Tenant")
+		return tenant, tenant != ""
+	})
+	defer SetTenantResolver(nil)
+
+	c, _ := newTenantContext("a")
+	core := Core[hardDeleteModel](c).WithChangeFeed()
+	core.recordChange(outbox.ActionDeleted, 2)
+	assert.Equal(t, []feedChange{{Action: outbox.ActionDeleted, ID: "2", Tenant: "a"}}, core.changes)
+
+	// the permanently deleted record can't be loaded, so only the id is sent
+	event, ok := core.changeFeedEvent(core.changes[0])
+	assert.True(t, ok)
+	assert.Equal(t, &ChangeFeedEvent{Action: outbox.ActionDeleted, ID: "2"}, event)
+
+	event, ok = core.changeFeedEvent(feedChange{Action: outbox.ActionUpdated, ID: "1"})
+	assert.True(t, ok)
+	assert.Equal(t, "kept", event.Data.(*hardDeleteModel).Name)
+	_, ok = core.changeFeedEvent(feedChange{Action: outbox.ActionUpdated, ID: "2", Tenant: "a"})
+	assert.False(t, ok)
+
+	// the deletes of the other tenants aren't sent
+	c, _ = newTenantContext("b")
+	_, ok = Core[hardDeleteModel](c).changeFeedEvent(feedChange{Action: outbox.ActionDeleted, ID: "2", Tenant: "a"})
+	assert.False(t, ok)
+}
@@ -0,0 +1,29 @@
+//go:build ignore
+
+// The generator of the OpenAPI document of the routes of the project. The document is built from the routes
+// registered by InitRouter, so copy this file into the project as cmd/openapi/generate.go, and initialize
+// the models and the routers in setup as the project does on booting, then run
+//
+//	go run cmd/openapi/generate.go -output ./openapi.json
+package main
+
+import (
+	"log"
+
+	"github.com/uozi-tech/cosy/openapi"
+)
+
+// setup registers the models and the routes of the project, e.g.
+//
+//	model.RegisterModels(query.Models()...)
+//	cosyRouter.Init()
+//	router.InitRouter()
+func setup() {
+}
+
+func main() {
+	setup()
+	if err := openapi.Generate(); err != nil {
+		log.Fatalln("[Error]", err)
+	}
+}
@@ -10,4 +10,10 @@ const (
 	OrFussy = "or_fussy"
 	Preload = "preload"
 	Between = "between"
+
+	Relation = "relation"
+	FullText = "fulltext"
+	JSON     = "json"
+
+	Filterable = "filterable"
 )
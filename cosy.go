@@ -2,7 +2,9 @@ package cosy
 
 import (
 	"strings"
+	"time"
 
+	"github.com/bsm/redislock"
 	"github.com/elliotchance/orderedmap/v3"
 	"github.com/gin-gonic/gin"
 	"github.com/spf13/cast"
@@ -22,6 +24,8 @@ type Ctx[T any] struct {
 	Tx          *gorm.DB
 	nextHandler *gin.HandlerFunc
 	listService *ListService[T]
+	fieldset    *fieldset
+	cacheLock   *redislock.Lock
 
 	// Function pointers
 	scan            func(tx *gorm.DB) any
@@ -30,6 +34,10 @@ type Ctx[T any] struct {
 
 	// Fixed-size and map headers
 	ID                      model.IDType
+	cacheTTL                time.Duration
+	batchCreateSize         int
+	exportLimit             int
+	importLimit             int
 	rules                   gin.H
 	Payload                 map[string]any
 	selectedFields          map[string]bool
@@ -37,12 +45,17 @@ type Ctx[T any] struct {
 	columnWhiteList         map[string]bool
 	columnMapping           map[string]string
 
-	// Strings (16B) grouped
-	table   string
-	itemKey string
+	// Strings and interfaces (16B) grouped
+	table          string
+	itemKey        string
+	exportFilename string
+	tenant         any
+	cacheEntryKey  string
 
 	// Slice headers (24B) grouped
 	BatchEffectedIDs      []string
+	BatchPayload          []map[string]any
+	BatchModels           []T
 	tableArgs             []any
 	prepareHookFunc       []func(ctx *Ctx[T])
 	beforeDecodeHookFunc  []func(ctx *Ctx[T])
@@ -52,12 +65,19 @@ type Ctx[T any] struct {
 	preloads              []string
 	joins                 []string
 	unique                []string
+	roles                 []string
+	changes               []feedChange
 
 	// Packed bools at the end to avoid repeated padding
 	useTransaction           bool
 	abort                    bool
 	skipAssociationsOnCreate bool
 	permanentlyDelete        bool
+	history                  bool
+	outbox                   bool
+	changeFeed               bool
+	withoutTenant            bool
+	rolesResolved            bool
 }
 
 func Core[T any](c *gin.Context) *Ctx[T] {
@@ -215,7 +235,19 @@ func (c *Ctx[T]) WithoutSortOrder() *Ctx[T] {
 
 // WithTransaction use transaction for "create" and "update"
 func (c *Ctx[T]) WithTransaction() *Ctx[T] {
+	// the transaction has been begun, e.g. by both Curd and the hooks
+	if c.useTransaction {
+		return c
+	}
 	c.useTransaction = true
 	c.Tx = c.Tx.Begin()
 	return c
 }
+
+// transaction runs fn in the transaction of WithTransaction if it's used, otherwise in a new transaction
+func (c *Ctx[T]) transaction(fn func(tx *gorm.DB) error) error {
+	if c.useTransaction {
+		return fn(c.Tx)
+	}
+	return c.Tx.Transaction(fn)
+}
@@ -3,7 +3,9 @@ package cosy
 import (
 	"net/http"
 
+	"github.com/uozi-tech/cosy/history"
 	"github.com/uozi-tech/cosy/map2struct"
+	"github.com/uozi-tech/cosy/outbox"
 	"gorm.io/gorm/clause"
 )
 
@@ -28,9 +30,17 @@ func (c *Ctx[T]) Create() {
 				ctx.AbortWithError(err)
 				return
 			}
+			if err = c.setTenant(&c.Model); err != nil {
+				ctx.AbortWithError(err)
+				return
+			}
 		}).
 		SetBeforeExecute(beforeExecuteHook).
 		SetGormAction(func(ctx *Ctx[T]) {
+			c.setTreePath(&c.Model)
+			if c.abort {
+				return
+			}
 			var err error
 			if c.skipAssociationsOnCreate {
 				err = c.Tx.Omit(clause.Associations).Create(&c.Model).Error
@@ -45,13 +55,16 @@ func (c *Ctx[T]) Create() {
 			tx = c.resolvePreload(tx)
 			tx = c.resolveJoins(tx)
 			tx.Table(c.table, c.tableArgs...).First(&c.Model)
+
+			c.recordHistory(history.ActionCreate, c.primaryKeyOf(&c.Model), nil, &c.Model)
+			c.recordEvent(outbox.ActionCreated, c.primaryKeyOf(&c.Model), &c.Model)
 		}).
 		SetExecuted(executedHook).
 		SetResponse(func(ctx *Ctx[T]) {
 			if c.nextHandler != nil {
 				(*c.nextHandler)(c.Context)
 			} else {
-				c.JSON(http.StatusOK, c.Model)
+				c.JSON(http.StatusOK, c.pruneWithFieldset(c.Model))
 			}
 		}).CreateOrModify()
 }
@@ -0,0 +1,317 @@
+package cosy
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"reflect"
+
+	"github.com/gin-gonic/gin"
+	"github.com/uozi-tech/cosy/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// ErrCursorNullableSort is responded with 400 when the list is paged by the cursor and sorted by a nullable column,
+// the rows with null values can't be located by the keyset comparison
+var ErrCursorNullableSort = &Error{
+	Code:    http.StatusBadRequest,
+	Message: "the nullable column can't be used to sort the cursor paging list",
+}
+
+// cursorToken is the decoded form of the opaque cursor returned to clients
+type cursorToken struct {
+	SortValue json.RawMessage `json:"s,omitempty"`
+	KeyValue  json.RawMessage `json:"k"`
+	Backward  bool            `json:"b,omitempty"`
+}
+
+// keyset describes the columns and direction used by cursor pagination
+type keyset struct {
+	sortBy    string
+	itemKey   string
+	desc      bool
+	sortField *schema.Field
+	keyField  *schema.Field
+}
+
+// keysetBoundary is the (sort value, item key value) pair of a single row
+type keysetBoundary struct {
+	sortValue any
+	keyValue  any
+}
+
+// WithCursorPagination use cursor (keyset) pagination for "get list",
+// the total count query will be skipped
+func (c *Ctx[T]) WithCursorPagination() *Ctx[T] {
+	c.listService.cursorPagination = true
+	return c
+}
+
+func (c *Ctx[T]) resolveKeyset() *keyset {
+	sortBy, order, ok := c.resolveSortBy()
+	if !ok {
+		sortBy, order = c.itemKey, "desc"
+		if o := c.Query("order"); o == "asc" {
+			order = o
+		}
+	}
+
+	ks := &keyset{
+		sortBy:  sortBy,
+		itemKey: c.itemKey,
+		desc:    order == "desc",
+	}
+
+	if s := c.schema(); s != nil {
+		ks.sortField = s.FieldsByDBName[sortBy]
+		ks.keyField = s.FieldsByDBName[c.itemKey]
+	}
+
+	return ks
+}
+
+// single reports whether the sort column is the item key itself
+func (k *keyset) single() bool {
+	return k.sortBy == k.itemKey
+}
+
+// nullable reports whether the sort column may be null, i.e. a pointer or a struct with the Valid flag,
+// e.g. *time.Time, sql.NullTime and gorm.DeletedAt
+func (k *keyset) nullable() bool {
+	if k.single() || k.sortField == nil {
+		return false
+	}
+	t := k.sortField.FieldType
+	if t.Kind() == reflect.Pointer {
+		return true
+	}
+	if t.Kind() == reflect.Struct {
+		valid, ok := t.FieldByName("Valid")
+		return ok && valid.Type.Kind() == reflect.Bool
+	}
+	return false
+}
+
+// orderBy returns the order clause of the keyset, reversed for backward paging
+func (k *keyset) orderBy(reverse bool) clause.OrderBy {
+	desc := k.desc != reverse
+	columns := []clause.OrderByColumn{
+		{Column: clause.Column{Table: clause.CurrentTable, Name: k.sortBy}, Desc: desc},
+	}
+	if !k.single() {
+		columns = append(columns, clause.OrderByColumn{
+			Column: clause.Column{Table: clause.CurrentTable, Name: k.itemKey}, Desc: desc,
+		})
+	}
+	return clause.OrderBy{Columns: columns}
+}
+
+// after builds the condition of rows located strictly after (or, with reverse, before) the boundary,
+// inclusive keeps the boundary row itself
+func (k *keyset) after(b *keysetBoundary, reverse bool, inclusive bool) clause.Expression {
+	sortCol := clause.Column{Table: clause.CurrentTable, Name: k.sortBy}
+	keyCol := clause.Column{Table: clause.CurrentTable, Name: k.itemKey}
+
+	greater := k.desc == reverse
+	compare := func(col clause.Column, value any, orEqual bool) clause.Expression {
+		switch {
+		case greater && orEqual:
+			return clause.Gte{Column: col, Value: value}
+		case greater:
+			return clause.Gt{Column: col, Value: value}
+		case orEqual:
+			return clause.Lte{Column: col, Value: value}
+		default:
+			return clause.Lt{Column: col, Value: value}
+		}
+	}
+
+	if k.single() {
+		return compare(keyCol, b.keyValue, inclusive)
+	}
+
+	return clause.Or(
+		compare(sortCol, b.sortValue, false),
+		clause.And(
+			clause.Eq{Column: sortCol, Value: b.sortValue},
+			compare(keyCol, b.keyValue, inclusive),
+		),
+	)
+}
+
+// encode encodes the boundary into an opaque cursor
+func (k *keyset) encode(b *keysetBoundary, backward bool) string {
+	var token cursorToken
+	var err error
+
+	token.Backward = backward
+	token.KeyValue, err = json.Marshal(b.keyValue)
+	if err != nil {
+		return ""
+	}
+	if !k.single() {
+		token.SortValue, err = json.Marshal(b.sortValue)
+		if err != nil {
+			return ""
+		}
+	}
+
+	buf, err := json.Marshal(token)
+	if err != nil {
+		return ""
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+// decode decodes an opaque cursor into a boundary typed after the model fields
+func (k *keyset) decode(cursor string) (b *keysetBoundary, backward bool, err error) {
+	buf, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return
+	}
+
+	var token cursorToken
+	if err = json.Unmarshal(buf, &token); err != nil {
+		return
+	}
+
+	b = &keysetBoundary{}
+	if b.keyValue, err = decodeCursorValue(token.KeyValue, k.keyField); err != nil {
+		return
+	}
+	if !k.single() {
+		if b.sortValue, err = decodeCursorValue(token.SortValue, k.sortField); err != nil {
+			return
+		}
+	}
+
+	return b, token.Backward, nil
+}
+
+// decodeCursorValue decodes a cursor value into the go type of the field,
+// so that the database driver receives the same type it returned
+func decodeCursorValue(raw json.RawMessage, field *schema.Field) (any, error) {
+	if field == nil {
+		var value any
+		err := json.Unmarshal(raw, &value)
+		return value, err
+	}
+
+	ptr := reflect.New(field.FieldType)
+	if err := json.Unmarshal(raw, ptr.Interface()); err != nil {
+		return nil, err
+	}
+
+	return ptr.Elem().Interface(), nil
+}
+
+// boundaries fetches the keyset values of at most limit rows
+func (k *keyset) boundaries(db *gorm.DB, limit int) (result []*keysetBoundary, err error) {
+	rows, err := db.Select("?, ?",
+		clause.Column{Table: clause.CurrentTable, Name: k.sortBy},
+		clause.Column{Table: clause.CurrentTable, Name: k.itemKey},
+	).Limit(limit).Rows()
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		sortPtr := newCursorValue(k.sortField)
+		keyPtr := newCursorValue(k.keyField)
+		if err = rows.Scan(sortPtr.Interface(), keyPtr.Interface()); err != nil {
+			return
+		}
+		result = append(result, &keysetBoundary{
+			sortValue: sortPtr.Elem().Interface(),
+			keyValue:  keyPtr.Elem().Interface(),
+		})
+	}
+
+	return result, rows.Err()
+}
+
+func newCursorValue(field *schema.Field) reflect.Value {
+	if field == nil {
+		var value any
+		return reflect.ValueOf(&value)
+	}
+	return reflect.New(field.FieldType)
+}
+
+// cursorPagingListData return cursor paging list data
+func (c *Ctx[T]) cursorPagingListData(result *gorm.DB) *model.DataList {
+	_, _, pageSize := GetPagingParams(c.Context)
+	ks := c.resolveKeyset()
+	if ks.nullable() {
+		c.JSON(http.StatusBadRequest, ErrCursorNullableSort)
+		c.Abort()
+		return &model.DataList{}
+	}
+
+	var boundary *keysetBoundary
+	var backward bool
+	if cursor := c.Query("cursor"); cursor != "" {
+		var err error
+		boundary, backward, err = ks.decode(cursor)
+		if err != nil {
+			c.JSON(http.StatusNotAcceptable, NewValidateError(gin.H{
+				"cursor": "invalid",
+			}))
+			c.Abort()
+			return &model.DataList{}
+		}
+	}
+
+	scoped := result.Session(&gorm.Session{})
+	if boundary != nil {
+		scoped = scoped.Where(ks.after(boundary, backward, false)).Session(&gorm.Session{})
+	}
+
+	// one more row than the page size tells whether another page exists
+	keys, err := ks.boundaries(scoped.Clauses(ks.orderBy(backward)), pageSize+1)
+	if err != nil {
+		c.AbortWithError(err)
+		return &model.DataList{}
+	}
+
+	hasMore := len(keys) > pageSize
+	if hasMore {
+		keys = keys[:pageSize]
+	}
+
+	data := &model.DataList{}
+	if len(keys) == 0 {
+		data.Data = c.resolveData(scoped.Clauses(ks.orderBy(false)).Limit(pageSize))
+		return data
+	}
+
+	first, last := keys[0], keys[len(keys)-1]
+	query := scoped
+	if backward {
+		// the keys were fetched in reverse order, so the page starts at the last one
+		first, last = last, first
+		query = query.Where(ks.after(first, false, true))
+	}
+
+	data.Data = c.resolveData(query.Clauses(ks.orderBy(false)).Limit(pageSize))
+
+	if backward {
+		data.NextCursor = ks.encode(last, false)
+		if hasMore {
+			data.PrevCursor = ks.encode(first, true)
+		}
+	} else {
+		if hasMore {
+			data.NextCursor = ks.encode(last, false)
+		}
+		if boundary != nil {
+			data.PrevCursor = ks.encode(first, true)
+		}
+	}
+
+	return data
+}
@@ -0,0 +1,69 @@
+package cosy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uozi-tech/cosy/model"
+)
+
+func TestKeysetCursorRoundTrip(t *testing.T) {
+	s := (&Ctx[User]{}).schema()
+	if !assert.NotNil(t, s) {
+		return
+	}
+
+	ks := &keyset{
+		sortBy:    "employed_at",
+		itemKey:   "id",
+		desc:      true,
+		sortField: s.FieldsByDBName["employed_at"],
+		keyField:  s.FieldsByDBName["id"],
+	}
+
+	employedAt := time.Date(2024, 3, 13, 11, 22, 44, 0, time.UTC)
+	var id model.IDType
+	cursor := ks.encode(&keysetBoundary{sortValue: &employedAt, keyValue: id}, true)
+	assert.NotEmpty(t, cursor)
+
+	b, backward, err := ks.decode(cursor)
+	assert.NoError(t, err)
+	assert.True(t, backward)
+	decoded, ok := b.sortValue.(*time.Time)
+	if assert.True(t, ok) {
+		assert.True(t, employedAt.Equal(*decoded))
+	}
+	assert.Equal(t, id, b.keyValue)
+
+	_, _, err = ks.decode("not-a-cursor")
+	assert.Error(t, err)
+}
+
+func TestKeysetSingleColumnCursor(t *testing.T) {
+	ks := &keyset{sortBy: "id", itemKey: "id"}
+	assert.True(t, ks.single())
+	assert.Len(t, ks.orderBy(false).Columns, 1)
+
+	cursor := ks.encode(&keysetBoundary{keyValue: "42"}, false)
+	b, backward, err := ks.decode(cursor)
+	assert.NoError(t, err)
+	assert.False(t, backward)
+	assert.Equal(t, "42", b.keyValue)
+}
+
+func TestKeysetNullableSortColumn(t *testing.T) {
+	s := (&Ctx[User]{}).schema()
+	if !assert.NotNil(t, s) {
+		return
+	}
+
+	ks := &keyset{sortBy: "employed_at", itemKey: "id", sortField: s.FieldsByDBName["employed_at"]}
+	assert.True(t, ks.nullable())
+
+	ks = &keyset{sortBy: "age", itemKey: "id", sortField: s.FieldsByDBName["age"]}
+	assert.False(t, ks.nullable())
+
+	ks = &keyset{sortBy: "id", itemKey: "id", sortField: s.FieldsByDBName["id"]}
+	assert.False(t, ks.nullable())
+}
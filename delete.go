@@ -4,7 +4,9 @@ import (
 	"net/http"
 
 	"github.com/spf13/cast"
+	"github.com/uozi-tech/cosy/history"
 	"github.com/uozi-tech/cosy/model"
+	"github.com/uozi-tech/cosy/outbox"
 	"gorm.io/gorm"
 )
 
@@ -21,7 +23,7 @@ func (c *Ctx[T]) Destroy() {
 				c.Tx = c.Tx.Unscoped()
 			}
 			var err error
-			session := c.Tx.Session(&gorm.Session{})
+			session := c.scopePolicy(c.scopeTenant(c.Tx.Session(&gorm.Session{})))
 			if c.table != "" {
 				err = session.Table(c.table, c.tableArgs...).Take(c.OriginModel, c.ID).Error
 			} else {
@@ -32,12 +34,38 @@ func (c *Ctx[T]) Destroy() {
 				ctx.AbortWithError(err)
 				return
 			}
+			c.checkPolicy(&c.OriginModel, Policy[T].CanDelete)
+			if c.abort {
+				return
+			}
 			prepareHook(ctx)
 		}).
 		SetBeforeExecute(beforeExecuteHook).
 		SetGormAction(func(ctx *Ctx[T]) {
 			ctx.Tx = ctx.applyGormScopes(ctx.Tx)
-			err := ctx.Tx.Delete(&c.OriginModel).Error
+			// Delete may set the deleted_at of the model
+			origin := c.OriginModel
+			destroy := func(tx *gorm.DB) error {
+				// the children are resolved by the path of the node before it's deleted
+				if err := c.deleteTreeChildren(tx, c.ID); err != nil {
+					return err
+				}
+				if err := tx.Delete(&c.OriginModel).Error; err != nil {
+					return err
+				}
+				if err := c.writeHistory(tx, history.ActionDelete, c.ID, &origin, nil); err != nil {
+					return err
+				}
+				return c.writeEvent(tx, outbox.ActionDeleted, c.ID, &origin)
+			}
+
+			var err error
+			// the children of the tree node are deleted with the node in a transaction
+			if isTree[T]() {
+				err = c.transaction(destroy)
+			} else {
+				err = destroy(ctx.Tx)
+			}
 			if err != nil {
 				ctx.AbortWithError(err)
 				return
@@ -54,8 +82,7 @@ func (c *Ctx[T]) Recover() {
 	NewProcessChain(c).
 		SetPrepare(func(ctx *Ctx[T]) {
 			ctx.ID = ctx.GetParamID()
-			c.Tx = c.Tx.Unscoped()
-			c.applyGormScopes(c.Tx)
+			c.Tx = c.applyGormScopes(c.Tx.Unscoped())
 
 			var err error
 			session := c.Tx.Session(&gorm.Session{})
@@ -69,11 +96,17 @@ func (c *Ctx[T]) Recover() {
 				ctx.AbortWithError(err)
 				return
 			}
+			c.checkPolicy(&c.Model, Policy[T].CanDelete)
+			if c.abort {
+				return
+			}
 			prepareHook(ctx)
 		}).
 		SetBeforeExecute(beforeExecuteHook).
 		SetGormAction(func(ctx *Ctx[T]) {
 			var err error
+			// Update may set the deleted_at of the model
+			origin := c.Model
 			resolvedModel := model.GetResolvedModel[T]()
 			if deletedAt, ok := resolvedModel.Fields["DeletedAt"]; !ok ||
 				(deletedAt.DefaultValue == "" || deletedAt.DefaultValue == "null") {
@@ -86,6 +119,20 @@ func (c *Ctx[T]) Recover() {
 				ctx.AbortWithError(err)
 				return
 			}
+
+			if c.history || c.outbox || c.changeFeed {
+				var recovered T
+				session := c.Tx.Session(&gorm.Session{NewDB: true})
+				if c.table != "" {
+					session = session.Table(c.table, c.tableArgs...)
+				}
+				if err = session.First(&recovered, "id = ?", c.ID).Error; err != nil {
+					ctx.AbortWithError(err)
+					return
+				}
+				c.recordHistory(history.ActionRecover, c.ID, &origin, &recovered)
+				c.recordEvent(outbox.ActionRecovered, c.ID, &recovered)
+			}
 		}).
 		SetExecuted(executedHook).
 		SetResponse(func(ctx *Ctx[T]) {
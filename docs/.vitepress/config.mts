@@ -88,14 +88,30 @@ export default defineConfig({
           { text: '模型定义', link: '/api-level/define-model' },
           { text: '单个记录', link: '/api-level/item' },
           { text: '列表', link: '/api-level/list' },
+          { text: '聚合统计', link: '/api-level/aggregate' },
+          { text: '导出', link: '/api-level/export' },
+          { text: '导入', link: '/api-level/import' },
           { text: '创建', link: '/api-level/create' },
+          { text: '批量创建', link: '/api-level/batch-create' },
           { text: '修改', link: '/api-level/update' },
+          { text: '创建或更新', link: '/api-level/upsert' },
           { text: '批量修改', link: '/api-level/batch-update' },
           { text: '删除', link: '/api-level/delete' },
           { text: '恢复', link: '/api-level/recover' },
           { text: '批量删除', link: '/api-level/batch-delete' },
           { text: '批量恢复', link: '/api-level/batch-recover' },
+          { text: '回收站清理', link: '/api-level/trash-retention' },
+          { text: '树形结构', link: '/api-level/tree' },
+          { text: '变更历史', link: '/api-level/history' },
+          { text: '多租户', link: '/api-level/tenant' },
+          { text: '访问策略', link: '/api-level/policy' },
+          { text: '字段权限', link: '/api-level/field-permission' },
+          { text: '响应缓存', link: '/api-level/cache' },
+          { text: '幂等请求', link: '/api-level/idempotency' },
+          { text: '领域事件', link: '/api-level/outbox' },
+          { text: '变更推送', link: '/api-level/change-feed' },
           { text: '自定义', link: '/api-level/custom' },
+          { text: 'OpenAPI 文档', link: '/api-level/openapi' },
         ]
       },
       {
@@ -162,6 +178,12 @@ export default defineConfig({
           { text: '接口参考', link: '/queue' },
         ]
       },
+      {
+        text: 'Webhook',
+        items: [
+          { text: '接口参考', link: '/webhook' },
+        ]
+      },
       {
         text: '数据库迁移',
         items: [
@@ -0,0 +1,248 @@
+package cosy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/uozi-tech/cosy/export"
+	"github.com/uozi-tech/cosy/logger"
+	"github.com/uozi-tech/cosy/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// DefaultExportLimit is the default maximum count of rows of an export
+const DefaultExportLimit = 10000
+
+// exportBatchSize is the count of rows read from the database in a query of the export
+const exportBatchSize = 500
+
+// exportColumn is a column of the export, Key is the json key of the value
+type exportColumn struct {
+	Key   string
+	Title string
+}
+
+// SetExportLimit sets the maximum count of rows of the export, negative means no limit
+func (c *Ctx[T]) SetExportLimit(limit int) *Ctx[T] {
+	c.exportLimit = limit
+	return c
+}
+
+// SetExportFilename sets the filename of the export without extension, it's the table name by default
+func (c *Ctx[T]) SetExportFilename(filename string) *Ctx[T] {
+	c.exportFilename = filename
+	return c
+}
+
+// exportColumns returns the columns of the export, the fields marked with cosy:"export" are exported
+// if any, otherwise all the fields with a json key are exported except the associations,
+// the columns follow the order of the fields
+func exportColumns[T any](s *schema.Schema) (columns []exportColumn) {
+	resolved := model.GetResolvedModel[T]()
+	if resolved == nil {
+		return
+	}
+
+	var tagged []exportColumn
+	for _, field := range resolved.OrderedFields {
+		if field.JsonTag == "" || field.JsonTag == "-" {
+			continue
+		}
+
+		title, ok := field.CosyTag.GetExport()
+		if title == "" {
+			title = field.JsonTag
+		}
+		column := exportColumn{Key: field.JsonTag, Title: title}
+		if ok {
+			tagged = append(tagged, column)
+			continue
+		}
+		if s != nil && s.Relationships.Relations[field.Name] != nil {
+			continue
+		}
+		columns = append(columns, column)
+	}
+
+	if len(tagged) > 0 {
+		return tagged
+	}
+	return
+}
+
+// exportRow returns the values of the columns, the row is encoded as JSON first,
+// so that the values of the transformer are resolved by the json keys as well
+func exportRow(row any, columns []exportColumn) ([]any, error) {
+	b, err := json.Marshal(row)
+	if err != nil {
+		return nil, err
+	}
+
+	m := make(map[string]any)
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	if err = decoder.Decode(&m); err != nil {
+		return nil, err
+	}
+
+	values := make([]any, len(columns))
+	for i, column := range columns {
+		values[i] = m[column.Key]
+	}
+	return values, nil
+}
+
+// contentDisposition returns the Content-Disposition header of an attachment,
+// the ascii fallback is provided for the clients that don't support RFC 5987
+func contentDisposition(filename string) string {
+	fallback := strings.Map(func(r rune) rune {
+		if r > 0x7e || r < 0x20 || r == '"' || r == '\\' {
+			return '_'
+		}
+		return r
+	}, filename)
+	return fmt.Sprintf(`attachment; filename="%s"; filename*=UTF-8''%s`, fallback, url.PathEscape(filename))
+}
+
+// exportAttachmentName returns the filename of the export with the extension
+func (c *Ctx[T]) exportAttachmentName(format export.Format) string {
+	filename := c.exportFilename
+	if filename == "" {
+		if s := c.schema(); s != nil {
+			filename = s.Table
+		}
+	}
+	if filename == "" {
+		filename = "export"
+	}
+	return filename + "." + string(format)
+}
+
+// Export streams the list data as a csv or xlsx file, the filters, scopes, preloads, joins and transformer
+// of the list are applied, the rows are read from the database in batches
+func (c *Ctx[T]) Export(format export.Format) {
+	var (
+		rows  *gorm.DB
+		limit int
+	)
+	NewProcessChain(c).
+		SetPrepare(func(ctx *Ctx[T]) {
+			if format != export.CSV && format != export.XLSX {
+				c.JSON(http.StatusNotAcceptable, NewValidateError(gin.H{
+					"format": "oneof=csv xlsx",
+				}))
+				c.Abort()
+				return
+			}
+			c.prepareListHook(ctx)
+		}).
+		SetBeforeExecute(beforeExecuteHook[T]).
+		SetGormAction(func(ctx *Ctx[T]) {
+			rows = c.result()
+			limit = c.exportLimit
+			if limit == 0 {
+				limit = DefaultExportLimit
+			}
+		}).
+		SetExecuted(executedHook[T]).
+		SetResponse(func(ctx *Ctx[T]) {
+			c.streamExport(rows, format, limit)
+		}).
+		GetOrGetList()
+}
+
+// exportBatch reads a batch of the rows from the offset, the size is cut by the limit, negative means no limit
+func exportBatch[T any](tx *gorm.DB, offset int, limit int) (records []*T, size int, err error) {
+	size = exportBatchSize
+	if limit > 0 {
+		size = min(size, limit-offset)
+	}
+	if size <= 0 {
+		return
+	}
+	records = make([]*T, 0, size)
+	err = tx.Offset(offset).Limit(size).Find(&records).Error
+	return
+}
+
+// streamExport writes the header and the rows to the response, the rows are read in batches by Find,
+// so that the preloads of the list are applied
+func (c *Ctx[T]) streamExport(tx *gorm.DB, format export.Format, limit int) {
+	if tx == nil {
+		return
+	}
+	tx = tx.Session(&gorm.Session{})
+
+	// the first batch is read before the status is sent, so that the error can be responded
+	records, size, err := exportBatch[T](tx, 0, limit)
+	if err != nil {
+		c.AbortWithError(err)
+		return
+	}
+
+	unreadable := c.unreadableKeys()
+	columns := slices.DeleteFunc(exportColumns[T](c.schema()), func(column exportColumn) bool {
+		return unreadable[column.Key]
+	})
+
+	c.Header("Content-Type", export.ContentType(format))
+	c.Header("Content-Disposition", contentDisposition(c.exportAttachmentName(format)))
+	c.Status(http.StatusOK)
+
+	// the status has been sent once the body is written, so errors can only be logged
+	w, err := export.NewWriter(format, c.Writer)
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	defer func() {
+		if err := w.Close(); err != nil {
+			logger.Error(err)
+		}
+	}()
+
+	header := make([]any, len(columns))
+	for i, column := range columns {
+		header[i] = column.Title
+	}
+	if err = w.WriteRow(header); err != nil {
+		logger.Error(err)
+		return
+	}
+
+	offset := 0
+	for {
+		for _, record := range records {
+			var row any = record
+			if c.transformer != nil {
+				row = c.transformer(record)
+			}
+
+			values, err := exportRow(row, columns)
+			if err != nil {
+				logger.Error(err)
+				return
+			}
+			if err = w.WriteRow(values); err != nil {
+				logger.Error(err)
+				return
+			}
+		}
+
+		offset += len(records)
+		if len(records) == 0 || len(records) < size {
+			return
+		}
+		if records, size, err = exportBatch[T](tx, offset, limit); err != nil {
+			logger.Error(err)
+			return
+		}
+	}
+}
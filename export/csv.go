@@ -0,0 +1,54 @@
+package export
+
+import (
+	"encoding/csv"
+	"io"
+	"strings"
+)
+
+// utf8BOM makes Excel open the csv file as UTF-8
+const utf8BOM = "\ufeff"
+
+type csvWriter struct {
+	w       io.Writer
+	csv     *csv.Writer
+	started bool
+	record  []string
+}
+
+// NewCSVWriter returns a Writer of csv format
+func NewCSVWriter(w io.Writer) Writer {
+	return &csvWriter{w: w, csv: csv.NewWriter(w)}
+}
+
+func (w *csvWriter) WriteRow(values []any) error {
+	if !w.started {
+		w.started = true
+		if _, err := io.WriteString(w.w, utf8BOM); err != nil {
+			return err
+		}
+	}
+
+	w.record = w.record[:0]
+	for _, value := range values {
+		text := Stringify(value)
+		if _, ok := value.(string); ok {
+			text = escapeFormula(text)
+		}
+		w.record = append(w.record, text)
+	}
+	return w.csv.Write(w.record)
+}
+
+func (w *csvWriter) Close() error {
+	w.csv.Flush()
+	return w.csv.Error()
+}
+
+// escapeFormula prevents the text from being evaluated as a formula by spreadsheet applications
+func escapeFormula(text string) string {
+	if text != "" && strings.ContainsRune("=+-@\t\r", rune(text[0])) {
+		return "'" + text
+	}
+	return text
+}
@@ -0,0 +1,68 @@
+package export
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/spf13/cast"
+)
+
+// Format is the file format of the export
+type Format string
+
+const (
+	CSV  Format = "csv"
+	XLSX Format = "xlsx"
+)
+
+// ErrUnsupportedFormat is returned when the format is neither csv nor xlsx
+var ErrUnsupportedFormat = errors.New("unsupported export format")
+
+// Writer writes the rows of the export one by one, Close must be called to flush the file
+type Writer interface {
+	WriteRow(values []any) error
+	Close() error
+}
+
+// NewWriter returns a Writer of the format which writes to w
+func NewWriter(format Format, w io.Writer) (Writer, error) {
+	switch format {
+	case CSV:
+		return NewCSVWriter(w), nil
+	case XLSX:
+		return NewXLSXWriter(w)
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedFormat, format)
+}
+
+// ContentType returns the MIME type of the format
+func ContentType(format Format) string {
+	switch format {
+	case CSV:
+		return "text/csv; charset=utf-8"
+	case XLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	}
+	return "application/octet-stream"
+}
+
+// Stringify returns the text of a cell, objects and arrays are encoded as JSON
+func Stringify(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case map[string]any, []any:
+		b, err := json.Marshal(v)
+		if err != nil {
+			return ""
+		}
+		return string(b)
+	}
+	return cast.ToString(value)
+}
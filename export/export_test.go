@@ -0,0 +1,165 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCSVWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(CSV, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NoError(t, w.WriteRow([]any{"编码", "名称", "数量"}))
+	assert.NoError(t, w.WriteRow([]any{"A1", "=SUM(A1:A2)", json.Number("-3")}))
+	assert.NoError(t, w.WriteRow([]any{nil, `b, "q"`, map[string]any{"a": 1}}))
+	assert.NoError(t, w.Close())
+
+	assert.Equal(t, "\ufeff编码,名称,数量\nA1,'=SUM(A1:A2),-3\n,\"b, \"\"q\"\"\",\"{\"\"a\"\":1}\"\n", buf.String())
+}
+
+func TestXLSXWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewWriter(XLSX, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.NoError(t, w.WriteRow([]any{"name", "count", "id", "enabled"}))
+	assert.NoError(t, w.WriteRow([]any{"<a&b>", json.Number("3.5"), json.Number("9007199254740993"), true}))
+	assert.NoError(t, w.Close())
+
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	var sheet []byte
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+		if f.Name != "xl/worksheets/sheet1.xml" {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		sheet, err = io.ReadAll(rc)
+		_ = rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	assert.Contains(t, names, "[Content_Types].xml")
+	assert.Contains(t, names, "xl/workbook.xml")
+	assert.Contains(t, string(sheet), `<c t="inlineStr"><is><t xml:space="preserve">&lt;a&amp;b&gt;</t></is></c>`)
+	assert.Contains(t, string(sheet), `<c><v>3.5</v></c>`)
+	// integers beyond the precision of spreadsheets are written as text
+	assert.Contains(t, string(sheet), `<t xml:space="preserve">9007199254740993</t>`)
+	assert.Contains(t, string(sheet), `<c t="b"><v>1</v></c>`)
+}
+
+func TestNewWriterUnsupported(t *testing.T) {
+	_, err := NewWriter("pdf", io.Discard)
+	assert.ErrorIs(t, err, ErrUnsupportedFormat)
+}
+
+func TestCSVReader(t *testing.T) {
+	r := NewCSVReader(bytes.NewBufferString("\ufeff编码,名称\nA1,\"b, \"\"q\"\"\"\n\n,\nB2\n"))
+
+	var numbers []int
+	var rows [][]string
+	for {
+		number, values, err := r.ReadRow()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		numbers = append(numbers, number)
+		rows = append(rows, values)
+	}
+
+	assert.Equal(t, []int{1, 2, 5}, numbers)
+	assert.Equal(t, [][]string{{"编码", "名称"}, {"A1", `b, "q"`}, {"B2"}}, rows)
+}
+
+func TestXLSXRoundTrip(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewXLSXWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NoError(t, w.WriteRow([]any{"name", "count", "enabled"}))
+	assert.NoError(t, w.WriteRow([]any{nil, nil, nil}))
+	assert.NoError(t, w.WriteRow([]any{"<a&b>", json.Number("3.5"), false}))
+	assert.NoError(t, w.Close())
+
+	r, err := NewReader(XLSX, bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	number, values, err := r.ReadRow()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, number)
+	assert.Equal(t, []string{"name", "count", "enabled"}, values)
+
+	number, values, err = r.ReadRow()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, number)
+	assert.Equal(t, []string{"<a&b>", "3.5", "false"}, values)
+
+	_, _, err = r.ReadRow()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestXLSXReaderSharedStrings(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	files := map[string]string{
+		"xl/workbook.xml": `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+			`<sheets><sheet name="数据" sheetId="1" r:id="rId3"/></sheets></workbook>`,
+		"xl/_rels/workbook.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+			`<Relationship Id="rId3" Type="worksheet" Target="worksheets/data.xml"/></Relationships>`,
+		"xl/sharedStrings.xml": `<sst xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+			`<si><t>code</t></si><si><t>name</t></si><si><r><t>Ja</t></r><r><t>cky</t></r></si></sst>`,
+		"xl/worksheets/data.xml": `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>` +
+			`<row r="1"><c r="A1" t="s"><v>0</v></c><c r="C1" t="s"><v>1</v></c></row>` +
+			`<row r="4"><c r="A4"><v>42</v></c><c r="C4" t="s"><v>2</v></c></row>` +
+			`</sheetData></worksheet>`,
+	}
+	for name, content := range files {
+		f, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = io.WriteString(f, content)
+	}
+	assert.NoError(t, zw.Close())
+
+	r, err := NewXLSXReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	number, values, err := r.ReadRow()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, number)
+	assert.Equal(t, []string{"code", "", "name"}, values)
+
+	number, values, err = r.ReadRow()
+	assert.NoError(t, err)
+	assert.Equal(t, 4, number)
+	assert.Equal(t, []string{"42", "", "Jacky"}, values)
+}
@@ -0,0 +1,69 @@
+package export
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Reader reads the rows of an imported file one by one, the number is the 1-based row number
+// of the file, empty rows are skipped, io.EOF is returned when there are no more rows
+type Reader interface {
+	ReadRow() (number int, values []string, err error)
+}
+
+// NewReader returns a Reader of the format which reads from r, size is the size of the file
+func NewReader(format Format, r io.ReaderAt, size int64) (Reader, error) {
+	switch format {
+	case CSV:
+		return NewCSVReader(io.NewSectionReader(r, 0, size)), nil
+	case XLSX:
+		return NewXLSXReader(r, size)
+	}
+	return nil, fmt.Errorf("%w: %s", ErrUnsupportedFormat, format)
+}
+
+type csvReader struct {
+	csv    *csv.Reader
+	number int
+}
+
+// NewCSVReader returns a Reader of csv format, the UTF-8 BOM is ignored
+func NewCSVReader(r io.Reader) Reader {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	return &csvReader{csv: reader}
+}
+
+func (r *csvReader) ReadRow() (number int, values []string, err error) {
+	for {
+		values, err = r.csv.Read()
+		if err != nil {
+			var parseErr *csv.ParseError
+			if errors.As(err, &parseErr) {
+				return parseErr.StartLine, nil, err
+			}
+			return 0, nil, err
+		}
+		number, _ = r.csv.FieldPos(0)
+		r.number++
+
+		if r.number == 1 && len(values) > 0 {
+			values[0] = strings.TrimPrefix(values[0], utf8BOM)
+		}
+		if !isEmptyRow(values) {
+			return number, values, nil
+		}
+	}
+}
+
+func isEmptyRow(values []string) bool {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return false
+		}
+	}
+	return true
+}
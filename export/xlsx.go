@@ -0,0 +1,148 @@
+package export
+
+import (
+	"archive/zip"
+	"bufio"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+
+	"github.com/spf13/cast"
+)
+
+// the parts of a workbook with a single sheet, the sheet itself is streamed
+var xlsxParts = []struct {
+	name    string
+	content string
+}{
+	{"[Content_Types].xml", xml.Header + `<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">` +
+		`<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>` +
+		`<Default Extension="xml" ContentType="application/xml"/>` +
+		`<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>` +
+		`<Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>` +
+		`<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>` +
+		`</Types>`},
+	{"_rels/.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>` +
+		`</Relationships>`},
+	{"xl/workbook.xml", xml.Header + `<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">` +
+		`<sheets><sheet name="Sheet1" sheetId="1" r:id="rId1"/></sheets>` +
+		`</workbook>`},
+	{"xl/_rels/workbook.xml.rels", xml.Header + `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` +
+		`<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/>` +
+		`<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>` +
+		`</Relationships>`},
+	{"xl/styles.xml", xml.Header + `<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+		`<fonts count="1"><font><sz val="11"/><name val="Calibri"/></font></fonts>` +
+		`<fills count="1"><fill><patternFill patternType="none"/></fill></fills>` +
+		`<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>` +
+		`<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>` +
+		`<cellXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/></cellXfs>` +
+		`</styleSheet>`},
+}
+
+const (
+	xlsxSheetHeader = xml.Header + `<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`
+	xlsxSheetFooter = `</sheetData></worksheet>`
+)
+
+type xlsxWriter struct {
+	zip   *zip.Writer
+	sheet *bufio.Writer
+}
+
+// NewXLSXWriter returns a Writer of xlsx format, the rows are written into a single sheet
+// with inline strings, so that nothing but the write buffer is kept in memory
+func NewXLSXWriter(w io.Writer) (Writer, error) {
+	zw := zip.NewWriter(w)
+	for _, part := range xlsxParts {
+		f, err := zw.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = io.WriteString(f, part.content); err != nil {
+			return nil, err
+		}
+	}
+
+	f, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	sheet := bufio.NewWriter(f)
+	if _, err = sheet.WriteString(xlsxSheetHeader); err != nil {
+		return nil, err
+	}
+
+	return &xlsxWriter{zip: zw, sheet: sheet}, nil
+}
+
+func (w *xlsxWriter) WriteRow(values []any) error {
+	_, _ = w.sheet.WriteString("<row>")
+	for _, value := range values {
+		w.writeCell(value)
+	}
+	_, err := w.sheet.WriteString("</row>")
+	return err
+}
+
+func (w *xlsxWriter) writeCell(value any) {
+	switch v := value.(type) {
+	case nil:
+		_, _ = w.sheet.WriteString("<c/>")
+		return
+	case bool:
+		_, _ = w.sheet.WriteString(`<c t="b"><v>`)
+		if v {
+			_ = w.sheet.WriteByte('1')
+		} else {
+			_ = w.sheet.WriteByte('0')
+		}
+		_, _ = w.sheet.WriteString("</v></c>")
+		return
+	case json.Number:
+		if f, err := v.Float64(); err == nil && isExactNumber(f) {
+			w.writeNumber(v.String())
+			return
+		}
+	default:
+		switch reflect.ValueOf(value).Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+			reflect.Float32, reflect.Float64:
+			if f := cast.ToFloat64(value); isExactNumber(f) {
+				w.writeNumber(strconv.FormatFloat(f, 'f', -1, 64))
+				return
+			}
+		}
+	}
+
+	_, _ = w.sheet.WriteString(`<c t="inlineStr"><is><t xml:space="preserve">`)
+	_ = xml.EscapeText(w.sheet, []byte(Stringify(value)))
+	_, _ = w.sheet.WriteString("</t></is></c>")
+}
+
+func (w *xlsxWriter) writeNumber(text string) {
+	_, _ = w.sheet.WriteString(`<c><v>`)
+	_, _ = w.sheet.WriteString(text)
+	_, _ = w.sheet.WriteString("</v></c>")
+}
+
+// isExactNumber reports whether the number can be stored in a spreadsheet without losing precision,
+// larger integers such as snowflake ids are written as text
+func isExactNumber(f float64) bool {
+	return !math.IsNaN(f) && !math.IsInf(f, 0) && math.Abs(f) < 1<<53
+}
+
+func (w *xlsxWriter) Close() error {
+	if _, err := w.sheet.WriteString(xlsxSheetFooter); err != nil {
+		return err
+	}
+	if err := w.sheet.Flush(); err != nil {
+		return err
+	}
+	return w.zip.Close()
+}
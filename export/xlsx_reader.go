@@ -0,0 +1,236 @@
+package export
+
+import (
+	"archive/zip"
+	"encoding/xml"
+	"errors"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidXLSX is returned when the file is not a valid xlsx workbook
+var ErrInvalidXLSX = errors.New("invalid xlsx file")
+
+type xlsxReader struct {
+	closer  io.Closer
+	decoder *xml.Decoder
+	shared  []string
+	number  int
+}
+
+// NewXLSXReader returns a Reader of xlsx format, only the first sheet is read.
+// The cells are read as the text stored in the file, e.g. dates are the serial numbers
+// unless the cells are formatted as text.
+func NewXLSXReader(r io.ReaderAt, size int64) (Reader, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, errors.Join(ErrInvalidXLSX, err)
+	}
+
+	files := make(map[string]*zip.File, len(zr.File))
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	shared, err := readSharedStrings(files["xl/sharedStrings.xml"])
+	if err != nil {
+		return nil, errors.Join(ErrInvalidXLSX, err)
+	}
+
+	sheet := files[firstSheetPath(files)]
+	if sheet == nil {
+		return nil, ErrInvalidXLSX
+	}
+	rc, err := sheet.Open()
+	if err != nil {
+		return nil, errors.Join(ErrInvalidXLSX, err)
+	}
+
+	return &xlsxReader{closer: rc, decoder: xml.NewDecoder(rc), shared: shared}, nil
+}
+
+// firstSheetPath resolves the path of the first sheet by the workbook and its relationships
+func firstSheetPath(files map[string]*zip.File) string {
+	const fallback = "xl/worksheets/sheet1.xml"
+
+	var workbook struct {
+		Sheets []struct {
+			ID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := decodeFile(files["xl/workbook.xml"], &workbook); err != nil || len(workbook.Sheets) == 0 {
+		return fallback
+	}
+
+	var rels struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := decodeFile(files["xl/_rels/workbook.xml.rels"], &rels); err != nil {
+		return fallback
+	}
+
+	for _, rel := range rels.Relationships {
+		if rel.ID != workbook.Sheets[0].ID {
+			continue
+		}
+		if strings.HasPrefix(rel.Target, "/") {
+			return strings.TrimPrefix(rel.Target, "/")
+		}
+		return path.Join("xl", rel.Target)
+	}
+	return fallback
+}
+
+func decodeFile(f *zip.File, v any) error {
+	if f == nil {
+		return ErrInvalidXLSX
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return xml.NewDecoder(rc).Decode(v)
+}
+
+// readSharedStrings reads the shared strings table, the runs of rich text are concatenated
+func readSharedStrings(f *zip.File) ([]string, error) {
+	if f == nil {
+		return nil, nil
+	}
+
+	var sst struct {
+		Items []struct {
+			Text string `xml:"t"`
+			Runs []struct {
+				Text string `xml:"t"`
+			} `xml:"r"`
+		} `xml:"si"`
+	}
+	if err := decodeFile(f, &sst); err != nil {
+		return nil, err
+	}
+
+	shared := make([]string, len(sst.Items))
+	for i, item := range sst.Items {
+		var sb strings.Builder
+		sb.WriteString(item.Text)
+		for _, run := range item.Runs {
+			sb.WriteString(run.Text)
+		}
+		shared[i] = sb.String()
+	}
+	return shared, nil
+}
+
+type xlsxCell struct {
+	Ref    string `xml:"r,attr"`
+	Type   string `xml:"t,attr"`
+	Value  string `xml:"v"`
+	Inline struct {
+		Text string `xml:"t"`
+		Runs []struct {
+			Text string `xml:"t"`
+		} `xml:"r"`
+	} `xml:"is"`
+}
+
+type xlsxRow struct {
+	Number int        `xml:"r,attr"`
+	Cells  []xlsxCell `xml:"c"`
+}
+
+func (r *xlsxReader) ReadRow() (number int, values []string, err error) {
+	for {
+		token, err := r.decoder.Token()
+		if err != nil {
+			_ = r.closer.Close()
+			if errors.Is(err, io.EOF) {
+				return 0, nil, io.EOF
+			}
+			return 0, nil, errors.Join(ErrInvalidXLSX, err)
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "row" {
+			continue
+		}
+
+		var row xlsxRow
+		if err = r.decoder.DecodeElement(&row, &start); err != nil {
+			_ = r.closer.Close()
+			return 0, nil, errors.Join(ErrInvalidXLSX, err)
+		}
+
+		r.number++
+		if row.Number == 0 {
+			row.Number = r.number
+		}
+		r.number = row.Number
+
+		values = r.rowValues(row)
+		if !isEmptyRow(values) {
+			return row.Number, values, nil
+		}
+	}
+}
+
+// rowValues returns the values of the cells, the missing cells are filled with empty strings
+func (r *xlsxReader) rowValues(row xlsxRow) (values []string) {
+	for _, cell := range row.Cells {
+		index := len(values)
+		if cell.Ref != "" {
+			index = columnIndex(cell.Ref)
+		}
+		for len(values) < index {
+			values = append(values, "")
+		}
+		if index < len(values) {
+			values[index] = r.cellValue(cell)
+			continue
+		}
+		values = append(values, r.cellValue(cell))
+	}
+	return
+}
+
+func (r *xlsxReader) cellValue(cell xlsxCell) string {
+	switch cell.Type {
+	case "s":
+		i, err := strconv.Atoi(strings.TrimSpace(cell.Value))
+		if err != nil || i < 0 || i >= len(r.shared) {
+			return ""
+		}
+		return r.shared[i]
+	case "inlineStr":
+		var sb strings.Builder
+		sb.WriteString(cell.Inline.Text)
+		for _, run := range cell.Inline.Runs {
+			sb.WriteString(run.Text)
+		}
+		return sb.String()
+	case "b":
+		if strings.TrimSpace(cell.Value) == "1" {
+			return "true"
+		}
+		return "false"
+	}
+	return cell.Value
+}
+
+// columnIndex returns the 0-based column index of a cell reference, e.g. "B3" -> 1
+func columnIndex(ref string) int {
+	index := 0
+	for _, ch := range ref {
+		if ch < 'A' || ch > 'Z' {
+			break
+		}
+		index = index*26 + int(ch-'A'+1)
+	}
+	return index - 1
+}
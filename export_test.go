@@ -0,0 +1,116 @@
+package cosy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/uozi-tech/cosy/export"
+	"github.com/uozi-tech/cosy/logger"
+	"github.com/uozi-tech/cosy/model"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm/schema"
+)
+
+type exportModel struct {
+	model.Model
+	Code     string  `json:"code" cosy:"export:编码"`
+	Name     string  `json:"name" cosy:"export"`
+	Password string  `json:"-" cosy:"json:password"`
+	Note     string  `json:"note"`
+	Product  Product `json:"product"`
+}
+
+func TestExportColumns(t *testing.T) {
+	model.RegisterModels(exportModel{}, Product{})
+	model.ResolvedModels()
+
+	assert.Equal(t, []exportColumn{
+		{Key: "code", Title: "编码"},
+		{Key: "name", Title: "name"},
+	}, exportColumns[exportModel](nil))
+
+	s, err := schema.Parse(&Product{}, &sync.Map{}, schema.NamingStrategy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// associations are not exported by default
+	var keys []string
+	for _, column := range exportColumns[Product](s) {
+		keys = append(keys, column.Key)
+	}
+	assert.Equal(t, []string{"id", "created_at", "updated_at", "deleted_at",
+		"name", "description", "price", "status", "user_id"}, keys)
+}
+
+func TestExportRow(t *testing.T) {
+	columns := []exportColumn{{Key: "code"}, {Key: "name"}, {Key: "missing"}}
+
+	values, err := exportRow(&exportModel{Code: "A1", Name: "a"}, columns)
+	assert.NoError(t, err)
+	assert.Equal(t, []any{"A1", "a", nil}, values)
+
+	// the values of the transformer are resolved by the json keys
+	values, err = exportRow(map[string]any{"code": "B2", "name": 2}, columns)
+	assert.NoError(t, err)
+	assert.Equal(t, []any{"B2", json.Number("2"), nil}, values)
+}
+
+func TestContentDisposition(t *testing.T) {
+	assert.Equal(t, `attachment; filename="users.csv"; filename*=UTF-8''users.csv`,
+		contentDisposition("users.csv"))
+	assert.Equal(t, `attachment; filename="__.xlsx"; filename*=UTF-8''%E7%94%A8%E6%88%B7.xlsx`,
+		contentDisposition("用户.xlsx"))
+}
+
+type exportAuthor struct {
+	model.Model
+	Name string `json:"name"`
+}
+
+type exportBook struct {
+	model.Model
+	Title    string        `json:"title" cosy:"export"`
+	AuthorID model.IDType  `json:"author_id"`
+	Author   *exportAuthor `json:"author" cosy:"export"`
+}
+
+func TestExportPreloads(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger.Init(gin.TestMode)
+	model.ClearCollection()
+	model.RegisterModels(exportAuthor{}, exportBook{})
+	db := model.Init(sqlite.Open(filepath.Join(t.TempDir(), "export.db")))
+
+	author := &exportAuthor{Name: "alice"}
+	db.Create(author)
+	for _, title := range []string{"a", "b", "c"} {
+		db.Create(&exportBook{Title: title, AuthorID: author.ID})
+	}
+
+	r := gin.New()
+	r.GET("/books/export", func(c *gin.Context) {
+		Core[exportBook](c).
+			SetPreloads("Author").
+			SetExportLimit(2).
+			SetTransformer(func(m *exportBook) any {
+				// the transformer reads the preloaded association
+				return gin.H{"title": m.Title, "author": m.Author.Name}
+			}).
+			Export(export.CSV)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/books/export?sort_by=id&order=asc", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	lines := strings.Split(strings.TrimSpace(strings.TrimPrefix(w.Body.String(), "\ufeff")), "\n")
+	assert.Equal(t, []string{"title,author", "a,alice", "b,alice"}, lines)
+}
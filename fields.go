@@ -0,0 +1,311 @@
+package cosy
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/uozi-tech/cosy/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// fieldset is the parsed form of the "fields" query parameter for a single (nested) model,
+// only the fields marked with cosy:"item:selectable" can be requested
+type fieldset struct {
+	schema *schema.Schema
+	// columns to select, primary keys and foreign keys are always included
+	columns []string
+	// json keys of the response, a nil value means the whole value is kept
+	keys map[string]*fieldset
+	// json keys which are always kept in the response, e.g. primary keys
+	keep []string
+	// association name of each nested fieldset, keyed by json key
+	relations map[string]string
+}
+
+// fieldsetLookup resolves a json key of the request into a schema field
+type fieldsetLookup func(key string) (field *schema.Field, ok bool)
+
+func newFieldset(s *schema.Schema) *fieldset {
+	fs := &fieldset{
+		schema:    s,
+		keys:      make(map[string]*fieldset),
+		relations: make(map[string]string),
+	}
+	for _, field := range s.PrimaryFields {
+		fs.addColumn(field.DBName)
+		fs.keep = append(fs.keep, jsonKeyOf(field))
+	}
+	return fs
+}
+
+// jsonKeyOf returns the json key of a schema field
+func jsonKeyOf(field *schema.Field) string {
+	key, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if key == "" {
+		return field.Name
+	}
+	return key
+}
+
+// nestedLookup looks up the selectable fields of an association by the json tag
+func nestedLookup(s *schema.Schema) fieldsetLookup {
+	return func(key string) (*schema.Field, bool) {
+		for _, field := range s.Fields {
+			if jsonKeyOf(field) != key {
+				continue
+			}
+			tag := model.NewCosyTag(field.Tag.Get("cosy"))
+			return field, tag.GetSelectable()
+		}
+		return nil, false
+	}
+}
+
+func (fs *fieldset) addColumn(column string) {
+	for _, v := range fs.columns {
+		if v == column {
+			return
+		}
+	}
+	fs.columns = append(fs.columns, column)
+}
+
+// add adds a dotted path, e.g. "profile.avatar", into the fieldset
+func (fs *fieldset) add(path []string, lookup fieldsetLookup) bool {
+	key := path[0]
+	field, ok := lookup(key)
+	if !ok || field == nil {
+		return false
+	}
+
+	rel, isRelation := fs.schema.Relationships.Relations[field.Name]
+	if !isRelation {
+		// plain columns can't be nested
+		if len(path) > 1 || field.DBName == "" {
+			return false
+		}
+		fs.addColumn(field.DBName)
+		fs.keys[key] = nil
+		return true
+	}
+
+	fs.relations[key] = field.Name
+	// the keys which join both sides of the association must be loaded
+	for _, ref := range rel.References {
+		if ref.PrimaryKey != nil && ref.PrimaryKey.Schema == fs.schema {
+			fs.addColumn(ref.PrimaryKey.DBName)
+		}
+		if ref.ForeignKey != nil && ref.ForeignKey.Schema == fs.schema {
+			fs.addColumn(ref.ForeignKey.DBName)
+		}
+	}
+
+	if len(path) == 1 {
+		fs.keys[key] = nil
+		return true
+	}
+
+	child, exist := fs.keys[key]
+	if exist && child == nil {
+		// the whole association has been requested
+		return true
+	}
+	if child == nil {
+		child = newFieldset(rel.FieldSchema)
+		for _, ref := range rel.References {
+			if ref.PrimaryKey != nil && ref.PrimaryKey.Schema == rel.FieldSchema {
+				child.addColumn(ref.PrimaryKey.DBName)
+			}
+			if ref.ForeignKey != nil && ref.ForeignKey.Schema == rel.FieldSchema {
+				child.addColumn(ref.ForeignKey.DBName)
+			}
+		}
+		fs.keys[key] = child
+	}
+
+	return child.add(path[1:], nestedLookup(rel.FieldSchema))
+}
+
+// nested returns the fieldset of an association by its name
+func (fs *fieldset) nested(name string) *fieldset {
+	for key, relation := range fs.relations {
+		if relation == name {
+			return fs.keys[key]
+		}
+	}
+	return nil
+}
+
+func (fs *fieldset) hasRelation(name string) bool {
+	for _, relation := range fs.relations {
+		if relation == name {
+			return true
+		}
+	}
+	return false
+}
+
+// selectScope narrows the SQL projection to the columns of the fieldset
+func (fs *fieldset) selectScope(tx *gorm.DB) *gorm.DB {
+	var sb strings.Builder
+	args := make([]any, 0, len(fs.columns))
+	for i, column := range fs.columns {
+		if i > 0 {
+			sb.WriteString(", ")
+		}
+		sb.WriteString("?")
+		args = append(args, clause.Column{Table: clause.CurrentTable, Name: column})
+	}
+	return tx.Select(sb.String(), args...)
+}
+
+// prune drops the json keys which are not part of the fieldset
+func (fs *fieldset) prune(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for key, item := range v {
+			child, ok := fs.keys[key]
+			if !ok {
+				if !fs.isKept(key) {
+					delete(v, key)
+				}
+				continue
+			}
+			if child != nil {
+				v[key] = child.prune(item)
+			}
+		}
+	case []any:
+		for i := range v {
+			v[i] = fs.prune(v[i])
+		}
+	}
+	return value
+}
+
+func (fs *fieldset) isKept(key string) bool {
+	for _, v := range fs.keep {
+		if v == key {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveFieldset parses the "fields" query parameter,
+// responds 406 if any of the requested fields is not selectable
+func (c *Ctx[T]) resolveFieldset() {
+	raw := c.Query("fields")
+	if raw == "" {
+		return
+	}
+
+	s := c.schema()
+	resolved := model.GetResolvedModel[T]()
+	if s == nil || resolved == nil {
+		return
+	}
+
+	// top level keys are mapped through the resolved model and the column mapping
+	lookup := func(key string) (*schema.Field, bool) {
+		field, ok := resolved.Fields[key]
+		if !ok || !field.CosyTag.GetSelectable() {
+			return nil, false
+		}
+		if rel, ok := s.Relationships.Relations[field.Name]; ok {
+			return rel.Field, true
+		}
+		dbField, ok := s.FieldsByDBName[c.resolveColumn(key)]
+		return dbField, ok
+	}
+
+	fs := newFieldset(s)
+	if c.itemKey != "" {
+		if field, ok := s.FieldsByDBName[c.itemKey]; ok {
+			fs.addColumn(field.DBName)
+		}
+	}
+
+	errs := make(gin.H)
+	for path := range strings.SplitSeq(raw, ",") {
+		path = strings.TrimSpace(path)
+		if path == "" {
+			continue
+		}
+		if !fs.add(strings.Split(path, "."), lookup) {
+			errs[path] = "selectable"
+		}
+	}
+
+	if len(errs) > 0 {
+		c.JSON(http.StatusNotAcceptable, NewValidateError(errs))
+		c.Abort()
+		return
+	}
+
+	c.fieldset = fs
+}
+
+// applyFieldset narrows the SQL projection of the query
+func (c *Ctx[T]) applyFieldset(tx *gorm.DB) *gorm.DB {
+	if c.fieldset == nil {
+		return tx
+	}
+	return c.fieldset.selectScope(tx)
+}
+
+// preloadWithFieldset preloads the association with the narrowed projection,
+// associations which are not requested are skipped
+func (c *Ctx[T]) preloadWithFieldset(tx *gorm.DB, name string) *gorm.DB {
+	if c.fieldset == nil {
+		return tx.Preload(name)
+	}
+
+	relation, _, nestedPreload := strings.Cut(name, ".")
+	if !c.fieldset.hasRelation(relation) {
+		return tx
+	}
+
+	nested := c.fieldset.nested(relation)
+	if nested == nil || nestedPreload {
+		return tx.Preload(name)
+	}
+
+	return tx.Preload(name, nested.selectScope)
+}
+
+// pruneWithFieldset narrows the response data to the requested fields,
+// the fields which can't be read by the request are dropped as well
+func (c *Ctx[T]) pruneWithFieldset(data any) any {
+	restricted := isReadRestricted[T]()
+	if (c.fieldset == nil && !restricted) || data == nil {
+		return data
+	}
+
+	buf, err := json.Marshal(data)
+	if err != nil {
+		return data
+	}
+
+	// keep the precision of large numeric IDs
+	decoder := json.NewDecoder(bytes.NewReader(buf))
+	decoder.UseNumber()
+
+	var value any
+	if err = decoder.Decode(&value); err != nil {
+		return data
+	}
+
+	if c.fieldset != nil {
+		value = c.fieldset.prune(value)
+	}
+	if restricted {
+		value = pruneUnreadable(value, c.schema(), c.rolesOf())
+	}
+	return value
+}
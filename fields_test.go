@@ -0,0 +1,65 @@
+package cosy
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm/schema"
+)
+
+type fieldsetProfile struct {
+	ID              uint64 `json:"id" gorm:"primaryKey"`
+	FieldsetOwnerID uint64 `json:"owner_id"`
+	Avatar          string `json:"avatar" cosy:"item:selectable"`
+	Bio             string `json:"bio"`
+}
+
+type fieldsetOwner struct {
+	ID      uint64           `json:"id" gorm:"primaryKey"`
+	Name    string           `json:"name" cosy:"item:selectable"`
+	Secret  string           `json:"secret"`
+	Profile *fieldsetProfile `json:"profile" cosy:"item:preload,selectable"`
+}
+
+func TestFieldsetAddAndPrune(t *testing.T) {
+	s, err := schema.Parse(&fieldsetOwner{}, &sync.Map{}, schema.NamingStrategy{})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	lookup := nestedLookup(s)
+	fs := newFieldset(s)
+
+	assert.True(t, fs.add([]string{"name"}, lookup))
+	assert.True(t, fs.add([]string{"profile", "avatar"}, lookup))
+	assert.False(t, fs.add([]string{"secret"}, lookup))
+	assert.False(t, fs.add([]string{"profile", "bio"}, lookup))
+	assert.False(t, fs.add([]string{"name", "first"}, lookup))
+
+	assert.Equal(t, []string{"id", "name"}, fs.columns)
+	if nested := fs.nested("Profile"); assert.NotNil(t, nested) {
+		assert.ElementsMatch(t, []string{"id", "fieldset_owner_id", "avatar"}, nested.columns)
+	}
+
+	data := map[string]any{
+		"id":     1,
+		"name":   "cosy",
+		"secret": "hidden",
+		"profile": map[string]any{
+			"id":       2,
+			"owner_id": 1,
+			"avatar":   "a.png",
+			"bio":      "hidden",
+		},
+	}
+
+	assert.Equal(t, map[string]any{
+		"id":   1,
+		"name": "cosy",
+		"profile": map[string]any{
+			"id":     2,
+			"avatar": "a.png",
+		},
+	}, fs.prune(data))
+}
@@ -1,6 +1,9 @@
 package cosy
 
 import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
 	"github.com/uozi-tech/cosy/filter"
 	"github.com/uozi-tech/cosy/logger"
 	"github.com/uozi-tech/cosy/model"
@@ -16,8 +19,24 @@ func (c *Ctx[T]) resolveFilterColumns(keys ...string) []filter.Column {
 	return cols
 }
 
+// splitRelationPaths splits the dotted paths of the associations out of the keys
+func splitRelationPaths(keys []string) (columns []string, paths []string) {
+	for _, key := range keys {
+		if isRelationPath(key) {
+			paths = append(paths, key)
+			continue
+		}
+		columns = append(columns, key)
+	}
+	return
+}
+
 func (c *Ctx[T]) SetFussy(keys ...string) *Ctx[T] {
 	c.listService.fussy = append(c.listService.fussy, keys...)
+	keys, paths := splitRelationPaths(keys)
+	for _, path := range paths {
+		c.setRelationFilter(path, filter.QueryToFussySearch)
+	}
 	for _, col := range c.resolveFilterColumns(keys...) {
 		c.gormScopes = append(c.gormScopes, func(tx *gorm.DB) *gorm.DB {
 			return filter.QueryToFussySearch(c.Context, tx, col)
@@ -37,6 +56,12 @@ func (c *Ctx[T]) SetSearchFussyKeys(keys ...string) *Ctx[T] {
 
 func (c *Ctx[T]) SetEqual(keys ...string) *Ctx[T] {
 	c.listService.eq = append(c.listService.eq, keys...)
+	keys, paths := splitRelationPaths(keys)
+	for _, path := range paths {
+		c.setRelationFilter(path, func(c *gin.Context, tx *gorm.DB, col filter.Column) *gorm.DB {
+			return filter.QueryToEqualSearch(c, tx, col)
+		})
+	}
 	cols := c.resolveFilterColumns(keys...)
 	c.gormScopes = append(c.gormScopes, func(tx *gorm.DB) *gorm.DB {
 		return filter.QueryToEqualSearch(c.Context, tx, cols...)
@@ -46,6 +71,10 @@ func (c *Ctx[T]) SetEqual(keys ...string) *Ctx[T] {
 
 func (c *Ctx[T]) SetIn(keys ...string) *Ctx[T] {
 	c.listService.in = append(c.listService.in, keys...)
+	keys, paths := splitRelationPaths(keys)
+	for _, path := range paths {
+		c.setRelationFilter(path, filter.QueryToInSearch)
+	}
 	cols := c.resolveFilterColumns(keys...)
 	c.gormScopes = append(c.gormScopes, func(tx *gorm.DB) *gorm.DB {
 		return filter.QueriesToInSearch(c.Context, tx, cols...)
@@ -105,6 +134,17 @@ func (c *Ctx[T]) SetOrIn(keys ...string) *Ctx[T] {
 	return c
 }
 
+// SetJSON filters the json columns of the keys by the dotted paths, e.g. ?attrs.color=red or ?attrs.size[]=L
+func (c *Ctx[T]) SetJSON(keys ...string) *Ctx[T] {
+	c.listService.json = append(c.listService.json, keys...)
+	for _, col := range c.resolveFilterColumns(keys...) {
+		c.gormScopes = append(c.gormScopes, func(tx *gorm.DB) *gorm.DB {
+			return filter.QueryToJSONSearch(c.Context, tx, col)
+		})
+	}
+	return c
+}
+
 func (c *Ctx[T]) SetCustomFilter(key string, filterName string) *Ctx[T] {
 	customFilter := filter.FilterMap[filterName]
 	if customFilter == nil {
@@ -118,3 +158,53 @@ func (c *Ctx[T]) SetCustomFilter(key string, filterName string) *Ctx[T] {
 	})
 	return c
 }
+
+// SetFilterable allows the keys to be used in the "filter" expression query
+func (c *Ctx[T]) SetFilterable(keys ...string) *Ctx[T] {
+	c.listService.filterable = append(c.listService.filterable, keys...)
+	return c
+}
+
+// resolveFilterExpression parses the "filter" expression query and applies it as a gorm scope
+func (c *Ctx[T]) resolveFilterExpression() {
+	query := c.Query("filter")
+	if query == "" {
+		return
+	}
+
+	columns := make(map[string]string, len(c.listService.filterable))
+	for _, col := range c.resolveFilterColumns(c.listService.filterable...) {
+		columns[col.QueryKey] = col.DBColumn
+	}
+
+	expr, err := filter.ParseExpression(query)
+	if err != nil {
+		c.JSON(http.StatusNotAcceptable, NewValidateError(gin.H{
+			"filter": err.Error(),
+		}))
+		c.Abort()
+		return
+	}
+
+	unreadable := c.unreadableKeys()
+	for _, field := range expr.Fields() {
+		if unreadable[field] {
+			c.JSON(http.StatusForbidden, ErrForbidden)
+			c.Abort()
+			return
+		}
+	}
+
+	condition, err := expr.Compile(columns)
+	if err != nil {
+		c.JSON(http.StatusNotAcceptable, NewValidateError(gin.H{
+			"filter": err.Error(),
+		}))
+		c.Abort()
+		return
+	}
+
+	c.GormScope(func(tx *gorm.DB) *gorm.DB {
+		return tx.Where(condition)
+	})
+}
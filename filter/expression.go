@@ -0,0 +1,466 @@
+package filter
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// MaxExpressionLength is the max length of a filter expression
+	MaxExpressionLength = 2048
+	// MaxExpressionDepth is the max nesting depth of a filter expression
+	MaxExpressionDepth = 16
+	// MaxExpressionInValues is the max count of values of a single "in" condition
+	MaxExpressionInValues = 100
+)
+
+var ErrExpressionTooLong = errors.New("filter expression is too long")
+
+// ExpressionError is returned when the filter expression can't be parsed or compiled
+type ExpressionError struct {
+	Pos     int
+	Message string
+}
+
+func (e *ExpressionError) Error() string {
+	return fmt.Sprintf("%s at position %d", e.Message, e.Pos)
+}
+
+// comparison operators of the filter expression, symbols are mapped to the word form
+var expressionOperators = map[string]string{
+	"eq":  "eq",
+	"=":   "eq",
+	"ne":  "ne",
+	"!=":  "ne",
+	"<>":  "ne",
+	"gt":  "gt",
+	">":   "gt",
+	"ge":  "ge",
+	"gte": "ge",
+	">=":  "ge",
+	"lt":  "lt",
+	"<":   "lt",
+	"le":  "le",
+	"lte": "le",
+	"<=":  "le",
+}
+
+// Expression is the syntax tree of a filter expression
+type Expression interface {
+	// Fields returns the fields referenced by the expression
+	Fields() []string
+	// Compile compiles the expression into parameterized gorm conditions,
+	// columns maps the allowed fields to their database columns
+	Compile(columns map[string]string) (clause.Expression, error)
+}
+
+// LogicalExpression is an "and" / "or" group
+type LogicalExpression struct {
+	Operator string
+	Operands []Expression
+}
+
+// NotExpression negates an expression
+type NotExpression struct {
+	Operand Expression
+}
+
+// ComparisonExpression compares a field with values, Operator is one of
+// eq, ne, gt, ge, lt, le, in, not_in, is_null, is_not_null
+type ComparisonExpression struct {
+	Pos      int
+	Field    string
+	Operator string
+	Values   []string
+}
+
+func (e *LogicalExpression) Fields() (fields []string) {
+	for _, operand := range e.Operands {
+		fields = append(fields, operand.Fields()...)
+	}
+	return
+}
+
+func (e *LogicalExpression) Compile(columns map[string]string) (clause.Expression, error) {
+	exprs := make([]clause.Expression, 0, len(e.Operands))
+	for _, operand := range e.Operands {
+		expr, err := operand.Compile(columns)
+		if err != nil {
+			return nil, err
+		}
+		exprs = append(exprs, expr)
+	}
+
+	if e.Operator == "or" {
+		return clause.Or(exprs...), nil
+	}
+	return clause.And(exprs...), nil
+}
+
+func (e *NotExpression) Fields() []string {
+	return e.Operand.Fields()
+}
+
+func (e *NotExpression) Compile(columns map[string]string) (clause.Expression, error) {
+	expr, err := e.Operand.Compile(columns)
+	if err != nil {
+		return nil, err
+	}
+	return clause.Expr{SQL: "NOT (?)", Vars: []any{expr}}, nil
+}
+
+func (e *ComparisonExpression) Fields() []string {
+	return []string{e.Field}
+}
+
+func (e *ComparisonExpression) Compile(columns map[string]string) (clause.Expression, error) {
+	column, ok := columns[e.Field]
+	if !ok || column == "" {
+		return nil, &ExpressionError{Pos: e.Pos, Message: fmt.Sprintf("field %q is not filterable", e.Field)}
+	}
+
+	col := clause.Column{Table: clause.CurrentTable, Name: column}
+	switch e.Operator {
+	case "eq":
+		return clause.Eq{Column: col, Value: e.Values[0]}, nil
+	case "ne":
+		return clause.Neq{Column: col, Value: e.Values[0]}, nil
+	case "gt":
+		return clause.Gt{Column: col, Value: e.Values[0]}, nil
+	case "ge":
+		return clause.Gte{Column: col, Value: e.Values[0]}, nil
+	case "lt":
+		return clause.Lt{Column: col, Value: e.Values[0]}, nil
+	case "le":
+		return clause.Lte{Column: col, Value: e.Values[0]}, nil
+	case "in", "not_in":
+		values := make([]any, 0, len(e.Values))
+		for _, v := range e.Values {
+			values = append(values, v)
+		}
+		if e.Operator == "in" {
+			return clause.IN{Column: col, Values: values}, nil
+		}
+		return clause.Expr{SQL: "? NOT IN ?", Vars: []any{col, values}}, nil
+	case "is_null":
+		return clause.Eq{Column: col, Value: nil}, nil
+	case "is_not_null":
+		return clause.Neq{Column: col, Value: nil}, nil
+	}
+
+	return nil, &ExpressionError{Pos: e.Pos, Message: fmt.Sprintf("unknown operator %q", e.Operator)}
+}
+
+type tokenKind int8
+
+const (
+	tokenWord tokenKind = iota
+	tokenString
+	tokenSymbol
+	tokenLParen
+	tokenRParen
+	tokenComma
+	tokenEOF
+)
+
+type token struct {
+	kind  tokenKind
+	value string
+	pos   int
+}
+
+// is reports whether the token is the given (case-insensitive) keyword
+func (t token) is(keyword string) bool {
+	return t.kind == tokenWord && strings.EqualFold(t.value, keyword)
+}
+
+func isSymbolChar(r rune) bool {
+	return r == '=' || r == '!' || r == '<' || r == '>'
+}
+
+func isWordChar(r rune) bool {
+	return !unicode.IsSpace(r) && !isSymbolChar(r) &&
+		r != '(' && r != ')' && r != ',' && r != '\'' && r != '"'
+}
+
+// tokenize splits the filter expression into tokens
+func tokenize(input string) ([]token, error) {
+	runes := []rune(input)
+	tokens := make([]token, 0)
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, token{kind: tokenLParen, value: "(", pos: i})
+			i++
+		case r == ')':
+			tokens = append(tokens, token{kind: tokenRParen, value: ")", pos: i})
+			i++
+		case r == ',':
+			tokens = append(tokens, token{kind: tokenComma, value: ",", pos: i})
+			i++
+		case r == '\'' || r == '"':
+			start := i
+			var sb strings.Builder
+			i++
+			closed := false
+			for i < len(runes) {
+				if runes[i] == '\\' && i+1 < len(runes) {
+					sb.WriteRune(runes[i+1])
+					i += 2
+					continue
+				}
+				if runes[i] == r {
+					closed = true
+					i++
+					break
+				}
+				sb.WriteRune(runes[i])
+				i++
+			}
+			if !closed {
+				return nil, &ExpressionError{Pos: start, Message: "unterminated string"}
+			}
+			tokens = append(tokens, token{kind: tokenString, value: sb.String(), pos: start})
+		case isSymbolChar(r):
+			start := i
+			for i < len(runes) && isSymbolChar(runes[i]) {
+				i++
+			}
+			value := string(runes[start:i])
+			if _, ok := expressionOperators[value]; !ok {
+				return nil, &ExpressionError{Pos: start, Message: fmt.Sprintf("unknown operator %q", value)}
+			}
+			tokens = append(tokens, token{kind: tokenSymbol, value: value, pos: start})
+		default:
+			start := i
+			for i < len(runes) && isWordChar(runes[i]) {
+				i++
+			}
+			tokens = append(tokens, token{kind: tokenWord, value: string(runes[start:i]), pos: start})
+		}
+	}
+
+	tokens = append(tokens, token{kind: tokenEOF, pos: len(runes)})
+	return tokens, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+	depth  int
+}
+
+// ParseExpression parses a filter expression, e.g.
+// (status eq 1 or status eq 2) and created_at gt 2024-01-01 and deleted_by is null
+func ParseExpression(input string) (Expression, error) {
+	if len(input) > MaxExpressionLength {
+		return nil, ErrExpressionTooLong
+	}
+
+	tokens, err := tokenize(input)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if t := p.peek(); t.kind != tokenEOF {
+		return nil, p.unexpected(t)
+	}
+
+	return expr, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) unexpected(t token) error {
+	if t.kind == tokenEOF {
+		return &ExpressionError{Pos: t.pos, Message: "unexpected end of expression"}
+	}
+	return &ExpressionError{Pos: t.pos, Message: fmt.Sprintf("unexpected %q", t.value)}
+}
+
+func (p *parser) parseOr() (Expression, error) {
+	return p.parseLogical("or", p.parseAnd)
+}
+
+func (p *parser) parseAnd() (Expression, error) {
+	return p.parseLogical("and", p.parseUnary)
+}
+
+func (p *parser) parseLogical(operator string, operand func() (Expression, error)) (Expression, error) {
+	first, err := operand()
+	if err != nil {
+		return nil, err
+	}
+
+	operands := []Expression{first}
+	for p.peek().is(operator) {
+		p.next()
+		expr, err := operand()
+		if err != nil {
+			return nil, err
+		}
+		operands = append(operands, expr)
+	}
+
+	if len(operands) == 1 {
+		return first, nil
+	}
+	return &LogicalExpression{Operator: operator, Operands: operands}, nil
+}
+
+func (p *parser) parseUnary() (Expression, error) {
+	if p.peek().is("not") {
+		t := p.next()
+		if err := p.enter(t); err != nil {
+			return nil, err
+		}
+		defer p.leave()
+
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return &NotExpression{Operand: expr}, nil
+	}
+
+	return p.parsePrimary()
+}
+
+func (p *parser) enter(t token) error {
+	p.depth++
+	if p.depth > MaxExpressionDepth {
+		return &ExpressionError{Pos: t.pos, Message: "filter expression is nested too deeply"}
+	}
+	return nil
+}
+
+func (p *parser) leave() {
+	p.depth--
+}
+
+func (p *parser) parsePrimary() (Expression, error) {
+	t := p.next()
+
+	if t.kind == tokenLParen {
+		if err := p.enter(t); err != nil {
+			return nil, err
+		}
+		defer p.leave()
+
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokenRParen {
+			return nil, p.unexpected(closing)
+		}
+		return expr, nil
+	}
+
+	if t.kind != tokenWord {
+		return nil, p.unexpected(t)
+	}
+
+	return p.parseComparison(t)
+}
+
+func (p *parser) parseComparison(field token) (Expression, error) {
+	expr := &ComparisonExpression{Pos: field.pos, Field: field.value}
+
+	op := p.next()
+	switch {
+	case op.is("is"):
+		expr.Operator = "is_null"
+		if p.peek().is("not") {
+			p.next()
+			expr.Operator = "is_not_null"
+		}
+		if t := p.next(); !t.is("null") {
+			return nil, p.unexpected(t)
+		}
+		return expr, nil
+	case op.is("in"):
+		expr.Operator = "in"
+		return p.parseValueList(expr)
+	case op.is("not"):
+		if t := p.next(); !t.is("in") {
+			return nil, p.unexpected(t)
+		}
+		expr.Operator = "not_in"
+		return p.parseValueList(expr)
+	case op.kind == tokenWord || op.kind == tokenSymbol:
+		operator, ok := expressionOperators[strings.ToLower(op.value)]
+		if !ok {
+			return nil, &ExpressionError{Pos: op.pos, Message: fmt.Sprintf("unknown operator %q", op.value)}
+		}
+		expr.Operator = operator
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		expr.Values = []string{value}
+		return expr, nil
+	}
+
+	return nil, p.unexpected(op)
+}
+
+func (p *parser) parseValue() (string, error) {
+	t := p.next()
+	if t.kind != tokenWord && t.kind != tokenString {
+		return "", p.unexpected(t)
+	}
+	if t.is("null") {
+		return "", &ExpressionError{Pos: t.pos, Message: `use "is null" to compare with null`}
+	}
+	return t.value, nil
+}
+
+func (p *parser) parseValueList(expr *ComparisonExpression) (Expression, error) {
+	if t := p.next(); t.kind != tokenLParen {
+		return nil, p.unexpected(t)
+	}
+
+	for {
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		expr.Values = append(expr.Values, value)
+		if len(expr.Values) > MaxExpressionInValues {
+			return nil, &ExpressionError{Pos: expr.Pos, Message: "too many values"}
+		}
+
+		t := p.next()
+		if t.kind == tokenRParen {
+			return expr, nil
+		}
+		if t.kind != tokenComma {
+			return nil, p.unexpected(t)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package filter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/gorm/clause"
+)
+
+// sqlBuilder is a minimal clause.Builder that renders the conditions for assertions
+type sqlBuilder struct {
+	strings.Builder
+	vars []any
+}
+
+func (b *sqlBuilder) WriteQuoted(field any) {
+	switch v := field.(type) {
+	case clause.Column:
+		b.WriteString(v.Name)
+	default:
+		b.WriteString("?")
+	}
+}
+
+func (b *sqlBuilder) AddVar(writer clause.Writer, vars ...any) {
+	for i, v := range vars {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		switch v := v.(type) {
+		case clause.Column:
+			b.WriteQuoted(v)
+		case clause.Expression:
+			v.Build(b)
+		case []any:
+			b.WriteString("(")
+			b.AddVar(b, v...)
+			b.WriteString(")")
+		default:
+			b.vars = append(b.vars, v)
+			b.WriteString("?")
+		}
+	}
+}
+
+func (b *sqlBuilder) AddError(err error) error {
+	return err
+}
+
+func compileExpression(t *testing.T, input string, columns map[string]string) (string, []any) {
+	expr, err := ParseExpression(input)
+	if !assert.NoError(t, err) {
+		return "", nil
+	}
+	condition, err := expr.Compile(columns)
+	if !assert.NoError(t, err) {
+		return "", nil
+	}
+	b := &sqlBuilder{}
+	clause.Where{Exprs: []clause.Expression{condition}}.Build(b)
+	return b.String(), b.vars
+}
+
+func TestParseExpression(t *testing.T) {
+	columns := map[string]string{
+		"status":     "status",
+		"createdAt":  "created_at",
+		"deleted_by": "deleted_by",
+	}
+
+	sql, vars := compileExpression(t,
+		"(status eq 1 or status eq 2) and createdAt gt 2024-01-01 and deleted_by is null", columns)
+	assert.Equal(t, "(status = ? OR status = ?) AND created_at > ? AND deleted_by IS NULL", sql)
+	assert.Equal(t, []any{"1", "2", "2024-01-01"}, vars)
+
+	sql, vars = compileExpression(t, "NOT status IN (1, 'a b') or deleted_by is not null", columns)
+	assert.Equal(t, "(NOT (status IN (?,?)) OR deleted_by IS NOT NULL)", sql)
+	assert.Equal(t, []any{"1", "a b"}, vars)
+
+	sql, vars = compileExpression(t, "status != 3 and status not in (4) and createdAt <= \"2024-01-01 10:00\"", columns)
+	assert.Equal(t, "status <> ? AND status NOT IN (?) AND created_at <= ?", sql)
+	assert.Equal(t, []any{"3", "4", "2024-01-01 10:00"}, vars)
+}
+
+func TestParseExpressionErrors(t *testing.T) {
+	for _, input := range []string{
+		"",
+		"status",
+		"status eq",
+		"status eq 1 and",
+		"(status eq 1",
+		"status like 1",
+		"status eq null",
+		"status in 1",
+		"status is 1",
+		"status eq 'unterminated",
+		"status === 1",
+		strings.Repeat("(", MaxExpressionDepth+1) + "status eq 1" + strings.Repeat(")", MaxExpressionDepth+1),
+	} {
+		_, err := ParseExpression(input)
+		assert.Error(t, err, input)
+	}
+
+	_, err := ParseExpression(strings.Repeat("a", MaxExpressionLength+1))
+	assert.ErrorIs(t, err, ErrExpressionTooLong)
+
+	expr, err := ParseExpression("password eq 1 or status eq 1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"password", "status"}, expr.Fields())
+	_, err = expr.Compile(map[string]string{"status": "status"})
+	assert.Error(t, err)
+}
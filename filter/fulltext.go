@@ -0,0 +1,103 @@
+package filter
+
+import (
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/uozi-tech/cosy/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// FullTextQuery is the query key of the full-text search, it's separated from the "search" query
+// of the fussy search, so that both of them can be used on the same model
+const FullTextQuery = "fulltext"
+
+// fts5Query quotes the terms of the value as the fts5 strings, so that the value is matched
+// as plain words instead of the fts5 query syntax, the terms are matched by AND
+func fts5Query(value string) string {
+	terms := strings.Fields(value)
+	for i, term := range terms {
+		terms[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+	}
+	return strings.Join(terms, " ")
+}
+
+// matchExpr returns the MATCH ... AGAINST expression of the columns in mysql
+func matchExpr(stmt *gorm.Statement, table string, columns []string, value string) clause.Expression {
+	quoted := make([]string, 0, len(columns))
+	for _, column := range columns {
+		quoted = append(quoted, stmt.Quote(clause.Column{Table: table, Name: column}))
+	}
+	return clause.Expr{
+		SQL:  "MATCH (" + strings.Join(quoted, ", ") + ") AGAINST (? IN NATURAL LANGUAGE MODE)",
+		Vars: []any{value},
+	}
+}
+
+// tsQuery returns the tsquery of the value in postgres
+func tsQuery(value string) clause.Expression {
+	return clause.Expr{
+		SQL:  "websearch_to_tsquery('" + model.FullTextLanguage() + "'::regconfig, ?)",
+		Vars: []any{value},
+	}
+}
+
+// FullTextCondition returns the condition of the records of the table matching the value by the full-text search,
+// the columns must be the same as the ones of the full-text index created by model.MigrateFullText
+func FullTextCondition(db *gorm.DB, table string, columns []string, value string) clause.Expression {
+	stmt := db.Statement
+	switch db.Name() {
+	case "mysql":
+		return matchExpr(stmt, table, columns, value)
+	case "postgres":
+		return clause.Expr{
+			SQL:  model.FullTextVector(stmt, table, columns) + " @@ ?",
+			Vars: []any{tsQuery(value)},
+		}
+	default:
+		fts := stmt.Quote(model.FullTextTable(table))
+		return clause.Expr{
+			SQL:  stmt.Quote(clause.Column{Table: table, Name: "rowid"}) + " IN (SELECT rowid FROM " + fts + " WHERE " + fts + " MATCH ?)",
+			Vars: []any{fts5Query(value)},
+		}
+	}
+}
+
+// FullTextRelevance returns the relevance of the records of the table to the value,
+// the more relevant records have the greater relevance
+func FullTextRelevance(db *gorm.DB, table string, columns []string, value string) clause.Expression {
+	stmt := db.Statement
+	switch db.Name() {
+	case "mysql":
+		return matchExpr(stmt, table, columns, value)
+	case "postgres":
+		return clause.Expr{
+			SQL:  "ts_rank(" + model.FullTextVector(stmt, table, columns) + ", ?)",
+			Vars: []any{tsQuery(value)},
+		}
+	default:
+		// bm25 of fts5 is smaller for the more relevant records
+		fts := stmt.Quote(model.FullTextTable(table))
+		return clause.Expr{
+			SQL: "(SELECT -bm25(" + fts + ") FROM " + fts + " WHERE " + fts + " MATCH ? AND " + fts + ".rowid = " +
+				stmt.Quote(clause.Column{Table: table, Name: "rowid"}) + ")",
+			Vars: []any{fts5Query(value)},
+		}
+	}
+}
+
+// QueryToFullTextSearch filters the records of the table by the full-text search of the "fulltext" query
+func QueryToFullTextSearch(c *gin.Context, tx *gorm.DB, table string, cols ...Column) *gorm.DB {
+	value := strings.TrimSpace(c.Query(FullTextQuery))
+	if value == "" || len(cols) == 0 {
+		return tx
+	}
+
+	columns := make([]string, 0, len(cols))
+	for _, col := range cols {
+		columns = append(columns, col.DBColumn)
+	}
+
+	return tx.Where(FullTextCondition(tx, table, columns, value))
+}
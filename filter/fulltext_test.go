@@ -0,0 +1,42 @@
+package filter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type fullTextPost struct {
+	ID    uint64
+	Title string
+	Body  string
+}
+
+func TestFts5Query(t *testing.T) {
+	assert.Equal(t, `"go" "generics"`, fts5Query(" go  generics "))
+	assert.Equal(t, `"a""b" "OR" "c*"`, fts5Query(`a"b OR c*`))
+}
+
+func TestQueryToFullTextSearch(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{DryRun: true})
+	assert.NoError(t, err)
+
+	sql := func(target string) string {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, target, nil)
+		return db.Model(&fullTextPost{}).Scopes(func(tx *gorm.DB) *gorm.DB {
+			return QueryToFullTextSearch(c, tx, "full_text_posts", Col("title"), Col("body"))
+		}).Find(&[]fullTextPost{}).Statement.SQL.String()
+	}
+
+	assert.NotContains(t, sql("/"), "WHERE")
+	// the "search" query is of the fussy search
+	assert.NotContains(t, sql("/?search=go"), "WHERE")
+	assert.Contains(t, sql("/?fulltext=go"),
+		"WHERE `full_text_posts`.`rowid` IN (SELECT rowid FROM `full_text_posts_fts` WHERE `full_text_posts_fts` MATCH ?)")
+}
@@ -0,0 +1,131 @@
+package filter
+
+import (
+	"encoding/json"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// jsonPathSegmentPattern is the pattern of the keys in the json paths, e.g. "color" of "attrs.color"
+var jsonPathSegmentPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// ParseJSONPath parses the dotted path of the json column into the keys, e.g. "size.width",
+// ok is false if any key is empty or contains other characters than letters, digits, "_" and "-"
+func ParseJSONPath(path string) (keys []string, ok bool) {
+	keys = strings.Split(path, ".")
+	for _, key := range keys {
+		if !jsonPathSegmentPattern.MatchString(key) {
+			return nil, false
+		}
+	}
+	return keys, true
+}
+
+// jsonPath returns the json path of the keys in mysql and sqlite, the keys are quoted,
+// since mysql rejects the unquoted keys containing "-" or starting with a digit, e.g. $."size-x"."0"
+func jsonPath(keys []string) string {
+	return `$."` + strings.Join(keys, `"."`) + `"`
+}
+
+// JSONExtract returns the expression extracting the value of the keys from the json column as text,
+// it's JSON_EXTRACT in mysql and sqlite, and #>> (the path form of ->>) in postgres
+func JSONExtract(db *gorm.DB, table string, column string, keys []string) clause.Expression {
+	quoted := db.Statement.Quote(clause.Column{Table: table, Name: column})
+	switch db.Name() {
+	case "postgres":
+		return clause.Expr{SQL: quoted + " #>> ?", Vars: []any{"{" + strings.Join(keys, ",") + "}"}}
+	case "mysql":
+		return clause.Expr{SQL: "JSON_UNQUOTE(JSON_EXTRACT(" + quoted + ", ?))", Vars: []any{jsonPath(keys)}}
+	default:
+		// json_extract of sqlite returns the sql values, the numbers are compared as text
+		return clause.Expr{SQL: "CAST(JSON_EXTRACT(" + quoted + ", ?) AS TEXT)", Vars: []any{jsonPath(keys)}}
+	}
+}
+
+// jsonDocument returns the json document holding the value at the keys, e.g. {"size":{"width":10}}
+func jsonDocument(keys []string, value json.RawMessage) string {
+	doc := value
+	for i := len(keys) - 1; i >= 0; i-- {
+		doc, _ = json.Marshal(map[string]json.RawMessage{keys[i]: doc})
+	}
+	return string(doc)
+}
+
+// JSONContains returns the @> condition of the jsonb column in postgres, which matches the records having
+// any of the values at the keys, so that the GIN index of the column can be used. The values are matched
+// as strings, and the values which are json numbers, booleans or null are matched as them as well.
+func JSONContains(db *gorm.DB, table string, column string, keys []string, values []string) clause.Expression {
+	quoted := db.Statement.Quote(clause.Column{Table: table, Name: column})
+	conds := make([]clause.Expression, 0, len(values))
+	for _, value := range values {
+		text, _ := json.Marshal(value)
+		docs := []json.RawMessage{text}
+		var scalar any
+		if json.Unmarshal([]byte(value), &scalar) == nil {
+			switch scalar.(type) {
+			case float64, bool, nil:
+				docs = append(docs, json.RawMessage(value))
+			}
+		}
+		for _, doc := range docs {
+			conds = append(conds, clause.Expr{SQL: quoted + " @> ?::jsonb", Vars: []any{jsonDocument(keys, doc)}})
+		}
+	}
+	return clause.Or(conds...)
+}
+
+// jsonQueries returns the queries addressing the paths of the json column, keyed by the paths,
+// e.g. {"color": ["red"], "size": ["L", "XL"]} for ?attrs.color=red&attrs.size[]=L&attrs.size[]=XL
+func jsonQueries(c *gin.Context, queryKey string) (paths []string, values map[string][]string, in map[string]bool) {
+	values = make(map[string][]string)
+	in = make(map[string]bool)
+	prefix := queryKey + "."
+	for key, value := range c.Request.URL.Query() {
+		path, ok := strings.CutPrefix(key, prefix)
+		if !ok {
+			continue
+		}
+		path, array := strings.CutSuffix(path, "[]")
+		in[path] = in[path] || array
+		values[path] = append(values[path], value...)
+	}
+	// the conditions are built in the same order for the same query
+	return slices.Sorted(maps.Keys(values)), values, in
+}
+
+// QueryToJSONSearch filters the json column by the dotted paths of the query key, e.g. ?attrs.color=red
+// matches the records whose attrs column has "red" at $.color, and ?attrs.size[]=L&attrs.size[]=XL matches
+// the records whose size is one of the values. The invalid paths and the empty values are ignored.
+// In postgres the column must be jsonb, which is matched by @>.
+func QueryToJSONSearch(c *gin.Context, db *gorm.DB, col Column) *gorm.DB {
+	paths, values, in := jsonQueries(c, col.QueryKey)
+	for _, path := range paths {
+		keys, ok := ParseJSONPath(path)
+		if !ok {
+			continue
+		}
+		queryArray := slices.DeleteFunc(values[path], func(v string) bool { return v == "" })
+		if len(queryArray) == 0 {
+			continue
+		}
+
+		if db.Name() == "postgres" {
+			db = db.Where(JSONContains(db, db.Statement.Table, col.DBColumn, keys, queryArray))
+			continue
+		}
+
+		extract := JSONExtract(db, db.Statement.Table, col.DBColumn, keys)
+		if in[path] || len(queryArray) > 1 {
+			db = db.Where("? IN ?", extract, queryArray)
+		} else {
+			db = db.Where("? = ?", extract, queryArray[0])
+		}
+	}
+	return db
+}
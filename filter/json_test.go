@@ -0,0 +1,67 @@
+package filter
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type jsonProduct struct {
+	ID    uint64
+	Attrs string
+}
+
+func TestParseJSONPath(t *testing.T) {
+	keys, ok := ParseJSONPath("size.width")
+	assert.True(t, ok)
+	assert.Equal(t, []string{"size", "width"}, keys)
+
+	for _, path := range []string{"", "size.", "a'b", "a b", "$.a"} {
+		_, ok = ParseJSONPath(path)
+		assert.False(t, ok, path)
+	}
+}
+
+func TestQueryToJSONSearch(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{DryRun: true})
+	assert.NoError(t, err)
+
+	query := func(target string) *gorm.Statement {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, target, nil)
+		return db.Model(&jsonProduct{}).Scopes(func(tx *gorm.DB) *gorm.DB {
+			return QueryToJSONSearch(c, tx, Col("attrs"))
+		}).Find(&[]jsonProduct{}).Statement
+	}
+
+	stmt := query("/?attrs.color=red&attrs.size[]=L&attrs.size[]=XL&attrs=1&attrs.a'b=1&attrs.empty=")
+	assert.Contains(t, stmt.SQL.String(),
+		"WHERE CAST(JSON_EXTRACT(`attrs`, ?) AS TEXT) = ? AND CAST(JSON_EXTRACT(`attrs`, ?) AS TEXT) IN (?,?)")
+	assert.Equal(t, []any{`$."color"`, "red", `$."size"`, "L", "XL"}, stmt.Vars)
+
+	// the keys are quoted, since mysql rejects the keys containing "-" or starting with a digit
+	stmt = query("/?attrs.size-x.0width=10")
+	assert.Equal(t, []any{`$."size-x"."0width"`, "10"}, stmt.Vars)
+
+	assert.NotContains(t, query("/?color=red").SQL.String(), "WHERE")
+}
+
+func TestJSONContains(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{DryRun: true})
+	assert.NoError(t, err)
+
+	assert.Equal(t, `{"size":{"width":"L"}}`, jsonDocument([]string{"size", "width"}, []byte(`"L"`)))
+
+	stmt := db.Model(&jsonProduct{}).
+		Where(JSONContains(db, "json_products", "attrs", []string{"size", "width"}, []string{"L", "10"})).
+		Find(&[]jsonProduct{}).Statement
+	assert.Contains(t, stmt.SQL.String(),
+		"WHERE (`json_products`.`attrs` @> ?::jsonb OR `json_products`.`attrs` @> ?::jsonb OR `json_products`.`attrs` @> ?::jsonb)")
+	// the numbers are matched as strings and numbers
+	assert.Equal(t, []any{`{"size":{"width":"L"}}`, `{"size":{"width":"10"}}`, `{"size":{"width":10}}`}, stmt.Vars)
+}
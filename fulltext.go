@@ -0,0 +1,45 @@
+package cosy
+
+import (
+	"strings"
+
+	"github.com/uozi-tech/cosy/filter"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SortRelevance sorts the list by the relevance of the full-text search, e.g. sort_by=relevance
+const SortRelevance = "relevance"
+
+// SetFullTextSearch filters the list by the full-text search of the "fulltext" query on the keys,
+// it uses MATCH ... AGAINST in mysql, to_tsvector and websearch_to_tsquery in postgres and fts5 in sqlite.
+// The keys must be the same as the fields marked with cosy:"list:fulltext", whose full-text indexes are
+// created by model.MigrateFullText.
+func (c *Ctx[T]) SetFullTextSearch(keys ...string) *Ctx[T] {
+	registered := len(c.listService.fullText) > 0
+	c.listService.fullText = append(c.listService.fullText, keys...)
+	if registered {
+		return c
+	}
+
+	// the keys are matched together by the same full-text index
+	c.gormScopes = append(c.gormScopes, func(tx *gorm.DB) *gorm.DB {
+		return filter.QueryToFullTextSearch(c.Context, tx, c.relationTable(), c.resolveFilterColumns(c.listService.fullText...)...)
+	})
+	return c
+}
+
+// fullTextRelevance returns the relevance of the records to the "fulltext" query,
+// false means the full-text search isn't applied
+func (c *Ctx[T]) fullTextRelevance(db *gorm.DB) (clause.Expression, bool) {
+	value := strings.TrimSpace(c.Query(filter.FullTextQuery))
+	if value == "" || len(c.listService.fullText) == 0 {
+		return nil, false
+	}
+
+	columns := make([]string, 0, len(c.listService.fullText))
+	for _, col := range c.resolveFilterColumns(c.listService.fullText...) {
+		columns = append(columns, col.DBColumn)
+	}
+	return filter.FullTextRelevance(db, c.relationTable(), columns, value), true
+}
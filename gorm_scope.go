@@ -3,12 +3,14 @@ package cosy
 import "gorm.io/gorm"
 
 func (c *Ctx[T]) applyGormScopes(result *gorm.DB) *gorm.DB {
+	result = c.scopeTenant(result)
+	result = c.scopePolicy(result)
 	if len(c.gormScopes) > 0 {
 		for _, v := range c.gormScopes {
 			result = v(result)
 		}
 	}
-	if !c.listService.disableSortOrder {
+	if !c.listService.disableSortOrder && !c.listService.cursorPagination {
 		result = result.Scopes(c.sortOrder)
 	}
 	return result
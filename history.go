@@ -0,0 +1,150 @@
+package cosy
+
+import (
+	"net/http"
+	"reflect"
+
+	"github.com/spf13/cast"
+	"github.com/uozi-tech/cosy/history"
+	"github.com/uozi-tech/cosy/model"
+	"gorm.io/gorm"
+)
+
+// WithHistory records the changes of "create", "modify", "destroy" and "recover" into the model_changes table,
+// the history.Change model must be registered to be migrated
+func (c *Ctx[T]) WithHistory() *Ctx[T] {
+	c.history = true
+	return c
+}
+
+// historyModelName returns the name of the model recorded in the history
+func historyModelName[T any]() string {
+	return reflect.TypeFor[T]().Name()
+}
+
+// historyIgnoredKeys returns the json keys of the associations, which are not recorded in the history
+func (c *Ctx[T]) historyIgnoredKeys() (keys []string) {
+	s := c.schema()
+	if s == nil {
+		return
+	}
+	for _, rel := range s.Relationships.Relations {
+		if rel.Field != nil {
+			keys = append(keys, jsonKeyOf(rel.Field))
+		}
+	}
+	return
+}
+
+// recordHistory writes the change of the record if the history is enabled,
+// a nil before or after means the record doesn't exist before or after the action
+func (c *Ctx[T]) recordHistory(action history.Action, id any, before, after *T) {
+	if err := c.writeHistory(c.Tx, action, id, before, after); err != nil {
+		c.AbortWithError(err)
+	}
+}
+
+// writeHistory writes the change of the record by tx if the history is enabled
+func (c *Ctx[T]) writeHistory(tx *gorm.DB, action history.Action, id any, before, after *T) error {
+	if !c.history {
+		return nil
+	}
+
+	var from, to any
+	if before != nil {
+		from = before
+	}
+	if after != nil {
+		to = after
+	}
+	diff, err := history.DiffOf(from, to, c.historyIgnoredKeys()...)
+	if err != nil {
+		return err
+	}
+	// nothing is changed
+	if len(diff) == 0 {
+		return nil
+	}
+
+	return history.Record(tx, c.Context, &history.Change{
+		Model:    historyModelName[T](),
+		RecordID: cast.ToString(id),
+		Action:   action,
+		Diff:     diff,
+	})
+}
+
+// primaryKeyOf returns the value of the primary key of the record
+func (c *Ctx[T]) primaryKeyOf(record *T) any {
+	s := c.schema()
+	if s == nil || s.PrioritizedPrimaryField == nil {
+		return nil
+	}
+	value, _ := s.PrioritizedPrimaryField.ValueOf(c.Request.Context(), reflect.ValueOf(record).Elem())
+	return value
+}
+
+// History responds the changes of the record in pages, the latest first
+func (c *Ctx[T]) History() {
+	id := c.GetParamID()
+	page, offset, pageSize := GetPagingParams(c.Context)
+
+	// the record must be visible to the request, the deleted records are included
+	if c.tenantScopeField() != nil || policyOf[T]() != nil {
+		c.resolveTenant()
+		if c.abort {
+			return
+		}
+		tx := c.Tx.Unscoped().Model(new(T))
+		if c.table != "" {
+			tx = tx.Table(c.table, c.tableArgs...)
+		}
+		var count int64
+		if err := c.scopePolicy(c.scopeTenant(tx)).Where("id = ?", id).Count(&count).Error; err != nil {
+			c.AbortWithError(err)
+			return
+		}
+		if count == 0 {
+			c.AbortWithError(gorm.ErrRecordNotFound)
+			return
+		}
+	}
+
+	tx := model.UseDB(c.Context).Model(&history.Change{}).Where(&history.Change{
+		Model:    historyModelName[T](),
+		RecordID: cast.ToString(id),
+	})
+
+	var total int64
+	if err := tx.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		c.AbortWithError(err)
+		return
+	}
+
+	changes := make([]history.Change, 0)
+	err := tx.Session(&gorm.Session{}).Order("id desc").Offset(offset).Limit(pageSize).Find(&changes).Error
+	if err != nil {
+		c.AbortWithError(err)
+		return
+	}
+
+	// the changes of the fields which can't be read by the request are dropped
+	unreadable := c.unreadableKeys()
+	for i := range changes {
+		for key := range changes[i].Diff {
+			if unreadable[key] {
+				delete(changes[i].Diff, key)
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, model.DataList{
+		Data: changes,
+		Pagination: model.Pagination{
+			Total:       total,
+			PerPage:     pageSize,
+			CurrentPage: page,
+			TotalPages:  model.TotalPage(total, pageSize),
+		},
+	})
+}
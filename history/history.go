@@ -0,0 +1,155 @@
+package history
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/uozi-tech/cosy/logger"
+	"gorm.io/gorm"
+)
+
+// Action is the action which changes the record
+type Action string
+
+const (
+	ActionCreate  Action = "create"
+	ActionUpdate  Action = "update"
+	ActionDelete  Action = "delete"
+	ActionRecover Action = "recover"
+)
+
+// FieldChange is the change of a field, From is nil for "create" and To is nil for "delete"
+type FieldChange struct {
+	From any `json:"from"`
+	To   any `json:"to"`
+}
+
+// Diff is the changes of the fields keyed by the json keys, it's stored as JSON text
+type Diff map[string]FieldChange
+
+// Value implements driver.Valuer
+func (d Diff) Value() (driver.Value, error) {
+	b, err := json.Marshal(d)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// Scan implements sql.Scanner
+func (d *Diff) Scan(src any) error {
+	var b []byte
+	switch v := src.(type) {
+	case nil:
+		*d = nil
+		return nil
+	case string:
+		b = []byte(v)
+	case []byte:
+		b = v
+	default:
+		return errors.New("history: unsupported type of diff")
+	}
+	return json.Unmarshal(b, d)
+}
+
+// Change is a row of the model_changes table, it records a change of a record
+type Change struct {
+	ID        uint64    `gorm:"primaryKey" json:"id"`
+	Model     string    `gorm:"type:varchar(255);index:idx_model_changes_record" json:"model"`
+	RecordID  string    `gorm:"type:varchar(255);index:idx_model_changes_record" json:"record_id"`
+	Action    Action    `gorm:"type:varchar(16)" json:"action"`
+	ActorID   string    `gorm:"type:varchar(255);index" json:"actor_id"`
+	RequestID string    `gorm:"type:varchar(255)" json:"request_id"`
+	Diff      Diff      `gorm:"type:text" json:"diff"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+}
+
+// TableName returns the table name of Change
+func (Change) TableName() string {
+	return "model_changes"
+}
+
+var actorResolver func(c *gin.Context) string
+
+// SetActorResolver sets the function to resolve the id of the current user from the request
+func SetActorResolver(resolver func(c *gin.Context) string) {
+	actorResolver = resolver
+}
+
+// ResolveActor returns the id of the current user, it's empty if no resolver is set
+func ResolveActor(c *gin.Context) string {
+	if actorResolver == nil || c == nil {
+		return ""
+	}
+	return actorResolver(c)
+}
+
+// DiffOf returns the changes of the fields between two versions of a record,
+// the records are compared by their JSON representations, so the fields hidden by json:"-" are not recorded.
+// A nil record means the record doesn't exist, e.g. before "create" or after "delete".
+func DiffOf(before, after any, ignore ...string) (Diff, error) {
+	from, err := toMap(before)
+	if err != nil {
+		return nil, err
+	}
+	to, err := toMap(after)
+	if err != nil {
+		return nil, err
+	}
+	for _, key := range ignore {
+		delete(from, key)
+		delete(to, key)
+	}
+
+	diff := make(Diff)
+	for key, value := range to {
+		if old, ok := from[key]; !ok || !reflect.DeepEqual(old, value) {
+			diff[key] = FieldChange{From: from[key], To: value}
+		}
+	}
+	for key, old := range from {
+		if _, ok := to[key]; !ok {
+			diff[key] = FieldChange{From: old}
+		}
+	}
+	return diff, nil
+}
+
+func toMap(record any) (map[string]any, error) {
+	m := make(map[string]any)
+	if record == nil {
+		return m, nil
+	}
+	if v := reflect.ValueOf(record); v.Kind() == reflect.Pointer && v.IsNil() {
+		return m, nil
+	}
+
+	b, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	if err = decoder.Decode(&m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Record writes the change with the actor and the request id of the request,
+// the change is written by a new session of tx, so that it's in the same transaction of tx
+func Record(tx *gorm.DB, c *gin.Context, change *Change) error {
+	if c != nil {
+		change.ActorID = ResolveActor(c)
+		if id, ok := c.Get(logger.CosyRequestIDKey); ok {
+			change.RequestID, _ = id.(string)
+		}
+	}
+	return tx.Session(&gorm.Session{NewDB: true}).Create(change).Error
+}
@@ -0,0 +1,70 @@
+package history
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type diffRecord struct {
+	ID       uint64 `json:"id"`
+	Name     string `json:"name"`
+	Age      int    `json:"age"`
+	Password string `json:"-"`
+	Group    any    `json:"group"`
+}
+
+func TestDiffOf(t *testing.T) {
+	before := &diffRecord{ID: 1, Name: "Alice", Age: 18, Password: "secret"}
+	after := &diffRecord{ID: 1, Name: "Bob", Age: 18, Password: "changed", Group: "admin"}
+
+	diff, err := DiffOf(before, after, "group")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, Diff{"name": {From: "Alice", To: "Bob"}}, diff)
+
+	// create
+	diff, err = DiffOf(nil, after, "group")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, diff, 3)
+	assert.Nil(t, diff["name"].From)
+	assert.Equal(t, json.Number("18"), diff["age"].To)
+
+	// delete
+	var none *diffRecord
+	diff, err = DiffOf(before, none, "group")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(t, diff, 3)
+	assert.Equal(t, "Alice", diff["name"].From)
+	assert.Nil(t, diff["name"].To)
+
+	// nothing is changed
+	diff, err = DiffOf(before, before)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(t, diff)
+}
+
+func TestDiffValueScan(t *testing.T) {
+	diff := Diff{"name": {From: "Alice", To: "Bob"}}
+	value, err := diff.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.JSONEq(t, `{"name":{"from":"Alice","to":"Bob"}}`, value.(string))
+
+	var scanned Diff
+	assert.NoError(t, scanned.Scan([]byte(value.(string))))
+	assert.Equal(t, diff, scanned)
+
+	assert.NoError(t, scanned.Scan(nil))
+	assert.Nil(t, scanned)
+	assert.Error(t, scanned.Scan(1))
+}
@@ -0,0 +1,228 @@
+package cosy
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/bsm/redislock"
+	"github.com/gin-gonic/gin"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/uozi-tech/cosy/logger"
+	"github.com/uozi-tech/cosy/redis"
+)
+
+const (
+	// IdempotencyKeyHeader is the header of the idempotency key of the request
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayedHeader is set to "true" on the replayed responses
+	IdempotentReplayedHeader = "Idempotent-Replayed"
+)
+
+const (
+	// idempotencyLockTTL is the time to live of the lock of the key while the first request is processed,
+	// the lock is refreshed until the request is finished, and the duplicated requests wait for the lock
+	// for at most the ttl
+	idempotencyLockTTL = 30 * time.Second
+	// idempotencyWaitInterval is the interval of retrying the lock
+	idempotencyWaitInterval = 50 * time.Millisecond
+)
+
+// ErrIdempotencyKeyReused is responded with 422 when the idempotency key is reused with a different request
+var ErrIdempotencyKeyReused = &Error{
+	Code:    http.StatusUnprocessableEntity,
+	Message: "idempotency key is reused with a different request",
+}
+
+// ErrIdempotencyKeyInProgress is responded with 409 when the request of the idempotency key
+// is still being processed after the duplicated request has waited for the lock
+var ErrIdempotencyKeyInProgress = &Error{
+	Code:    http.StatusConflict,
+	Message: "request of the idempotency key is in progress",
+}
+
+// idempotencyRecord is the stored response of the first request of the idempotency key
+type idempotencyRecord struct {
+	Fingerprint string      `json:"fingerprint"`
+	Status      int         `json:"status"`
+	Header      http.Header `json:"header"`
+	Body        []byte      `json:"body"`
+}
+
+// idempotencyWriter records the body of the response
+type idempotencyWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *idempotencyWriter) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *idempotencyWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// idempotencyKey returns the key of the stored response, the idempotency keys are scoped to
+// the method, the path and the tenant of the request
+func idempotencyKey(c *gin.Context, key string) string {
+	var tenant any
+	if tenantResolver != nil {
+		tenant, _ = tenantResolver(c)
+	}
+	hash := sha256.Sum256(fmt.Appendf(nil, "%s\x00%s\x00%v\x00%s", c.Request.Method, c.Request.URL.Path, tenant, key))
+	return "idempotency:" + hex.EncodeToString(hash[:])
+}
+
+// idempotencyFingerprint returns the fingerprint of the request, the key can't be reused with
+// a request with another query or body
+func idempotencyFingerprint(c *gin.Context, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(c.Request.URL.Query().Encode()))
+	hash.Write([]byte{0})
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// replayIdempotency responds the stored response of the key, true means the request is responded
+func replayIdempotency(c *gin.Context, key string, fingerprint string) bool {
+	value, err := redis.Get(key)
+	if err != nil {
+		if !errors.Is(err, goredis.Nil) {
+			logger.Error(err)
+		}
+		return false
+	}
+
+	var record idempotencyRecord
+	if err := json.Unmarshal([]byte(value), &record); err != nil {
+		logger.Error(err)
+		return false
+	}
+
+	if record.Fingerprint != fingerprint {
+		c.JSON(http.StatusUnprocessableEntity, ErrIdempotencyKeyReused)
+		c.Abort()
+		return true
+	}
+
+	for name, values := range record.Header {
+		c.Writer.Header()[name] = values
+	}
+	c.Header(IdempotentReplayedHeader, "true")
+	c.Writer.WriteHeader(record.Status)
+	_, _ = c.Writer.Write(record.Body)
+	c.Abort()
+	return true
+}
+
+// refreshIdempotencyLock extends the lock until done is closed, so that the lock isn't expired
+// while the request runs longer than the ttl, and the duplicates can't process it again
+func refreshIdempotencyLock(lock *redislock.Lock, done <-chan struct{}) {
+	ticker := time.NewTicker(idempotencyLockTTL / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			if err := lock.Refresh(context.Background(), idempotencyLockTTL, nil); err != nil {
+				logger.Error(err)
+				return
+			}
+		}
+	}
+}
+
+// Idempotency returns a middleware which stores the first response (status, headers and body) of the requests
+// with the Idempotency-Key header in redis for the ttl, the retries with the same key get the stored response
+// replayed, and the concurrent duplicates wait for the first request to be finished. Reusing the key with a
+// different request is responded with 422. The server errors are not stored, so that they can be retried.
+// The requests without the header are processed as usual, and so are all the requests if redis isn't initialized.
+func Idempotency(ttl time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		header := c.GetHeader(IdempotencyKeyHeader)
+		if header == "" || redis.GetClient() == nil {
+			c.Next()
+			return
+		}
+
+		var body []byte
+		if c.Request.Body != nil {
+			var err error
+			if body, err = io.ReadAll(c.Request.Body); err != nil {
+				errHandler(c, err)
+				c.Abort()
+				return
+			}
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		key := idempotencyKey(c, header)
+		fingerprint := idempotencyFingerprint(c, body)
+		if replayIdempotency(c, key, fingerprint) {
+			return
+		}
+
+		lock, err := redis.ObtainLock(key+":lock", idempotencyLockTTL, &redislock.Options{
+			RetryStrategy: redislock.LimitRetry(redislock.LinearBackoff(idempotencyWaitInterval),
+				int(idempotencyLockTTL/idempotencyWaitInterval)),
+		})
+		if errors.Is(err, redislock.ErrNotObtained) {
+			c.JSON(http.StatusConflict, ErrIdempotencyKeyInProgress)
+			c.Abort()
+			return
+		}
+		if err != nil {
+			logger.Error(err)
+			c.Next()
+			return
+		}
+		defer func() {
+			if err := lock.Release(context.Background()); err != nil && !errors.Is(err, redislock.ErrLockNotHeld) {
+				logger.Error(err)
+			}
+		}()
+
+		// the first request may be finished while waiting for the lock
+		if replayIdempotency(c, key, fingerprint) {
+			return
+		}
+
+		done := make(chan struct{})
+		defer close(done)
+		go refreshIdempotencyLock(lock, done)
+
+		writer := &idempotencyWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		c.Next()
+		c.Writer = writer.ResponseWriter
+
+		if writer.Status() >= http.StatusInternalServerError {
+			return
+		}
+
+		value, err := json.Marshal(idempotencyRecord{
+			Fingerprint: fingerprint,
+			Status:      writer.Status(),
+			Header:      writer.Header().Clone(),
+			Body:        writer.body.Bytes(),
+		})
+		if err != nil {
+			logger.Error(err)
+			return
+		}
+		if err := redis.Set(key, value, ttl); err != nil {
+			logger.Error(err)
+		}
+	}
+}
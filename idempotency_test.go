@@ -0,0 +1,145 @@
+package cosy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/gin-gonic/gin"
+	goredis "github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/uozi-tech/cosy/redis"
+)
+
+func newIdempotencyContext(method string, target string, body string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(method, target, strings.NewReader(body))
+	return c
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	c := newIdempotencyContext(http.MethodPost, "/orders", "")
+	key := idempotencyKey(c, "a")
+	assert.Equal(t, key, idempotencyKey(c, "a"))
+	assert.NotEqual(t, key, idempotencyKey(c, "b"))
+	assert.NotEqual(t, key, idempotencyKey(newIdempotencyContext(http.MethodPost, "/payments", ""), "a"))
+
+	// scoped to the tenant
+	SetTenantResolver(func(c *gin.Context) (any, bool) {
+		tenant := c.GetHeader("X-Tenant")
+		return tenant, tenant != ""
+	})
+	defer SetTenantResolver(nil)
+	c.Request.Header.Set("X-Tenant", "1")
+	assert.NotEqual(t, key, idempotencyKey(c, "a"))
+}
+
+func TestIdempotencyFingerprint(t *testing.T) {
+	fingerprint := idempotencyFingerprint(newIdempotencyContext(http.MethodPost, "/orders", ""), []byte(`{"a":1}`))
+	assert.Equal(t, fingerprint, idempotencyFingerprint(newIdempotencyContext(http.MethodPost, "/orders", ""), []byte(`{"a":1}`)))
+	assert.NotEqual(t, fingerprint, idempotencyFingerprint(newIdempotencyContext(http.MethodPost, "/orders", ""), []byte(`{"a":2}`)))
+	assert.NotEqual(t, fingerprint, idempotencyFingerprint(newIdempotencyContext(http.MethodPost, "/orders?a=1", ""), []byte(`{"a":1}`)))
+}
+
+func TestIdempotencyWithoutRedis(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	count := 0
+	r.POST("/orders", Idempotency(time.Hour), func(c *gin.Context) {
+		count++
+		c.JSON(http.StatusOK, gin.H{"count": count})
+	})
+
+	for range 2 {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, "/orders", strings.NewReader(`{}`))
+		req.Header.Set(IdempotencyKeyHeader, "a")
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Empty(t, w.Header().Get(IdempotentReplayedHeader))
+	}
+	// the requests are processed as usual
+	assert.Equal(t, 2, count)
+}
+
+func TestIdempotency(t *testing.T) {
+	m := miniredis.RunT(t)
+	redis.SetClient(goredis.NewClient(&goredis.Options{Addr: m.Addr()}))
+	defer redis.SetClient(nil)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	var (
+		mu      sync.Mutex
+		count   int
+		started = make(chan struct{}, 1)
+		release = make(chan struct{})
+	)
+	r.POST("/orders", Idempotency(time.Hour), func(c *gin.Context) {
+		mu.Lock()
+		count++
+		n := count
+		mu.Unlock()
+		if c.Query("wait") != "" {
+			started <- struct{}{}
+			<-release
+		}
+		if c.Query("fail") != "" {
+			c.JSON(http.StatusInternalServerError, gin.H{"count": n})
+			return
+		}
+		c.Header("X-Count", "1")
+		c.JSON(http.StatusCreated, gin.H{"count": n})
+	})
+
+	request := func(key string, target string, body string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodPost, target, strings.NewReader(body))
+		req.Header.Set(IdempotencyKeyHeader, key)
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	// the retries get the stored response replayed
+	w := request("a", "/orders", `{"a":1}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Empty(t, w.Header().Get(IdempotentReplayedHeader))
+	w = request("a", "/orders", `{"a":1}`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "true", w.Header().Get(IdempotentReplayedHeader))
+	assert.Equal(t, "1", w.Header().Get("X-Count"))
+	assert.JSONEq(t, `{"count":1}`, w.Body.String())
+	assert.Equal(t, 1, count)
+
+	// the key is reused with a different request
+	w = request("a", "/orders", `{"a":2}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+	assert.Equal(t, 1, count)
+
+	// the server errors are not stored
+	assert.Equal(t, http.StatusInternalServerError, request("b", "/orders?fail=1", `{}`).Code)
+	assert.Equal(t, http.StatusInternalServerError, request("b", "/orders?fail=1", `{}`).Code)
+	assert.Equal(t, 3, count)
+
+	// the concurrent duplicate waits for the first request, and gets its response replayed
+	first := make(chan *httptest.ResponseRecorder)
+	go func() { first <- request("c", "/orders?wait=1", `{}`) }()
+	<-started
+	second := make(chan *httptest.ResponseRecorder)
+	go func() { second <- request("c", "/orders?wait=1", `{}`) }()
+	time.Sleep(5 * idempotencyWaitInterval)
+	close(release)
+
+	w = <-first
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.JSONEq(t, `{"count":4}`, w.Body.String())
+	w = <-second
+	assert.Equal(t, http.StatusCreated, w.Code)
+	assert.Equal(t, "true", w.Header().Get(IdempotentReplayedHeader))
+	assert.JSONEq(t, `{"count":4}`, w.Body.String())
+	assert.Equal(t, 4, count)
+}
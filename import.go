@@ -0,0 +1,312 @@
+package cosy
+
+import (
+	"errors"
+	"io"
+	"maps"
+	"net/http"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cast"
+	"github.com/uozi-tech/cosy/export"
+	"github.com/uozi-tech/cosy/map2struct"
+	"github.com/uozi-tech/cosy/model"
+)
+
+// DefaultImportLimit is the default maximum count of rows of an import
+const DefaultImportLimit = 10000
+
+// ImportRowError is the errors of a row of the imported file
+type ImportRowError struct {
+	// Row is the 1-based row number of the file, the header is the first row
+	Row    int   `json:"row"`
+	Errors gin.H `json:"errors"`
+}
+
+// ImportReport is the response of Import
+type ImportReport struct {
+	Total    int              `json:"total"`
+	Imported int              `json:"imported"`
+	Failed   int              `json:"failed"`
+	Errors   []ImportRowError `json:"errors"`
+}
+
+// SetImportLimit sets the maximum count of rows of the import, negative means no limit
+func (c *Ctx[T]) SetImportLimit(limit int) *Ctx[T] {
+	c.importLimit = limit
+	return c
+}
+
+// importHeaderKeys maps the header of the file to the json keys of the model,
+// a header can be the json key, the cosy json directive or the title of the export directive
+func importHeaderKeys[T any](header []string) []string {
+	titles := make(map[string]string)
+	if resolved := model.GetResolvedModel[T](); resolved != nil {
+		for _, field := range resolved.OrderedFields {
+			key := field.JsonTag
+			if key == "-" || key == "" {
+				key = field.CosyTag.GetJson()
+			}
+			if key == "" {
+				continue
+			}
+			titles[key] = key
+			if title, _ := field.CosyTag.GetExport(); title != "" {
+				titles[title] = key
+			}
+		}
+	}
+
+	keys := make([]string, len(header))
+	for i, v := range header {
+		v = strings.TrimSpace(v)
+		if key, ok := titles[v]; ok {
+			keys[i] = key
+			continue
+		}
+		keys[i] = v
+	}
+	return keys
+}
+
+// importFieldKinds returns the kinds of the fields keyed by the json keys,
+// so that the text of the cells can be converted before the validation
+func importFieldKinds(t reflect.Type, kinds map[string]reflect.Kind) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+
+		key, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if field.Anonymous && key == "" && fieldType.Kind() == reflect.Struct {
+			importFieldKinds(fieldType, kinds)
+			continue
+		}
+		if key == "-" {
+			tag := model.NewCosyTag(field.Tag.Get("cosy"))
+			key = tag.GetJson()
+		}
+		if key == "" {
+			key = field.Name
+		}
+		kinds[key] = fieldType.Kind()
+	}
+}
+
+// importValue converts the text of a cell by the kind of the field, if the text can't be converted,
+// the name of the validator tag of the kind is returned as the error, e.g. "numeric"
+func importValue(text string, kind reflect.Kind) (value any, rule string) {
+	var err error
+	switch kind {
+	case reflect.Bool:
+		value, err = cast.ToBoolE(text)
+		rule = "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		value, err = strconv.ParseInt(text, 10, 64)
+		rule = "number"
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		value, err = strconv.ParseUint(text, 10, 64)
+		rule = "number"
+	case reflect.Float32, reflect.Float64:
+		value, err = strconv.ParseFloat(text, 64)
+		rule = "numeric"
+	default:
+		return text, ""
+	}
+	if err != nil {
+		return text, rule
+	}
+	return value, ""
+}
+
+// readImportFile reads the uploaded file of the "file" form field into payloads,
+// the row numbers and the conversion errors keyed by the index of the payloads are returned as well
+func (c *Ctx[T]) readImportFile() (payloads []map[string]any, rows []int, convErrs map[int]gin.H, errs gin.H) {
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		return nil, nil, nil, gin.H{"file": "required"}
+	}
+
+	format := export.Format(strings.TrimPrefix(strings.ToLower(filepath.Ext(fileHeader.Filename)), "."))
+	if format != export.CSV && format != export.XLSX {
+		return nil, nil, nil, gin.H{"file": "oneof=csv xlsx"}
+	}
+
+	f, err := fileHeader.Open()
+	if err != nil {
+		c.AbortWithError(err)
+		return
+	}
+	defer f.Close()
+
+	reader, err := export.NewReader(format, f, fileHeader.Size)
+	if err != nil {
+		return nil, nil, nil, gin.H{"file": err.Error()}
+	}
+
+	_, header, err := reader.ReadRow()
+	if errors.Is(err, io.EOF) {
+		return nil, nil, nil, gin.H{"file": "required"}
+	}
+	if err != nil {
+		return nil, nil, nil, gin.H{"file": err.Error()}
+	}
+	keys := importHeaderKeys[T](header)
+
+	convErrs = make(map[int]gin.H)
+	kinds := make(map[string]reflect.Kind)
+	importFieldKinds(reflect.TypeFor[T](), kinds)
+
+	limit := c.importLimit
+	if limit == 0 {
+		limit = DefaultImportLimit
+	}
+
+	for {
+		number, values, err := reader.ReadRow()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, nil, nil, gin.H{"file": err.Error()}
+		}
+		if limit > 0 && len(payloads) >= limit {
+			return nil, nil, nil, gin.H{"file": "max=" + strconv.Itoa(limit)}
+		}
+
+		// empty cells are left out, so that they are treated as missing fields
+		payload := make(map[string]any, len(keys))
+		for i, text := range values {
+			if i >= len(keys) || keys[i] == "" || strings.TrimSpace(text) == "" {
+				continue
+			}
+			kind, ok := kinds[keys[i]]
+			if !ok {
+				kind = reflect.String
+			}
+			value, rule := importValue(strings.TrimSpace(text), kind)
+			if rule != "" {
+				if convErrs[len(payloads)] == nil {
+					convErrs[len(payloads)] = make(gin.H)
+				}
+				convErrs[len(payloads)][keys[i]] = rule
+			}
+			payload[keys[i]] = value
+		}
+
+		payloads = append(payloads, payload)
+		rows = append(rows, number)
+	}
+
+	return
+}
+
+// Import creates the records of the rows of an uploaded csv or xlsx file, the file is uploaded
+// by the "file" form field, and the format is detected by the extension of the filename.
+// The rows which pass the validation are inserted in chunks in a transaction, and a report of
+// the errors of the other rows is responded. Nothing is inserted if the "dry_run" query is true.
+func (c *Ctx[T]) Import() {
+	var (
+		rows   []int
+		report ImportReport
+	)
+	dryRun := cast.ToBool(c.Query("dry_run"))
+
+	NewProcessChain(c).
+		SetPrepare(func(ctx *Ctx[T]) {
+			createHook[T]()(ctx)
+			prepareHook(ctx)
+		}).
+		SetValidate(func(ctx *Ctx[T]) {
+			payloads, numbers, convErrs, errs := c.readImportFile()
+			if c.abort {
+				return
+			}
+			if len(errs) > 0 {
+				c.JSON(http.StatusNotAcceptable, NewValidateError(errs))
+				c.Abort()
+				return
+			}
+
+			itemErrs := c.validateItems(payloads)
+			if c.abort {
+				return
+			}
+			for i, errs := range convErrs {
+				if itemErrs[i] == nil {
+					itemErrs[i] = make(gin.H)
+				}
+				maps.Copy(itemErrs[i], errs)
+			}
+
+			report.Total = len(payloads)
+			report.Errors = make([]ImportRowError, 0, len(itemErrs))
+			for i, payload := range payloads {
+				if errs, ok := itemErrs[i]; ok {
+					report.Errors = append(report.Errors, ImportRowError{Row: numbers[i], Errors: errs})
+					continue
+				}
+				c.BatchPayload = append(c.BatchPayload, payload)
+				rows = append(rows, numbers[i])
+			}
+		}).
+		SetBeforeDecode(beforeDecodeHook[T]).
+		SetDecode(func(ctx *Ctx[T]) {
+			c.BatchModels = make([]T, 0, len(c.BatchPayload))
+			for i, payload := range c.BatchPayload {
+				var record T
+				if err := map2struct.WeakDecode(payload, &record); err != nil {
+					rowErr := ImportRowError{Errors: gin.H{"row": err.Error()}}
+					// the payloads may be changed by the BeforeDecode hooks
+					if i < len(rows) {
+						rowErr.Row = rows[i]
+					}
+					report.Errors = append(report.Errors, rowErr)
+					continue
+				}
+				if err := c.setTenant(&record); err != nil {
+					ctx.AbortWithError(err)
+					return
+				}
+				c.BatchModels = append(c.BatchModels, record)
+			}
+		}).
+		SetBeforeExecute(beforeExecuteHook[T]).
+		SetGormAction(func(ctx *Ctx[T]) {
+			for i := range c.BatchModels {
+				c.setTreePath(&c.BatchModels[i])
+				if c.abort {
+					return
+				}
+			}
+			if dryRun || len(c.BatchModels) == 0 {
+				return
+			}
+			if err := c.createBatchModels(); err != nil {
+				ctx.AbortWithError(err)
+				return
+			}
+		}).
+		SetExecuted(executedHook[T]).
+		SetResponse(func(ctx *Ctx[T]) {
+			slices.SortStableFunc(report.Errors, func(a, b ImportRowError) int {
+				return a.Row - b.Row
+			})
+			report.Failed = len(report.Errors)
+			if !dryRun {
+				report.Imported = len(c.BatchModels)
+			}
+			if c.nextHandler != nil {
+				(*c.nextHandler)(c.Context)
+			} else {
+				c.JSON(http.StatusOK, report)
+			}
+		}).CreateOrModify()
+}
@@ -0,0 +1,102 @@
+package cosy
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/uozi-tech/cosy/logger"
+	"github.com/uozi-tech/cosy/model"
+	"gorm.io/driver/sqlite"
+)
+
+func TestImportHeaderKeys(t *testing.T) {
+	model.RegisterModels(exportModel{})
+	model.ResolvedModels()
+
+	assert.Equal(t, []string{"code", "name", "password", "note", "unknown"},
+		importHeaderKeys[exportModel]([]string{"编码", " name ", "password", "note", "unknown"}))
+}
+
+func TestImportValue(t *testing.T) {
+	kinds := make(map[string]reflect.Kind)
+	importFieldKinds(reflect.TypeFor[User](), kinds)
+	assert.Equal(t, reflect.Int, kinds["age"])
+	assert.Equal(t, reflect.String, kinds["password"])
+	assert.Equal(t, reflect.Struct, kinds["employed_at"])
+
+	value, rule := importValue("20", kinds["age"])
+	assert.Equal(t, int64(20), value)
+	assert.Empty(t, rule)
+
+	value, rule = importValue("abc", kinds["age"])
+	assert.Equal(t, "abc", value)
+	assert.Equal(t, "number", rule)
+
+	value, rule = importValue("1.5", reflect.Float64)
+	assert.Equal(t, 1.5, value)
+	assert.Empty(t, rule)
+
+	value, rule = importValue("yes", reflect.Bool)
+	assert.Equal(t, "yes", value)
+	assert.Equal(t, "boolean", rule)
+
+	// the other kinds are decoded by map2struct
+	value, rule = importValue("2024-01-02", kinds["employed_at"])
+	assert.Equal(t, "2024-01-02", value)
+	assert.Empty(t, rule)
+}
+
+type importProduct struct {
+	model.Model
+	Code  string `json:"code" cosy:"add:required;db_unique"`
+	Name  string `json:"name" cosy:"add:required"`
+	Price int    `json:"price" cosy:"add:omitempty,min=0"`
+}
+
+func TestImportValidation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger.Init(gin.TestMode)
+	model.ClearCollection()
+	model.RegisterModels(importProduct{})
+	db := model.Init(sqlite.Open(filepath.Join(t.TempDir(), "import.db")))
+	db.Create(&importProduct{Code: "A0", Name: "existing"})
+
+	r := gin.New()
+	r.POST("/products/import", func(c *gin.Context) {
+		Core[importProduct](c).Import()
+	})
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	file, err := form.CreateFormFile("file", "products.csv")
+	assert.NoError(t, err)
+	_, _ = file.Write([]byte("code,name,price\nA1,apple,3\nA2,,4\nA0,duplicate,5\n"))
+	assert.NoError(t, form.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/products/import", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	var report ImportReport
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &report))
+	assert.Equal(t, 3, report.Total)
+	assert.Equal(t, 1, report.Imported)
+	assert.Equal(t, []ImportRowError{
+		{Row: 3, Errors: gin.H{"name": "required"}},
+		{Row: 4, Errors: gin.H{"code": "db_unique"}},
+	}, report.Errors)
+
+	var names []string
+	db.Model(&importProduct{}).Order("id").Pluck("name", &names)
+	assert.Equal(t, []string{"existing", "apple"}, names)
+}
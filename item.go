@@ -5,11 +5,15 @@ import (
 )
 
 func (c *Ctx[T]) Get() {
+	version := versionField[T]()
 	NewProcessChain(c).
 		SetPrepare(func(ctx *Ctx[T]) {
 			c.ID = c.GetParamID()
 			getHook[T]()(ctx)
 			prepareHook(ctx)
+			if !ctx.abort {
+				ctx.resolveFieldset()
+			}
 		}).
 		SetBeforeExecute(beforeExecuteHook[T]).
 		SetGormAction(func(ctx *Ctx[T]) {
@@ -20,6 +24,7 @@ func (c *Ctx[T]) Get() {
 			c.handleTable()
 			db = c.resolvePreload(db)
 			db = c.resolveJoins(db)
+			db = c.applyFieldset(db)
 
 			// scan into custom struct
 			if c.scan != nil {
@@ -28,6 +33,7 @@ func (c *Ctx[T]) Get() {
 					ctx.AbortWithError(err)
 					return
 				}
+				r = c.pruneWithFieldset(r)
 				c.DefaultResponseData = r
 				c.ResultData = r
 				return
@@ -39,18 +45,28 @@ func (c *Ctx[T]) Get() {
 				return
 			}
 
+			if version != nil {
+				c.setETag(&c.Model, version)
+			}
+
 			// make query result available before ExecutedHook
 			if c.transformer == nil {
-				c.DefaultResponseData = c.Model
-				c.ResultData = c.Model
+				data := c.pruneWithFieldset(c.Model)
+				c.DefaultResponseData = data
+				c.ResultData = data
 				return
 			}
-			transformed := c.transformer(&c.Model)
+			transformed := c.pruneWithFieldset(c.transformer(&c.Model))
 			c.DefaultResponseData = transformed
 			c.ResultData = transformed
 		}).
 		SetExecuted(executedHook[T]).
 		SetResponse(func(ctx *Ctx[T]) {
+			// conditional get, the ETag is set by the query or the cache
+			if etag := c.Writer.Header().Get("ETag"); etag != "" && etagMatch(c.GetHeader("If-None-Match"), etag) {
+				c.Status(http.StatusNotModified)
+				return
+			}
 			c.dispatchQueryResponse(func(ctx *Ctx[T]) {
 				c.JSON(http.StatusOK, c.ResultData)
 			})
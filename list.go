@@ -17,6 +17,7 @@ import (
 type ListService[T any] struct {
 	ctx              *Ctx[T]
 	disableSortOrder bool
+	cursorPagination bool
 	in               []string
 	eq               []string
 	fussy            []string
@@ -24,7 +25,10 @@ type ListService[T any] struct {
 	orEq             []string
 	orFussy          []string
 	search           []string
+	fullText         []string
+	json             []string
 	between          []string
+	filterable       []string
 	customFilters    *orderedmap.OrderedMap[string, string]
 }
 
@@ -103,7 +107,7 @@ func (c *Ctx[T]) result() *gorm.DB {
 func (c *Ctx[T]) resolveData(result *gorm.DB) (data any) {
 	// has scanner
 	if c.scan != nil {
-		return c.scan(result)
+		return c.pruneWithFieldset(c.scan(result))
 	}
 
 	models := make([]*T, 0)
@@ -111,7 +115,7 @@ func (c *Ctx[T]) resolveData(result *gorm.DB) (data any) {
 
 	// no transformer
 	if c.transformer == nil {
-		return models
+		return c.pruneWithFieldset(models)
 	}
 
 	// use transformer
@@ -119,12 +123,15 @@ func (c *Ctx[T]) resolveData(result *gorm.DB) (data any) {
 	for k := range models {
 		transformed = append(transformed, c.transformer(models[k]))
 	}
-	return transformed
+	return c.pruneWithFieldset(transformed)
 }
 
 // ListAllData return list all data
 func (c *Ctx[T]) ListAllData() (data any) {
 	result := c.result()
+	if c.isTreeList() {
+		return c.resolveTreeData(result)
+	}
 	data = c.resolveData(result)
 	return data
 }
@@ -133,6 +140,15 @@ func (c *Ctx[T]) ListAllData() (data any) {
 func (c *Ctx[T]) PagingListData() *model.DataList {
 	result := c.result()
 
+	if c.listService.cursorPagination {
+		return c.cursorPagingListData(result)
+	}
+
+	// the nested list isn't paged
+	if c.isTreeList() {
+		return &model.DataList{Data: c.resolveTreeData(result)}
+	}
+
 	scopesResult := result.Scopes(c.paginate)
 
 	data := &model.DataList{}
@@ -167,6 +183,22 @@ func (c *Ctx[T]) prepareListHook(ctx *Ctx[T]) {
 	ctx.resolvePreloadWithScope()
 	ctx.resolveJoinsWithScopes()
 	prepareHook(ctx)
+	if ctx.abort {
+		return
+	}
+	ctx.refuseUnreadableQueries()
+	if ctx.abort {
+		return
+	}
+	ctx.resolveFilterExpression()
+	if ctx.abort {
+		return
+	}
+	ctx.resolveFieldset()
+	if ctx.fieldset != nil {
+		ctx.GormScope(ctx.applyFieldset)
+	}
+	ctx.resolveTreeFilter()
 }
 
 // PagingList return paging list
@@ -179,6 +211,7 @@ func (c *Ctx[T]) PagingList() {
 			defaultData := model.DataList{
 				Data:       data.Data,
 				Pagination: data.Pagination,
+				Cursor:     data.Cursor,
 			}
 			c.DefaultResponseData = defaultData
 			c.ResultData = defaultData
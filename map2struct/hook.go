@@ -1,6 +1,7 @@
 package map2struct
 
 import (
+	"encoding/json"
 	"reflect"
 	"time"
 
@@ -122,3 +123,30 @@ func ToNullableStringHookFunc() mapstructure.DecodeHookFunc {
 		return data, nil
 	}
 }
+
+// ToJSONHookFunc converts the input data to the json fields, e.g. json.RawMessage and datatypes.JSON,
+// whose underlying type is []byte and which implement json.Unmarshaler. The strings of valid json
+// are kept as they are, and the other data is marshaled.
+func ToJSONHookFunc() mapstructure.DecodeHookFunc {
+	unmarshaler := reflect.TypeFor[json.Unmarshaler]()
+	return func(f reflect.Type, t reflect.Type, data any) (any, error) {
+		if t.Kind() != reflect.Slice || t.Elem().Kind() != reflect.Uint8 || !reflect.PointerTo(t).Implements(unmarshaler) {
+			return data, nil
+		}
+
+		switch v := data.(type) {
+		case []byte:
+			return reflect.ValueOf(v).Convert(t).Interface(), nil
+		case string:
+			if json.Valid([]byte(v)) {
+				return reflect.ValueOf([]byte(v)).Convert(t).Interface(), nil
+			}
+		}
+
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return nil, err
+		}
+		return reflect.ValueOf(raw).Convert(t).Interface(), nil
+	}
+}
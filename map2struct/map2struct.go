@@ -17,6 +17,7 @@ func WeakDecode(input, output any) error {
 			ToTimePtrHookFunc(),
 			ToPgDateHook(),
 			ToPgDatePtrHook(),
+			ToJSONHookFunc(),
 		),
 		TagName: "json",
 		Squash:  true,
@@ -1,7 +1,11 @@
 package model
 
 import (
+	"reflect"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/elliotchance/orderedmap/v3"
 )
@@ -15,6 +19,15 @@ type CosyTag struct {
 	json         string
 	batch        bool
 	unique       bool
+	version      bool
+	tenant       bool
+	aggregate    bool
+	readRoles    []string
+	writeRoles   []string
+	export       bool
+	exportTitle  string
+	retention    time.Duration
+	treeDelete   string
 	customFilter *orderedmap.OrderedMap[string, string]
 }
 
@@ -32,7 +45,7 @@ func NewCosyTag(tag string) (c CosyTag) {
 		// we need to get the right side of :
 		directives := strings.Split(group, ":")
 
-		// fixed for cosy:"batch", cosy:"db_unique"
+		// fixed for cosy:"batch", cosy:"db_unique", cosy:"version", cosy:"tenant", cosy:"aggregate", cosy:"export"
 		if len(directives) == 1 {
 			directives = append(directives, "")
 		}
@@ -48,6 +61,7 @@ func NewCosyTag(tag string) (c CosyTag) {
 		// ["item", "preload"]
 		// ["json", "password"]
 		// ["list", "fussy[sakura]"]
+		// ["read", "role=admin|hr"]
 
 		switch directives[0] {
 		// for "add", "update", "item" directives, we only need the right side
@@ -69,12 +83,61 @@ func NewCosyTag(tag string) (c CosyTag) {
 			c.batch = true
 		case "db_unique":
 			c.unique = true
+		case "version":
+			c.version = true
+		case "tenant":
+			c.tenant = true
+		case "aggregate":
+			c.aggregate = true
+		// for read and write directives, the roles are split by |
+		case "read":
+			c.readRoles = parseRoles(directives[1])
+		case "write":
+			c.writeRoles = parseRoles(directives[1])
+		// for export directive, the right side is the optional column title
+		case "export":
+			c.export = true
+			c.exportTitle = directives[1]
+		// for trash_retention directive, the right side is the retention of the deleted records, e.g. "30d"
+		case "trash_retention":
+			c.retention = parseRetention(directives[1])
+		// for tree_delete directive, the right side is the policy of the children of the deleted node, e.g. "orphan"
+		case "tree_delete":
+			c.treeDelete = directives[1]
 		}
 	}
 
 	return c
 }
 
+// parseRetention parses the retention in days, e.g. "30d", or in the format of time.ParseDuration, e.g. "12h",
+// it's 0 if invalid
+func parseRetention(directive string) time.Duration {
+	if days, ok := strings.CutSuffix(directive, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 {
+			return 0
+		}
+		return time.Duration(n) * 24 * time.Hour
+	}
+	d, err := time.ParseDuration(directive)
+	if err != nil || d <= 0 {
+		return 0
+	}
+	return d
+}
+
+// parseRoles parses the roles of the read and write directives, e.g. "role=admin|hr"
+func parseRoles(directive string) (roles []string) {
+	directive = strings.TrimPrefix(directive, "role=")
+	for role := range strings.SplitSeq(directive, "|") {
+		if role = strings.TrimSpace(role); role != "" {
+			roles = append(roles, role)
+		}
+	}
+	return
+}
+
 // GetAdd returns the add directive
 func (c *CosyTag) GetAdd() string {
 	if c.all == "" {
@@ -116,6 +179,19 @@ func (c *CosyTag) GetItem() string {
 	return c.item
 }
 
+// GetItems returns the item directives split by comma, e.g. "preload,selectable"
+func (c *CosyTag) GetItems() []string {
+	if c.item == "" {
+		return nil
+	}
+	return strings.Split(c.item, ",")
+}
+
+// GetSelectable returns whether the field is allowed in the "fields" query
+func (c *CosyTag) GetSelectable() bool {
+	return slices.Contains(c.GetItems(), "selectable")
+}
+
 // GetList returns the list directive
 func (c *CosyTag) GetList() []string {
 	return c.list
@@ -135,3 +211,63 @@ func (c *CosyTag) GetBatch() bool {
 func (c *CosyTag) GetUnique() bool {
 	return c.unique
 }
+
+// GetVersion returns whether the field is the version of optimistic locking
+func (c *CosyTag) GetVersion() bool {
+	return c.version
+}
+
+// GetTenant returns whether the field is the tenant of the record
+func (c *CosyTag) GetTenant() bool {
+	return c.tenant
+}
+
+// GetAggregate returns whether the field can be grouped or aggregated by the aggregate action
+func (c *CosyTag) GetAggregate() bool {
+	return c.aggregate
+}
+
+// GetReadRoles returns the roles which can read the field, empty means everyone can read it
+func (c *CosyTag) GetReadRoles() []string {
+	return c.readRoles
+}
+
+// GetWriteRoles returns the roles which can write the field, empty means everyone can write it
+func (c *CosyTag) GetWriteRoles() []string {
+	return c.writeRoles
+}
+
+// GetExport returns whether the field is exported and the column title of the export,
+// the title is empty if it's not specified
+func (c *CosyTag) GetExport() (title string, ok bool) {
+	return c.exportTitle, c.export
+}
+
+// GetTrashRetention returns the retention of the deleted records of the model, after which the records
+// are purged permanently, ok is false if it's not specified
+func (c *CosyTag) GetTrashRetention() (retention time.Duration, ok bool) {
+	return c.retention, c.retention > 0
+}
+
+// GetTreeDelete returns the policy of the children of the deleted node of the tree, e.g. "cascade" or "orphan"
+func (c *CosyTag) GetTreeDelete() string {
+	return c.treeDelete
+}
+
+// LookupCosyTag returns the first cosy tag of the fields of the struct for which found returns true,
+// the tags of the embedded structs and of their fields are included, e.g. model.Model `cosy:"trash_retention:30d"`
+func LookupCosyTag(t reflect.Type, found func(tag CosyTag) bool) (CosyTag, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := NewCosyTag(field.Tag.Get("cosy"))
+		if found(tag) {
+			return tag, true
+		}
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			if tag, ok := LookupCosyTag(field.Type, found); ok {
+				return tag, true
+			}
+		}
+	}
+	return CosyTag{}, false
+}
@@ -3,6 +3,7 @@ package model
 import (
 	"github.com/stretchr/testify/assert"
 	"testing"
+	"time"
 )
 
 func TestCosyTag(t *testing.T) {
@@ -33,4 +34,76 @@ func TestCosyTag(t *testing.T) {
 	assert.Equal("in", c.GetList()[0])
 	assert.Equal("search", c.GetList()[1])
 	assert.Equal("preload", c.GetItem())
+
+	tag = "item:preload,selectable;list:preload"
+	c = NewCosyTag(tag)
+	assert.Equal([]string{"preload", "selectable"}, c.GetItems())
+	assert.True(c.GetSelectable())
+
+	tag = "item:preload"
+	c = NewCosyTag(tag)
+	assert.False(c.GetSelectable())
+	assert.False(c.GetVersion())
+
+	tag = "version;json:rev"
+	c = NewCosyTag(tag)
+	assert.True(c.GetVersion())
+	assert.Equal("rev", c.GetJson())
+
+	tag = "export:用户名;list:fussy"
+	c = NewCosyTag(tag)
+	title, ok := c.GetExport()
+	assert.True(ok)
+	assert.Equal("用户名", title)
+
+	tag = "export"
+	c = NewCosyTag(tag)
+	title, ok = c.GetExport()
+	assert.True(ok)
+	assert.Equal("", title)
+
+	tag = "list:fussy"
+	c = NewCosyTag(tag)
+	_, ok = c.GetExport()
+	assert.False(ok)
+	assert.False(c.GetTenant())
+
+	tag = "tenant;list:eq"
+	c = NewCosyTag(tag)
+	assert.True(c.GetTenant())
+	assert.False(c.GetAggregate())
+	assert.Equal([]string{"eq"}, c.GetList())
+	assert.Nil(c.GetReadRoles())
+
+	tag = "aggregate;list:in"
+	c = NewCosyTag(tag)
+	assert.True(c.GetAggregate())
+	assert.Equal([]string{"in"}, c.GetList())
+
+	tag = "read:role=admin|hr;write:role=hr;update:omitempty"
+	c = NewCosyTag(tag)
+	assert.Equal([]string{"admin", "hr"}, c.GetReadRoles())
+	assert.Equal([]string{"hr"}, c.GetWriteRoles())
+	assert.Equal("omitempty", c.GetUpdate())
+
+	tag = "trash_retention:30d"
+	c = NewCosyTag(tag)
+	retention, ok := c.GetTrashRetention()
+	assert.True(ok)
+	assert.Equal(30*24*time.Hour, retention)
+
+	tag = "trash_retention:12h"
+	c = NewCosyTag(tag)
+	retention, ok = c.GetTrashRetention()
+	assert.True(ok)
+	assert.Equal(12*time.Hour, retention)
+
+	tag = "trash_retention:-1d"
+	c = NewCosyTag(tag)
+	_, ok = c.GetTrashRetention()
+	assert.False(ok)
+
+	tag = "tree_delete:orphan"
+	c = NewCosyTag(tag)
+	assert.Equal("orphan", c.GetTreeDelete())
 }
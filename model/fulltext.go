@@ -0,0 +1,155 @@
+package model
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/uozi-tech/cosy/settings"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// FullTextDirective is the list directive of the fields indexed by the full-text search
+const FullTextDirective = "fulltext"
+
+// defaultFullTextLanguage is the text search configuration of postgres if it's not configured
+const defaultFullTextLanguage = "simple"
+
+var fullTextLanguagePattern = regexp.MustCompile(`^[a-z_]+$`)
+
+// FullTextLanguage returns the text search configuration of postgres, e.g. "english",
+// the configuration is inlined into the index expressions, so only the plain names are allowed
+func FullTextLanguage() string {
+	language := settings.DataBaseSettings.FullTextLanguage
+	if !fullTextLanguagePattern.MatchString(language) {
+		return defaultFullTextLanguage
+	}
+	return language
+}
+
+// FullTextTable returns the name of the fts5 virtual table of the table in sqlite
+func FullTextTable(table string) string {
+	return table + "_fts"
+}
+
+// FullTextIndex returns the name of the full-text index of the table in mysql and postgres
+func FullTextIndex(table string) string {
+	return "idx_" + table + "_fulltext"
+}
+
+// FullTextColumns returns the columns of the fields marked with cosy:"list:fulltext"
+func FullTextColumns(s *schema.Schema) (columns []string) {
+	for _, field := range s.Fields {
+		if field.DBName == "" {
+			continue
+		}
+		tag := NewCosyTag(field.Tag.Get("cosy"))
+		if slices.Contains(tag.GetList(), FullTextDirective) {
+			columns = append(columns, field.DBName)
+		}
+	}
+	return
+}
+
+// FullTextVector returns the tsvector expression of the columns in postgres,
+// the index and the queries must use the same expression
+func FullTextVector(stmt *gorm.Statement, table string, columns []string) string {
+	document := make([]string, 0, len(columns))
+	for _, column := range columns {
+		document = append(document, "coalesce("+stmt.Quote(clause.Column{Table: table, Name: column})+"::text, '')")
+	}
+	return "to_tsvector('" + FullTextLanguage() + "'::regconfig, " + strings.Join(document, " || ' ' || ") + ")"
+}
+
+// MigrateFullText creates the full-text indexes of the models with the fields marked with cosy:"list:fulltext",
+// they are the FULLTEXT indexes in mysql, the GIN indexes in postgres and the fts5 virtual tables synchronized
+// by the triggers in sqlite. It's called by Init after the auto migration, and the existing indexes are kept,
+// so the index must be dropped manually after the columns are changed.
+func MigrateFullText(db *gorm.DB, models ...any) error {
+	for _, m := range models {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(m); err != nil {
+			return err
+		}
+		columns := FullTextColumns(stmt.Schema)
+		if len(columns) == 0 {
+			continue
+		}
+
+		var err error
+		switch db.Dialector.Name() {
+		case "mysql":
+			err = migrateMySQLFullText(db, m, stmt, columns)
+		case "postgres":
+			err = migratePostgresFullText(db, stmt, columns)
+		case "sqlite":
+			err = migrateSQLiteFullText(db, stmt, columns)
+		default:
+			err = fmt.Errorf("full-text search is not supported by %s", db.Dialector.Name())
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func migrateMySQLFullText(db *gorm.DB, m any, stmt *gorm.Statement, columns []string) error {
+	index := FullTextIndex(stmt.Table)
+	if db.Migrator().HasIndex(m, index) {
+		return nil
+	}
+
+	quoted := make([]string, 0, len(columns))
+	for _, column := range columns {
+		quoted = append(quoted, stmt.Quote(column))
+	}
+	return db.Exec("CREATE FULLTEXT INDEX " + stmt.Quote(index) + " ON " + stmt.Quote(stmt.Table) +
+		" (" + strings.Join(quoted, ", ") + ")").Error
+}
+
+func migratePostgresFullText(db *gorm.DB, stmt *gorm.Statement, columns []string) error {
+	return db.Exec("CREATE INDEX IF NOT EXISTS " + stmt.Quote(FullTextIndex(stmt.Table)) + " ON " +
+		stmt.Quote(stmt.Table) + " USING GIN (" + FullTextVector(stmt, "", columns) + ")").Error
+}
+
+func migrateSQLiteFullText(db *gorm.DB, stmt *gorm.Statement, columns []string) error {
+	fts := FullTextTable(stmt.Table)
+	if db.Migrator().HasTable(fts) {
+		return nil
+	}
+
+	quote := func(names []string, prefix string) string {
+		quoted := make([]string, 0, len(names))
+		for _, name := range names {
+			quoted = append(quoted, prefix+stmt.Quote(name))
+		}
+		return strings.Join(quoted, ", ")
+	}
+
+	// the fts5 table is an external content table of the table, it's synchronized by the triggers
+	insert := "INSERT INTO " + stmt.Quote(fts) + " (rowid, " + quote(columns, "") + ") VALUES (new.rowid, " + quote(columns, "new.") + ");"
+	remove := "INSERT INTO " + stmt.Quote(fts) + " (" + stmt.Quote(fts) + ", rowid, " + quote(columns, "") + ") VALUES ('delete', old.rowid, " + quote(columns, "old.") + ");"
+	trigger := func(name string, event string, body string) string {
+		return "CREATE TRIGGER " + stmt.Quote(fts+"_"+name) + " AFTER " + event + " ON " + stmt.Quote(stmt.Table) + " BEGIN " + body + " END"
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		for _, sql := range []string{
+			"CREATE VIRTUAL TABLE " + stmt.Quote(fts) + " USING fts5(" + quote(columns, "") + ", content=" + stmt.Quote(stmt.Table) + ")",
+			trigger("ai", "INSERT", insert),
+			trigger("ad", "DELETE", remove),
+			trigger("au", "UPDATE", remove+" "+insert),
+			// index the existing records
+			"INSERT INTO " + stmt.Quote(fts) + " (" + stmt.Quote(fts) + ") VALUES ('rebuild')",
+		} {
+			if err := tx.Exec(sql).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,38 @@
+package model
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uozi-tech/cosy/settings"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type fullTextPost struct {
+	ID    uint64
+	Title string `cosy:"list:fulltext"`
+	Body  string `cosy:"list:fussy,fulltext"`
+	Note  string `cosy:"list:fussy"`
+}
+
+func TestFullText(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{DryRun: true})
+	assert.NoError(t, err)
+
+	stmt := &gorm.Statement{DB: db}
+	assert.NoError(t, stmt.Parse(&fullTextPost{}))
+	columns := FullTextColumns(stmt.Schema)
+	assert.Equal(t, []string{"title", "body"}, columns)
+
+	assert.Equal(t, "simple", FullTextLanguage())
+	settings.DataBaseSettings.FullTextLanguage = "english"
+	defer func() { settings.DataBaseSettings.FullTextLanguage = "" }()
+	assert.Equal(t, "english", FullTextLanguage())
+	assert.Equal(t, "to_tsvector('english'::regconfig, coalesce(`posts`.`title`::text, '') || ' ' || coalesce(`posts`.`body`::text, ''))",
+		FullTextVector(stmt, "posts", columns))
+
+	// the configuration is inlined into the expressions
+	settings.DataBaseSettings.FullTextLanguage = "english'); --"
+	assert.Equal(t, "simple", FullTextLanguage())
+}
@@ -85,6 +85,12 @@ func Init(dialect gorm.Dialector) *gorm.DB {
 		logger.Fatal(err)
 	}
 
+	err = MigrateFullText(db, GenerateAllModel()...)
+
+	if err != nil {
+		logger.Fatal(err)
+	}
+
 	migrate(db, migrationsAfterAutoMigrate)
 
 	ResolvedModels()
@@ -3,6 +3,7 @@ package model
 type DataList struct {
 	Data       any        `json:"data"`
 	Pagination Pagination `json:"pagination,omitempty,omitzero"`
+	Cursor
 }
 
 // TotalPage calculate total page
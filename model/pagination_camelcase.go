@@ -8,3 +8,9 @@ type Pagination struct {
 	CurrentPage int   `json:"currentPage"`
 	TotalPages  int64 `json:"totalPages"`
 }
+
+// Cursor holds the opaque tokens returned by cursor (keyset) pagination
+type Cursor struct {
+	NextCursor string `json:"nextCursor,omitempty"`
+	PrevCursor string `json:"prevCursor,omitempty"`
+}
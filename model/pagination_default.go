@@ -8,3 +8,9 @@ type Pagination struct {
 	CurrentPage int   `json:"current_page"`
 	TotalPages  int64 `json:"total_pages"`
 }
+
+// Cursor holds the opaque tokens returned by cursor (keyset) pagination
+type Cursor struct {
+	NextCursor string `json:"next_cursor,omitempty"`
+	PrevCursor string `json:"prev_cursor,omitempty"`
+}
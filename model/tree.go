@@ -0,0 +1,253 @@
+package model
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+
+	"github.com/spf13/cast"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// The policies of the children of the deleted node, which are set by the tree_delete directive
+// of the cosy tag of the embedded Tree, e.g. model.Tree `cosy:"tree_delete:orphan"`
+const (
+	// TreeDeleteCascade deletes the descendants with the node, it's the default policy
+	TreeDeleteCascade = "cascade"
+	// TreeDeleteOrphan moves the children of the node to the root
+	TreeDeleteOrphan = "orphan"
+)
+
+// ErrTreeCycle is returned by MoveTreeNode if the parent is the node itself or one of its descendants
+var ErrTreeCycle = errors.New("tree: the parent is the node itself or one of its descendants")
+
+// TreeNode is implemented by the models embedding Tree
+type TreeNode interface {
+	TreeNode() *Tree
+}
+
+// Tree is the mixin of the hierarchical models, e.g. the categories, the org charts and the menus.
+// ParentID is the parent of the node, nil means a root. Path is the materialized path of the ancestors
+// from the root, e.g. "/1/5/" for the node whose parent is 5 and grandparent is 1, and "/" for a root.
+// Path and Depth are maintained by SetTreePath and MoveTreeNode, the parent is changed by MoveTreeNode only.
+type Tree struct {
+	ParentID *IDType `json:"parent_id" gorm:"index" cosy:"add:omitempty;list:in"`
+	Path     string  `json:"path" gorm:"size:768;index"`
+	Depth    int     `json:"depth"`
+}
+
+// TreeNode returns the tree of the node
+func (t *Tree) TreeNode() *Tree {
+	return t
+}
+
+// ChildPath returns the path of the children of the node with the id, which is the prefix of the paths
+// of all its descendants
+func (t *Tree) ChildPath(id IDType) string {
+	return t.Path + cast.ToString(id) + "/"
+}
+
+// AncestorIDs returns the ids of the ancestors of the node from the root
+func (t *Tree) AncestorIDs() (ids []IDType) {
+	for item := range strings.SplitSeq(strings.Trim(t.Path, "/"), "/") {
+		if item != "" {
+			ids = append(ids, ParseTreeID(item))
+		}
+	}
+	return
+}
+
+// ParseTreeID converts the id of the path or of the request to IDType
+func ParseTreeID(v any) (id IDType) {
+	switch p := any(&id).(type) {
+	case *uint64:
+		*p = cast.ToUint64(v)
+	case *string:
+		*p = cast.ToString(v)
+	}
+	return
+}
+
+// treeOf returns the tree of the node, it panics if the model doesn't embed Tree
+func treeOf(node any) *Tree {
+	n, ok := node.(TreeNode)
+	if !ok {
+		panic("model: " + reflect.TypeOf(node).String() + " doesn't embed model.Tree")
+	}
+	return n.TreeNode()
+}
+
+// DescendantsOf returns the scope of the descendants of the node with the id, the node itself excluded,
+// e.g. db.Scopes(model.DescendantsOf(node, id)).Find(&nodes)
+func DescendantsOf(node TreeNode, id IDType) func(tx *gorm.DB) *gorm.DB {
+	prefix := node.TreeNode().ChildPath(id)
+	return func(tx *gorm.DB) *gorm.DB {
+		return tx.Where(clause.Like{Column: clause.Column{Table: clause.CurrentTable, Name: "path"}, Value: prefix + "%"})
+	}
+}
+
+// SetTreePath sets the path and the depth of the node by its parent, it's called by cosy before the node
+// is created, and must be called before the node is created in other ways
+func SetTreePath[T any](db *gorm.DB, node *T) error {
+	tree := treeOf(node)
+	if tree.ParentID == nil {
+		tree.Path, tree.Depth = "/", 0
+		return nil
+	}
+
+	var parent T
+	if err := db.Session(&gorm.Session{NewDB: true}).Where("id = ?", *tree.ParentID).Take(&parent).Error; err != nil {
+		return err
+	}
+	p := treeOf(&parent)
+	tree.Path, tree.Depth = p.ChildPath(*tree.ParentID), p.Depth+1
+	return nil
+}
+
+// GetDescendants returns the descendants of the node with the id, ordered by the depth
+func GetDescendants[T any](db *gorm.DB, id IDType) ([]*T, error) {
+	db = db.Session(&gorm.Session{NewDB: true})
+	var node T
+	if err := db.Where("id = ?", id).Take(&node).Error; err != nil {
+		return nil, err
+	}
+
+	descendants := make([]*T, 0)
+	err := db.Scopes(DescendantsOf(treeOf(&node), id)).Order("depth").Order("id").Find(&descendants).Error
+	return descendants, err
+}
+
+// GetAncestors returns the ancestors of the node with the id, from the root
+func GetAncestors[T any](db *gorm.DB, id IDType) ([]*T, error) {
+	db = db.Session(&gorm.Session{NewDB: true})
+	var node T
+	if err := db.Where("id = ?", id).Take(&node).Error; err != nil {
+		return nil, err
+	}
+
+	ancestors := make([]*T, 0)
+	ids := treeOf(&node).AncestorIDs()
+	if len(ids) == 0 {
+		return ancestors, nil
+	}
+	err := db.Where("id IN ?", ids).Order("depth").Find(&ancestors).Error
+	return ancestors, err
+}
+
+// MoveTreeNode moves the node with the id under the parent, nil means moving it to the root, the paths
+// and the depths of its descendants are updated, the deleted descendants included. ErrTreeCycle is returned
+// if the parent is the node itself or one of its descendants. It should be called in a transaction, the node
+// and the parent are locked until the transaction ends, so that the concurrent moves can't make a cycle.
+func MoveTreeNode[T any](db *gorm.DB, id IDType, parentID *IDType) error {
+	db = db.Session(&gorm.Session{NewDB: true})
+	ids := []IDType{id}
+	if parentID != nil {
+		if cast.ToString(*parentID) == cast.ToString(id) {
+			return ErrTreeCycle
+		}
+		ids = append(ids, *parentID)
+	}
+
+	// the rows are locked in the order of the ids, so that the concurrent moves wait instead of deadlocking
+	nodes := make([]*T, 0, len(ids))
+	err := db.Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate}).
+		Where("id IN ?", ids).Order("id").Find(&nodes).Error
+	if err != nil {
+		return err
+	}
+	var node, parent *T
+	for _, n := range nodes {
+		field := reflect.ValueOf(n).Elem().FieldByName("ID")
+		if !field.IsValid() {
+			return errors.New("tree: " + reflect.TypeFor[T]().String() + " has no ID field")
+		}
+		key := cast.ToString(field.Interface())
+		if key == cast.ToString(id) {
+			node = n
+		} else if parentID != nil && key == cast.ToString(*parentID) {
+			parent = n
+		}
+	}
+	if node == nil || (parentID != nil && parent == nil) {
+		return gorm.ErrRecordNotFound
+	}
+	tree := treeOf(node)
+
+	path, depth := "/", 0
+	if parent != nil {
+		p := treeOf(parent)
+		if strings.HasPrefix(p.Path, tree.ChildPath(id)) {
+			return ErrTreeCycle
+		}
+		path, depth = p.ChildPath(*parentID), p.Depth+1
+	}
+
+	err = db.Model(new(T)).Where("id = ?", id).Updates(map[string]any{
+		"parent_id": parentID,
+		"path":      path,
+		"depth":     depth,
+	}).Error
+	if err != nil {
+		return err
+	}
+
+	moved := &Tree{Path: path}
+	return rebaseTree[T](db, tree.ChildPath(id), moved.ChildPath(id), depth-tree.Depth)
+}
+
+// DeleteTreeDescendants deletes the descendants of the node with the id, it's the cascade policy of deleting
+// the node, the descendants are deleted permanently if db is unscoped
+func DeleteTreeDescendants[T any](db *gorm.DB, id IDType) error {
+	tree, err := deletedTreeNode[T](db, id)
+	if err != nil {
+		return err
+	}
+
+	tx := db.Session(&gorm.Session{NewDB: true})
+	if db.Statement.Unscoped {
+		tx = tx.Unscoped()
+	}
+	return tx.Scopes(DescendantsOf(tree, id)).Delete(new(T)).Error
+}
+
+// OrphanTreeChildren moves the children of the node with the id to the root, it's the orphan policy
+// of deleting the node
+func OrphanTreeChildren[T any](db *gorm.DB, id IDType) error {
+	tree, err := deletedTreeNode[T](db, id)
+	if err != nil {
+		return err
+	}
+
+	db = db.Session(&gorm.Session{NewDB: true})
+	if err = db.Unscoped().Model(new(T)).Where("parent_id = ?", id).UpdateColumn("parent_id", nil).Error; err != nil {
+		return err
+	}
+	return rebaseTree[T](db, tree.ChildPath(id), "/", -tree.Depth-1)
+}
+
+// deletedTreeNode returns the tree of the node with the id, the node may be deleted
+func deletedTreeNode[T any](db *gorm.DB, id IDType) (*Tree, error) {
+	var node T
+	err := db.Session(&gorm.Session{NewDB: true}).Unscoped().Where("id = ?", id).Take(&node).Error
+	if err != nil {
+		return nil, err
+	}
+	return treeOf(&node), nil
+}
+
+// rebaseTree replaces the prefix of the paths of the nodes under the prefix, and shifts their depths,
+// the nodes are updated by a single statement. The prefix is a whole path of ids, which appears
+// only at the start of the paths, so it's replaced by REPLACE of all the dialects.
+func rebaseTree[T any](db *gorm.DB, from string, to string, shift int) error {
+	if from == to && shift == 0 {
+		return nil
+	}
+
+	return db.Session(&gorm.Session{NewDB: true}).Unscoped().Model(new(T)).
+		Where(clause.Like{Column: clause.Column{Name: "path"}, Value: from + "%"}).
+		UpdateColumns(map[string]any{
+			"path":  gorm.Expr("REPLACE(path, ?, ?)", from, to),
+			"depth": gorm.Expr("depth + ?", shift),
+		}).Error
+}
@@ -0,0 +1,96 @@
+package model
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cast"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type treeCategory struct {
+	Model
+	Tree
+	Name string `json:"name"`
+}
+
+func treeNames(nodes []*treeCategory) (names []string) {
+	for _, node := range nodes {
+		names = append(names, node.Name)
+	}
+	return
+}
+
+func TestTree(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "tree.db")), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&treeCategory{}))
+
+	create := func(name string, parent *treeCategory) *treeCategory {
+		node := &treeCategory{Name: name}
+		if parent != nil {
+			node.ParentID = &parent.ID
+		}
+		assert.NoError(t, SetTreePath(db, node))
+		assert.NoError(t, db.Create(node).Error)
+		return node
+	}
+	reload := func(node *treeCategory) *treeCategory {
+		var reloaded treeCategory
+		assert.NoError(t, db.Unscoped().Take(&reloaded, "id = ?", node.ID).Error)
+		return &reloaded
+	}
+
+	a := create("a", nil)
+	b := create("b", a)
+	c := create("c", b)
+	d := create("d", nil)
+
+	assert.Equal(t, "/", a.Path)
+	assert.Equal(t, "/"+cast.ToString(a.ID)+"/"+cast.ToString(b.ID)+"/", c.Path)
+	assert.Equal(t, 2, c.Depth)
+	assert.Equal(t, []IDType{a.ID, b.ID}, c.AncestorIDs())
+
+	descendants, err := GetDescendants[treeCategory](db, a.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b", "c"}, treeNames(descendants))
+
+	ancestors, err := GetAncestors[treeCategory](db, c.ID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, treeNames(ancestors))
+
+	// the node can't be moved under itself or its descendants
+	assert.ErrorIs(t, MoveTreeNode[treeCategory](db, a.ID, &a.ID), ErrTreeCycle)
+	assert.ErrorIs(t, MoveTreeNode[treeCategory](db, a.ID, &c.ID), ErrTreeCycle)
+
+	// the descendants are moved with the node
+	assert.NoError(t, MoveTreeNode[treeCategory](db, b.ID, &d.ID))
+	c = reload(c)
+	assert.Equal(t, d.ID, *reload(b).ParentID)
+	assert.Equal(t, "/"+cast.ToString(d.ID)+"/"+cast.ToString(b.ID)+"/", c.Path)
+	assert.Equal(t, 2, c.Depth)
+
+	assert.NoError(t, MoveTreeNode[treeCategory](db, b.ID, nil))
+	c = reload(c)
+	assert.Nil(t, reload(b).ParentID)
+	assert.Equal(t, "/"+cast.ToString(b.ID)+"/", c.Path)
+	assert.Equal(t, 1, c.Depth)
+
+	// the children are moved to the root by the orphan policy
+	e := create("e", c)
+	assert.NoError(t, OrphanTreeChildren[treeCategory](db, b.ID))
+	c, e = reload(c), reload(e)
+	assert.Nil(t, c.ParentID)
+	assert.Equal(t, "/", c.Path)
+	assert.Equal(t, 0, c.Depth)
+	assert.Equal(t, "/"+cast.ToString(c.ID)+"/", e.Path)
+	assert.Equal(t, 1, e.Depth)
+
+	// the descendants are deleted by the cascade policy, permanently if db is unscoped
+	assert.NoError(t, DeleteTreeDescendants[treeCategory](db, c.ID))
+	assert.NotNil(t, reload(e).DeletedAt)
+	assert.NoError(t, DeleteTreeDescendants[treeCategory](db.Unscoped(), c.ID))
+	assert.ErrorIs(t, db.Unscoped().Take(&treeCategory{}, "id = ?", e.ID).Error, gorm.ErrRecordNotFound)
+}
@@ -0,0 +1,65 @@
+package openapi
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/uozi-tech/cosy"
+	"github.com/uozi-tech/cosy/model"
+)
+
+// ErrNoRoute is returned by Generate when no route is registered, e.g. the routers aren't initialized
+var ErrNoRoute = errors.New("openapi: no route is registered, initialize the routers before generating the document")
+
+// Generate writes the OpenAPI document of the registered routes by the flags of the command, e.g. -output.
+// It's called by the generator command of the project after the routers are initialized by InitRouter,
+// see cmd/openapi/generate.go. ErrNoRoute is returned if no route is registered, and nothing is written.
+func Generate() error {
+	var (
+		output      string
+		title       string
+		version     string
+		description string
+		server      string
+	)
+
+	flag.StringVar(&output, "output", "openapi.json", "Output file path")
+	flag.StringVar(&title, "title", "API", "Title of the API")
+	flag.StringVar(&version, "version", "1.0.0", "Version of the API")
+	flag.StringVar(&description, "description", "", "Description of the API")
+	flag.StringVar(&server, "server", "", "Server URL")
+	flag.Parse()
+
+	apis := cosy.RegisteredApis()
+	if len(apis) == 0 {
+		return ErrNoRoute
+	}
+
+	// the cosy tags are resolved on database initialization, which is not required here
+	model.ResolvedModels()
+
+	doc := Build(Info{
+		Title:       title,
+		Description: description,
+		Version:     version,
+	}, apis)
+	if server != "" {
+		doc.Servers = []Server{{URL: server}}
+	}
+
+	buf, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return fmt.Errorf("openapi: marshal the document: %w", err)
+	}
+
+	if err = os.WriteFile(output, buf, 0644); err != nil {
+		return fmt.Errorf("openapi: write to %s: %w", output, err)
+	}
+
+	log.Printf("[Generated] OpenAPI %s, %d paths\n", output, len(doc.Paths))
+	return nil
+}
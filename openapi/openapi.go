@@ -0,0 +1,551 @@
+package openapi
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/uozi-tech/cosy"
+	"github.com/uozi-tech/cosy/filter"
+	"github.com/uozi-tech/cosy/history"
+	"github.com/uozi-tech/cosy/model"
+)
+
+// generator builds a single OpenAPI document
+type generator struct {
+	doc          *Document
+	operationIDs map[string]int
+}
+
+// Build builds the OpenAPI document of the routes registered by Curd.InitRouter
+func Build(info Info, apis []*cosy.ApiDescriptor) *Document {
+	g := &generator{
+		doc: &Document{
+			OpenAPI: Version,
+			Info:    info,
+			Paths:   make(map[string]*PathItem),
+			Components: Components{
+				Schemas:   make(map[string]*Schema),
+				Responses: make(map[string]*Response),
+			},
+		},
+		operationIDs: make(map[string]int),
+	}
+
+	g.errorResponses()
+	for _, api := range apis {
+		g.addApi(api)
+	}
+
+	return g.doc
+}
+
+// errorResponses registers the error responses shared by all the operations
+func (g *generator) errorResponses() {
+	errorSchema := g.schemaOf(reflect.TypeFor[cosy.Error]())
+	g.doc.Components.Responses["NotFound"] = &Response{
+		Description: "Record not found",
+		Content:     jsonContent(errorSchema),
+	}
+	g.doc.Components.Responses["ValidateError"] = &Response{
+		Description: "Requested with wrong parameters",
+		Content:     jsonContent(g.schemaOf(reflect.TypeFor[cosy.ValidateError]())),
+	}
+	g.doc.Components.Responses["ServerError"] = &Response{
+		Description: "Server error",
+		Content:     jsonContent(errorSchema),
+	}
+}
+
+func responseRef(name string) *Response {
+	return &Response{Ref: "#/components/responses/" + name}
+}
+
+// ginPath converts the gin path parameters into the OpenAPI form, e.g. /users/:id -> /users/{id}
+func ginPath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			segments[i] = "{" + segment[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/")
+}
+
+// operationID returns a unique operation id, the same model may be registered on several paths
+func (g *generator) operationID(id string) string {
+	g.operationIDs[id]++
+	if n := g.operationIDs[id]; n > 1 {
+		return fmt.Sprintf("%s%d", id, n)
+	}
+	return id
+}
+
+func (g *generator) pathItem(path string) *PathItem {
+	path = ginPath(path)
+	item, ok := g.doc.Paths[path]
+	if !ok {
+		item = &PathItem{}
+		g.doc.Paths[path] = item
+	}
+	return item
+}
+
+func (g *generator) addApi(api *cosy.ApiDescriptor) {
+	t := api.Model
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+
+	var resolved *model.ResolvedModel
+	if api.Resolved != nil {
+		resolved = api.Resolved()
+	}
+
+	name := schemaName(t)
+	item := g.schemaOf(t)
+	idParam := &Parameter{
+		Name:     "id",
+		In:       "path",
+		Required: true,
+		Schema:   g.schemaOf(reflect.TypeFor[model.IDType]()),
+	}
+	tags := []string{name}
+
+	if api.HasOperation(cosy.OperationGet) {
+		op := &Operation{
+			OperationID: g.operationID("get" + name),
+			Summary:     "Get " + name,
+			Tags:        tags,
+			Parameters:  []*Parameter{idParam},
+			Responses: map[string]*Response{
+				"200": {Description: "OK", Content: jsonContent(item)},
+				"404": responseRef("NotFound"),
+				"406": responseRef("ValidateError"),
+				"500": responseRef("ServerError"),
+			},
+		}
+		if p := fieldsParameter(resolved); p != nil {
+			op.Parameters = append(op.Parameters, p)
+		}
+		g.pathItem(api.Path + "/:id").Get = op
+	}
+
+	if api.HasOperation(cosy.OperationGetList) {
+		g.pathItem(api.Path).Get = &Operation{
+			OperationID: g.operationID("get" + name + "List"),
+			Summary:     "Get " + name + " list",
+			Tags:        tags,
+			Parameters:  g.listParameters(t, resolved),
+			Responses: map[string]*Response{
+				"200": {Description: "OK", Content: jsonContent(g.dataListSchema(item))},
+				"406": responseRef("ValidateError"),
+				"500": responseRef("ServerError"),
+			},
+		}
+	}
+
+	var createParams []*Parameter
+	if api.Idempotent {
+		createParams = append(createParams, &Parameter{
+			Name:        cosy.IdempotencyKeyHeader,
+			In:          "header",
+			Description: "The response of the first request with the key is replayed to the retries",
+			Schema:      &Schema{Type: "string"},
+		})
+	}
+
+	if api.HasOperation(cosy.OperationCreate) {
+		g.pathItem(api.Path).Post = &Operation{
+			OperationID: g.operationID("create" + name),
+			Summary:     "Create " + name,
+			Tags:        tags,
+			Parameters:  createParams,
+			RequestBody: g.requestBody(t, resolved, (*model.CosyTag).GetAdd),
+			Responses: map[string]*Response{
+				"200": {Description: "OK", Content: jsonContent(item)},
+				"406": responseRef("ValidateError"),
+				"500": responseRef("ServerError"),
+			},
+		}
+	}
+
+	if api.HasOperation(cosy.OperationBatchCreate) {
+		op := &Operation{
+			OperationID: g.operationID("batchCreate" + name),
+			Summary:     "Batch create " + name,
+			Tags:        tags,
+			Parameters:  createParams,
+			Responses: map[string]*Response{
+				"200": {Description: "OK", Content: jsonContent(&Schema{
+					Type: "object",
+					Properties: map[string]*Schema{
+						"data": {Type: "array", Items: item},
+					},
+				})},
+				"406": {
+					Description: "Requested with wrong parameters, the errors are keyed by the index of the item",
+					Content:     jsonContent(ref("ValidateError")),
+				},
+				"500": responseRef("ServerError"),
+			},
+		}
+		if s := g.requestSchema(t, resolved, (*model.CosyTag).GetAdd); s != nil {
+			op.RequestBody = &RequestBody{
+				Required: true,
+				Content:  jsonContent(&Schema{Type: "array", Items: s}),
+			}
+		}
+		g.pathItem(api.Path + "/batch").Post = op
+	}
+
+	if api.HasOperation(cosy.OperationModify) {
+		g.pathItem(api.Path + "/:id").Post = &Operation{
+			OperationID: g.operationID("modify" + name),
+			Summary:     "Modify " + name,
+			Tags:        tags,
+			Parameters:  []*Parameter{idParam},
+			RequestBody: g.requestBody(t, resolved, (*model.CosyTag).GetUpdate),
+			Responses: map[string]*Response{
+				"200": {Description: "OK", Content: jsonContent(item)},
+				"404": responseRef("NotFound"),
+				"406": responseRef("ValidateError"),
+				"500": responseRef("ServerError"),
+			},
+		}
+	}
+
+	if api.HasOperation(cosy.OperationDestroy) {
+		g.pathItem(api.Path + "/:id").Delete = &Operation{
+			OperationID: g.operationID("destroy" + name),
+			Summary:     "Destroy " + name,
+			Tags:        tags,
+			Parameters: []*Parameter{idParam, {
+				Name:        "permanent",
+				In:          "query",
+				Description: "Delete the record permanently",
+				Schema:      &Schema{Type: "boolean"},
+			}},
+			Responses: map[string]*Response{
+				"204": {Description: "No Content"},
+				"404": responseRef("NotFound"),
+				"500": responseRef("ServerError"),
+			},
+		}
+	}
+
+	if api.HasOperation(cosy.OperationRecover) {
+		g.pathItem(api.Path + "/:id").Patch = &Operation{
+			OperationID: g.operationID("recover" + name),
+			Summary:     "Recover " + name,
+			Tags:        tags,
+			Parameters:  []*Parameter{idParam},
+			Responses: map[string]*Response{
+				"204": {Description: "No Content"},
+				"404": responseRef("NotFound"),
+				"500": responseRef("ServerError"),
+			},
+		}
+	}
+
+	if api.HasOperation(cosy.OperationHistory) {
+		g.pathItem(api.Path + "/:id/history").Get = &Operation{
+			OperationID: g.operationID("get" + name + "History"),
+			Summary:     "Get " + name + " history",
+			Tags:        tags,
+			Parameters: []*Parameter{idParam,
+				{Name: "page", In: "query", Schema: &Schema{Type: "integer", Format: "int32"}},
+				{Name: "page_size", In: "query", Schema: &Schema{Type: "integer", Format: "int32"}},
+			},
+			Responses: map[string]*Response{
+				"200": {Description: "OK", Content: jsonContent(g.dataListSchema(g.schemaOf(reflect.TypeFor[history.Change]())))},
+				"500": responseRef("ServerError"),
+			},
+		}
+	}
+
+	if api.HasOperation(cosy.OperationMove) {
+		parent := g.schemaOf(reflect.TypeFor[*model.IDType]())
+		parent.Description = "The parent of the node, null moves it to the root"
+		g.pathItem(api.Path + "/:id/move").Post = &Operation{
+			OperationID: g.operationID("move" + name),
+			Summary:     "Move " + name + " under the parent",
+			Tags:        tags,
+			Parameters:  []*Parameter{idParam},
+			RequestBody: &RequestBody{
+				Required: true,
+				Content: jsonContent(&Schema{Type: "object", Properties: map[string]*Schema{
+					"parent_id": parent,
+				}}),
+			},
+			Responses: map[string]*Response{
+				"200": {Description: "OK", Content: jsonContent(item)},
+				"404": responseRef("NotFound"),
+				"409": {Description: "The parent is the node itself or one of its descendants",
+					Content: jsonContent(g.schemaOf(reflect.TypeFor[cosy.Error]()))},
+				"500": responseRef("ServerError"),
+			},
+		}
+	}
+
+	if api.HasOperation(cosy.OperationStream) {
+		// the stream isn't paged or sorted
+		var params []*Parameter
+		for _, p := range g.listParameters(t, resolved) {
+			switch p.Name {
+			case "page", "page_size", "sort_by", "order", "sort", "trash":
+				continue
+			}
+			params = append(params, p)
+		}
+		event := &Schema{Type: "object", Properties: map[string]*Schema{
+			"action": {Type: "string", Enum: []any{"created", "updated", "deleted", "recovered"}},
+			"id":     {Type: "string"},
+			"data":   item,
+		}}
+		g.pathItem(api.Path + "/stream").Get = &Operation{
+			OperationID: g.operationID("stream" + name),
+			Summary:     "Stream " + name + " changes by server-sent events or websocket",
+			Tags:        tags,
+			Parameters:  params,
+			Responses: map[string]*Response{
+				"200": {Description: "OK", Content: map[string]*MediaType{"text/event-stream": {Schema: event}}},
+				"500": responseRef("ServerError"),
+			},
+		}
+	}
+}
+
+// dataListSchema returns the model.DataList envelope with the items of the model,
+// the keys of the pagination follow the camelcase_json build tag
+func (g *generator) dataListSchema(item *Schema) *Schema {
+	s := g.structSchema(reflect.TypeFor[model.DataList]())
+	s.Properties["data"] = &Schema{Type: "array", Items: item}
+	return s
+}
+
+// requestBody returns the request body accepted by the validator rules of the cosy tags
+func (g *generator) requestBody(t reflect.Type, resolved *model.ResolvedModel, rules func(*model.CosyTag) string) *RequestBody {
+	s := g.requestSchema(t, resolved, rules)
+	if s == nil {
+		return nil
+	}
+	return &RequestBody{Required: true, Content: jsonContent(s)}
+}
+
+// requestSchema returns the schema of the fields accepted by the validator rules of the cosy tags
+func (g *generator) requestSchema(t reflect.Type, resolved *model.ResolvedModel, rules func(*model.CosyTag) string) *Schema {
+	if resolved == nil {
+		return nil
+	}
+
+	s := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	for _, field := range resolved.OrderedFields {
+		dirs := rules(&field.CosyTag)
+		if dirs == "" {
+			continue
+		}
+		key := field.JsonTag
+		if key == "-" {
+			key = field.CosyTag.GetJson()
+		}
+		if key == "" {
+			continue
+		}
+
+		sf, ok := t.FieldByName(field.Name)
+		if !ok {
+			continue
+		}
+		prop := g.schemaOf(sf.Type)
+		if applyRules(prop, dirs) {
+			s.Required = append(s.Required, key)
+		}
+		s.Properties[key] = prop
+	}
+
+	if len(s.Properties) == 0 {
+		return nil
+	}
+
+	return s
+}
+
+// fieldsParameter returns the "fields" query parameter of the sparse fieldsets
+func fieldsParameter(resolved *model.ResolvedModel) *Parameter {
+	if resolved == nil {
+		return nil
+	}
+
+	var keys []string
+	for _, field := range resolved.OrderedFields {
+		if field.CosyTag.GetSelectable() && field.JsonTag != "" && field.JsonTag != "-" {
+			keys = append(keys, field.JsonTag)
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+
+	return &Parameter{
+		Name:        "fields",
+		In:          "query",
+		Description: "Comma separated fields to respond, selectable: " + strings.Join(keys, ", "),
+		Schema:      &Schema{Type: "string"},
+	}
+}
+
+// listParameters returns the query parameters of the paging list, including the list filters of the cosy tags
+func (g *generator) listParameters(t reflect.Type, resolved *model.ResolvedModel) []*Parameter {
+	explode := true
+	params := []*Parameter{
+		{Name: "page", In: "query", Schema: &Schema{Type: "integer", Format: "int32"}},
+		{Name: "page_size", In: "query", Schema: &Schema{Type: "integer", Format: "int32"}},
+		{Name: "sort_by", In: "query", Schema: &Schema{Type: "string"}},
+		{Name: "order", In: "query", Schema: &Schema{Type: "string", Enum: []any{"asc", "desc"}}},
+		{Name: "sort", In: "query", Description: "Sort by multiple columns, e.g. -priority,created_at:nulls_last",
+			Schema: &Schema{Type: "string"}},
+		{Name: "trash", In: "query", Description: "List the deleted records", Schema: &Schema{Type: "boolean"}},
+	}
+	if reflect.PointerTo(t).Implements(reflect.TypeFor[model.TreeNode]()) {
+		params = append(params,
+			&Parameter{Name: "tree", In: "query", Description: "List the records as the nested nodes, which are not paged",
+				Schema: &Schema{Type: "boolean"}},
+			&Parameter{Name: "under", In: "query", Description: "List the descendants of the node",
+				Schema: &Schema{Type: "string"}},
+		)
+	}
+	if resolved == nil {
+		return params
+	}
+
+	seen := make(map[string]bool)
+	add := func(p *Parameter) {
+		if seen[p.Name] {
+			return
+		}
+		seen[p.Name] = true
+		params = append(params, p)
+	}
+
+	var search, fullText, filterable []string
+	for _, field := range resolved.OrderedFields {
+		key := field.JsonTag
+		if key == "" || key == "-" {
+			continue
+		}
+
+		value := &Schema{Type: "string"}
+		if sf, ok := t.FieldByName(field.Name); ok {
+			if s := g.schemaOf(sf.Type); s.Ref == "" && s.Type != nil && schemaType(s) != "array" && schemaType(s) != "object" {
+				value = s
+			}
+		}
+
+		for _, dir := range field.CosyTag.GetList() {
+			// custom filters are named like fussy[name]
+			dir, _, _ = strings.Cut(dir, "[")
+			switch dir {
+			case cosy.Equal, cosy.OrEqual:
+				add(&Parameter{Name: key, In: "query", Schema: value})
+			case cosy.In, cosy.OrIn:
+				add(&Parameter{Name: key + "[]", In: "query", Style: "form", Explode: &explode,
+					Schema: &Schema{Type: "array", Items: value}})
+			case cosy.Between:
+				two := 2
+				add(&Parameter{Name: key + "[]", In: "query", Style: "form", Explode: &explode,
+					Description: "Range of " + key,
+					Schema:      &Schema{Type: "array", Items: value, MinItems: &two, MaxItems: &two}})
+			case cosy.Search:
+				search = append(search, key)
+			case cosy.FullText:
+				fullText = append(fullText, key)
+			case cosy.Filterable:
+				filterable = append(filterable, key)
+			case cosy.Preload:
+				// preloads don't take query parameters
+			case cosy.JSON:
+				// the paths of the json columns are arbitrary, e.g. attrs.color
+			case cosy.Relation:
+				if sf, ok := t.FieldByName(field.Name); ok {
+					g.relationParameters(key, sf.Type, add)
+				}
+			default:
+				add(&Parameter{Name: key, In: "query", Schema: &Schema{Type: "string"}})
+			}
+		}
+	}
+
+	if len(search) > 0 {
+		add(&Parameter{
+			Name:        "search",
+			In:          "query",
+			Description: "Fuzzy search in " + strings.Join(search, ", "),
+			Schema:      &Schema{Type: "string"},
+		})
+	}
+	if len(fullText) > 0 {
+		add(&Parameter{
+			Name:        filter.FullTextQuery,
+			In:          "query",
+			Description: "Full-text search in " + strings.Join(fullText, ", ") + ", sort_by=relevance sorts by the relevance",
+			Schema:      &Schema{Type: "string"},
+		})
+	}
+	if len(filterable) > 0 {
+		add(&Parameter{
+			Name:        "filter",
+			In:          "query",
+			Description: "Filter expression, filterable: " + strings.Join(filterable, ", "),
+			Schema:      &Schema{Type: "string"},
+		})
+	}
+	if p := fieldsParameter(resolved); p != nil {
+		add(p)
+	}
+
+	return params
+}
+
+// relationParameters adds the query parameters of the list filters of the association,
+// the parameters are named by the dotted paths, e.g. user.name
+func (g *generator) relationParameters(prefix string, t reflect.Type, add func(*Parameter)) {
+	for t.Kind() == reflect.Pointer || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return
+	}
+
+	explode := true
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if sf.Anonymous {
+			g.relationParameters(prefix, sf.Type, add)
+			continue
+		}
+		key, _, _ := strings.Cut(sf.Tag.Get("json"), ",")
+		if key == "" || key == "-" {
+			continue
+		}
+		key = prefix + "." + key
+
+		value := &Schema{Type: "string"}
+		if s := g.schemaOf(sf.Type); s.Ref == "" && s.Type != nil && schemaType(s) != "array" && schemaType(s) != "object" {
+			value = s
+		}
+
+		tag := model.NewCosyTag(sf.Tag.Get("cosy"))
+		for _, dir := range tag.GetList() {
+			switch dir {
+			case cosy.Equal:
+				add(&Parameter{Name: key, In: "query", Schema: value})
+			case cosy.In:
+				add(&Parameter{Name: key + "[]", In: "query", Style: "form", Explode: &explode,
+					Schema: &Schema{Type: "array", Items: value}})
+			case cosy.Fussy:
+				add(&Parameter{Name: key, In: "query", Schema: &Schema{Type: "string"}})
+			}
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package openapi
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/uozi-tech/cosy"
+	"github.com/uozi-tech/cosy/model"
+)
+
+type openapiGroup struct {
+	model.Model
+	Name string `json:"name" cosy:"list:fussy"`
+}
+
+type openapiUser struct {
+	model.Model
+	Name     string        `json:"name" cosy:"add:required,max=20;update:omitempty;list:fussy,filterable"`
+	Password string        `json:"-" cosy:"add:required,min=8;json:password"`
+	Email    string        `json:"email" cosy:"add:required,email;list:search"`
+	Status   int           `json:"status" cosy:"all:omitempty,oneof=1 2;list:in;item:selectable"`
+	Age      int           `json:"age" cosy:"list:between"`
+	GroupID  uint64        `json:"group_id" cosy:"list:eq"`
+	Group    *openapiGroup `json:"group" cosy:"item:preload,selectable;list:preload,relation"`
+}
+
+var registerOnce sync.Once
+
+func buildTestDocument(t *testing.T) *Document {
+	registerOnce.Do(func() {
+		model.ClearCollection()
+		model.RegisterModels(openapiUser{}, openapiGroup{})
+		model.ResolvedModels()
+
+		gin.SetMode(gin.TestMode)
+		r := gin.New()
+		g := r.Group("/api")
+		cosy.Api[openapiUser]("/openapi_users").WithBatchCreate().WithHistory().WithIdempotency(time.Hour).WithChangeFeed().InitRouter(g)
+		cosy.Api[openapiGroup]("/openapi_groups").WithReadonly().InitRouter(g)
+	})
+
+	var apis []*cosy.ApiDescriptor
+	for _, api := range cosy.RegisteredApis() {
+		if api.Path == "/api/openapi_users" || api.Path == "/api/openapi_groups" {
+			apis = append(apis, api)
+		}
+	}
+	assert.Len(t, apis, 2)
+
+	doc := Build(Info{Title: "test", Version: "1.0.0"}, apis)
+
+	// the document must be serializable
+	_, err := json.Marshal(doc)
+	assert.NoError(t, err)
+
+	return doc
+}
+
+func TestBuildPaths(t *testing.T) {
+	doc := buildTestDocument(t)
+
+	assert.Equal(t, Version, doc.OpenAPI)
+
+	users := doc.Paths["/api/openapi_users"]
+	if assert.NotNil(t, users) {
+		assert.NotNil(t, users.Get)
+		assert.NotNil(t, users.Post)
+		assert.Equal(t, cosy.IdempotencyKeyHeader, users.Post.Parameters[0].Name)
+		assert.Equal(t, "header", users.Post.Parameters[0].In)
+	}
+	user := doc.Paths["/api/openapi_users/{id}"]
+	if assert.NotNil(t, user) {
+		assert.NotNil(t, user.Get)
+		assert.NotNil(t, user.Post)
+		assert.NotNil(t, user.Delete)
+		assert.NotNil(t, user.Patch)
+		assert.Equal(t, "path", user.Get.Parameters[0].In)
+	}
+
+	batch := doc.Paths["/api/openapi_users/batch"]
+	if assert.NotNil(t, batch) {
+		assert.Equal(t, "array", batch.Post.RequestBody.Content["application/json"].Schema.Type)
+	}
+
+	history := doc.Paths["/api/openapi_users/{id}/history"]
+	if assert.NotNil(t, history) {
+		assert.NotNil(t, history.Get)
+		assert.Equal(t, "#/components/schemas/Change", history.Get.Responses["200"].Content["application/json"].Schema.Properties["data"].Items.Ref)
+	}
+	assert.Nil(t, doc.Paths["/api/openapi_groups/{id}/history"])
+
+	stream := doc.Paths["/api/openapi_users/stream"]
+	if assert.NotNil(t, stream) {
+		names := make([]string, 0, len(stream.Get.Parameters))
+		for _, p := range stream.Get.Parameters {
+			names = append(names, p.Name)
+		}
+		assert.Contains(t, names, "name")
+		assert.NotContains(t, names, "page")
+		assert.NotNil(t, stream.Get.Responses["200"].Content["text/event-stream"])
+	}
+	assert.Nil(t, doc.Paths["/api/openapi_groups/stream"])
+
+	// readonly
+	group := doc.Paths["/api/openapi_groups/{id}"]
+	if assert.NotNil(t, group) {
+		assert.NotNil(t, group.Get)
+		assert.Nil(t, group.Post)
+		assert.Nil(t, group.Delete)
+		assert.Nil(t, group.Patch)
+	}
+	assert.Nil(t, doc.Paths["/api/openapi_groups"].Post)
+}
+
+func TestBuildSchemas(t *testing.T) {
+	doc := buildTestDocument(t)
+
+	user := doc.Components.Schemas["openapiUser"]
+	if assert.NotNil(t, user) {
+		// embedded model.Model is flattened
+		assert.Contains(t, user.Properties, "id")
+		assert.Contains(t, user.Properties, "name")
+		assert.NotContains(t, user.Properties, "password")
+		assert.Equal(t, "#/components/schemas/openapiGroup", user.Properties["group"].Ref)
+	}
+
+	create := doc.Paths["/api/openapi_users"].Post.RequestBody.Content["application/json"].Schema
+	assert.ElementsMatch(t, []string{"name", "password", "email"}, create.Required)
+	assert.Equal(t, "email", create.Properties["email"].Format)
+	assert.Equal(t, 20, *create.Properties["name"].MaxLength)
+	assert.Equal(t, 8, *create.Properties["password"].MinLength)
+	assert.Equal(t, []any{"1", "2"}, create.Properties["status"].Enum)
+
+	modify := doc.Paths["/api/openapi_users/{id}"].Post.RequestBody.Content["application/json"].Schema
+	assert.Empty(t, modify.Required)
+	assert.Contains(t, modify.Properties, "name")
+	assert.Contains(t, modify.Properties, "status")
+	assert.NotContains(t, modify.Properties, "password")
+
+	list := doc.Paths["/api/openapi_users"].Get.Responses["200"].Content["application/json"].Schema
+	assert.Equal(t, "array", list.Properties["data"].Type)
+	assert.Equal(t, "#/components/schemas/Pagination", list.Properties["pagination"].Ref)
+	assert.Contains(t, doc.Components.Schemas, "Pagination")
+
+	validateError := doc.Components.Responses["ValidateError"].Content["application/json"].Schema
+	assert.Equal(t, "#/components/schemas/ValidateError", validateError.Ref)
+	assert.Contains(t, doc.Components.Schemas["ValidateError"].Properties, "errors")
+	assert.Contains(t, doc.Components.Schemas["ValidateError"].Properties, "code")
+}
+
+func TestBuildListParameters(t *testing.T) {
+	doc := buildTestDocument(t)
+
+	params := make(map[string]*Parameter)
+	for _, p := range doc.Paths["/api/openapi_users"].Get.Parameters {
+		params[p.Name] = p
+	}
+
+	for _, name := range []string{"page", "page_size", "sort_by", "order", "sort", "name", "status[]", "age[]",
+		"group_id", "search", "filter", "fields"} {
+		assert.Contains(t, params, name)
+	}
+	assert.Equal(t, "array", params["status[]"].Schema.Type)
+	assert.Equal(t, 2, *params["age[]"].Schema.MinItems)
+	assert.Equal(t, "integer", params["group_id"].Schema.Type)
+	assert.NotContains(t, params, "group")
+	// the filters of the association
+	assert.Contains(t, params, "group.name")
+}
+
+type openapiCategory struct {
+	model.Model
+	model.Tree
+	Name string `json:"name" cosy:"add:required;update:omitempty"`
+}
+
+func TestBuildTree(t *testing.T) {
+	model.RegisterModels(openapiCategory{})
+	model.ResolvedModels()
+
+	gin.SetMode(gin.TestMode)
+	cosy.Api[openapiCategory]("/openapi_categories").InitRouter(gin.New().Group("/api"))
+
+	var apis []*cosy.ApiDescriptor
+	for _, api := range cosy.RegisteredApis() {
+		if api.Path == "/api/openapi_categories" {
+			apis = append(apis, api)
+		}
+	}
+	doc := Build(Info{Title: "test", Version: "1.0.0"}, apis)
+
+	move := doc.Paths["/api/openapi_categories/{id}/move"]
+	if assert.NotNil(t, move) && assert.NotNil(t, move.Post) {
+		assert.Contains(t, move.Post.RequestBody.Content["application/json"].Schema.Properties, "parent_id")
+		assert.NotNil(t, move.Post.Responses["409"])
+	}
+
+	names := make([]string, 0)
+	for _, p := range doc.Paths["/api/openapi_categories"].Get.Parameters {
+		names = append(names, p.Name)
+	}
+	assert.Contains(t, names, "tree")
+	assert.Contains(t, names, "under")
+}
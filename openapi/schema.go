@@ -0,0 +1,231 @@
+package openapi
+
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/spf13/cast"
+	"gorm.io/gorm"
+)
+
+var (
+	timeType          = reflect.TypeFor[time.Time]()
+	deletedAtType     = reflect.TypeFor[gorm.DeletedAt]()
+	rawMessageType    = reflect.TypeFor[json.RawMessage]()
+	jsonMarshalerType = reflect.TypeFor[json.Marshaler]()
+	textMarshalerType = reflect.TypeFor[encoding.TextMarshaler]()
+
+	reSchemaName = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+)
+
+// schemaName returns the component name of a named type,
+// type parameters of generic types are flattened, e.g. DataList[User] -> DataList_User
+func schemaName(t reflect.Type) string {
+	return strings.Trim(reSchemaName.ReplaceAllString(t.Name(), "_"), "_")
+}
+
+// schemaOf returns the schema of a go type, named structs are registered as components
+func (g *generator) schemaOf(t reflect.Type) *Schema {
+	nullable := false
+	for t.Kind() == reflect.Pointer {
+		nullable = true
+		t = t.Elem()
+	}
+
+	s := g.schemaOfType(t)
+	if typ, ok := s.Type.(string); ok && nullable {
+		s.Type = []any{typ, "null"}
+	}
+	return s
+}
+
+func (g *generator) schemaOfType(t reflect.Type) *Schema {
+	switch t {
+	case timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case deletedAtType:
+		return &Schema{Type: []any{"string", "null"}, Format: "date-time"}
+	case rawMessageType:
+		return &Schema{}
+	}
+
+	// the shape of custom marshaled values is unknown
+	if implements(t, jsonMarshalerType) {
+		return &Schema{}
+	}
+	if t.Kind() == reflect.Struct && implements(t, textMarshalerType) {
+		return &Schema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int8, reflect.Int16, reflect.Int32:
+		return &Schema{Type: "integer", Format: "int32"}
+	case reflect.Int, reflect.Int64:
+		return &Schema{Type: "integer", Format: "int64"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer", Format: "int64", Minimum: new(float64)}
+	case reflect.Float32:
+		return &Schema{Type: "number", Format: "float"}
+	case reflect.Float64:
+		return &Schema{Type: "number", Format: "double"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string", Format: "byte"}
+		}
+		return &Schema{Type: "array", Items: g.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		name := schemaName(t)
+		if _, ok := g.doc.Components.Schemas[name]; !ok {
+			// register before resolving the fields, so that recursive types end up with a reference
+			g.doc.Components.Schemas[name] = &Schema{}
+			*g.doc.Components.Schemas[name] = *g.structSchema(t)
+		}
+		return ref(name)
+	}
+
+	return &Schema{}
+}
+
+func implements(t reflect.Type, iface reflect.Type) bool {
+	return t.Implements(iface) || reflect.PointerTo(t).Implements(iface)
+}
+
+// structSchema resolves the fields of a struct following the rules of encoding/json
+func (g *generator) structSchema(t reflect.Type) *Schema {
+	s := &Schema{Type: "object", Properties: make(map[string]*Schema)}
+	g.collectFields(s, t)
+	return s
+}
+
+func (g *generator) collectFields(s *Schema, t reflect.Type) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+
+		fieldType := field.Type
+		for fieldType.Kind() == reflect.Pointer {
+			fieldType = fieldType.Elem()
+		}
+
+		// embedded structs are flattened, unless they are named by the json tag
+		if field.Anonymous && name == "" && fieldType.Kind() == reflect.Struct {
+			g.collectFields(s, fieldType)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		if strings.Contains(opts, "string") {
+			s.Properties[name] = &Schema{Type: "string"}
+			continue
+		}
+		s.Properties[name] = g.schemaOf(field.Type)
+	}
+}
+
+// applyRules maps the validator rules of the cosy tag onto the schema,
+// it reports whether the field is required
+func applyRules(s *Schema, rules string) (required bool) {
+	for rule := range strings.SplitSeq(rules, ",") {
+		name, param, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		if name == "required" {
+			required = true
+			continue
+		}
+		// referenced schemas are shared, so they are left untouched
+		if s.Ref != "" {
+			continue
+		}
+		switch name {
+		case "email":
+			s.Format = "email"
+		case "url":
+			s.Format = "uri"
+		case "uuid":
+			s.Format = "uuid"
+		case "date":
+			s.Format = "date"
+		case "datetime":
+			s.Format = "date-time"
+		case "oneof":
+			for v := range strings.FieldsSeq(param) {
+				s.Enum = append(s.Enum, v)
+			}
+		case "min", "max", "len", "gte", "lte":
+			applyBound(s, name, param)
+		}
+	}
+
+	return
+}
+
+func applyBound(s *Schema, rule string, param string) {
+	value := cast.ToFloat64(param)
+	count := cast.ToInt(param)
+
+	switch schemaType(s) {
+	case "string":
+		switch rule {
+		case "min", "gte":
+			s.MinLength = &count
+		case "max", "lte":
+			s.MaxLength = &count
+		case "len":
+			s.MinLength, s.MaxLength = &count, &count
+		}
+	case "array":
+		switch rule {
+		case "min", "gte":
+			s.MinItems = &count
+		case "max", "lte":
+			s.MaxItems = &count
+		case "len":
+			s.MinItems, s.MaxItems = &count, &count
+		}
+	case "integer", "number":
+		switch rule {
+		case "min", "gte":
+			s.Minimum = &value
+		case "max", "lte":
+			s.Maximum = &value
+		case "len":
+			s.Minimum, s.Maximum = &value, &value
+		}
+	}
+}
+
+// schemaType returns the non-null type of the schema
+func schemaType(s *Schema) string {
+	switch v := s.Type.(type) {
+	case string:
+		return v
+	case []any:
+		for _, t := range v {
+			if t != "null" {
+				return cast.ToString(t)
+			}
+		}
+	}
+	return ""
+}
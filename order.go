@@ -18,6 +18,11 @@ func (c *Ctx[T]) UpdateOrder() {
 		return
 	}
 
+	c.resolveTenant()
+	if c.abort {
+		return
+	}
+
 	affectedLen := len(json.AffectedIDs)
 
 	db := model.UseDB(c.Context)
@@ -26,6 +31,9 @@ func (c *Ctx[T]) UpdateOrder() {
 		db = db.Table(c.table, c.tableArgs...)
 	}
 
+	// the statements below must not share the conditions
+	db = c.scopeTenant(db).Session(&gorm.Session{})
+
 	// update target
 	err := db.Model(&c.Model).Where("id = ?", json.TargetID).
 		Update("order_id", gorm.Expr("order_id + ?", affectedLen*(-json.Direction))).Error
@@ -44,5 +52,7 @@ func (c *Ctx[T]) UpdateOrder() {
 		return
 	}
 
+	InvalidateCache[T]()
+
 	c.JSON(http.StatusOK, json)
 }
@@ -0,0 +1,95 @@
+package cosy
+
+import (
+	"reflect"
+
+	"github.com/spf13/cast"
+	"github.com/uozi-tech/cosy/history"
+	"github.com/uozi-tech/cosy/outbox"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// WithOutbox writes the events of "create", "modify", "destroy" and "recover" into the outbox table,
+// e.g. "user.created", which are delivered to the sinks registered by outbox.RegisterSink.
+// The events of a single record are written by c.Tx, so use it with WithTransaction to write them atomically
+// with the changes, the events of the batch actions, upsert and import are written in their transactions.
+// The outbox.Event model must be registered to be migrated.
+func (c *Ctx[T]) WithOutbox() *Ctx[T] {
+	c.outbox = true
+	return c
+}
+
+// eventModelName returns the name of the model in the event names, e.g. "user_group" of UserGroup
+func eventModelName[T any]() string {
+	return schema.NamingStrategy{SingularTable: true}.TableName(reflect.TypeFor[T]().Name())
+}
+
+// recordEvent writes the event of the record into the outbox if the outbox is enabled,
+// and records the change for the change feed
+func (c *Ctx[T]) recordEvent(action outbox.Action, id any, record *T) {
+	if err := c.writeEvent(c.Tx, action, id, record); err != nil {
+		c.AbortWithError(err)
+	}
+}
+
+// writeEvent writes the event of the record into the outbox by tx if the outbox is enabled,
+// and records the change for the change feed
+func (c *Ctx[T]) writeEvent(tx *gorm.DB, action outbox.Action, id any, record *T) error {
+	c.recordChange(action, id)
+	if !c.outbox {
+		return nil
+	}
+
+	event, err := outbox.NewEvent(eventModelName[T](), action, cast.ToString(id), record)
+	if err != nil {
+		return err
+	}
+	if c.tenantScopeField() != nil {
+		tenant, _ := c.tenantOf()
+		event.TenantID = cast.ToString(tenant)
+	}
+	return outbox.Record(tx, c.Context, event)
+}
+
+// recordsChanges reports whether the changes are recorded by the history, the outbox or the change feed
+func (c *Ctx[T]) recordsChanges() bool {
+	return c.history || c.outbox || c.changeFeed
+}
+
+// recordBatch writes the history and the event of each record of a batch action by tx, the records before
+// the action are matched with the ones after it by the primary keys, a nil before or after means the records
+// don't exist before or after the action, e.g. nil before for the created records
+func (c *Ctx[T]) recordBatch(tx *gorm.DB, action history.Action, event outbox.Action, before, after []T) error {
+	if !c.recordsChanges() {
+		return nil
+	}
+
+	if after == nil {
+		for i := range before {
+			id := c.primaryKeyOf(&before[i])
+			if err := c.writeHistory(tx, action, id, &before[i], nil); err != nil {
+				return err
+			}
+			if err := c.writeEvent(tx, event, id, &before[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	origins := make(map[string]*T, len(before))
+	for i := range before {
+		origins[cast.ToString(c.primaryKeyOf(&before[i]))] = &before[i]
+	}
+	for i := range after {
+		id := c.primaryKeyOf(&after[i])
+		if err := c.writeHistory(tx, action, id, origins[cast.ToString(id)], &after[i]); err != nil {
+			return err
+		}
+		if err := c.writeEvent(tx, event, id, &after[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
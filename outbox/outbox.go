@@ -0,0 +1,125 @@
+package outbox
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/uozi-tech/cosy/history"
+	"github.com/uozi-tech/cosy/logger"
+	"gorm.io/gorm"
+)
+
+// Action is the action which changes the record, it's the suffix of the event name
+type Action string
+
+const (
+	ActionCreated   Action = "created"
+	ActionUpdated   Action = "updated"
+	ActionDeleted   Action = "deleted"
+	ActionRecovered Action = "recovered"
+)
+
+// EventName returns the name of the event of the model, e.g. "user.created"
+func EventName(model string, action Action) string {
+	return model + "." + string(action)
+}
+
+// Payload is the JSON of the record of the event, it's stored as JSON text
+// and marshaled as it is into the delivered event
+type Payload json.RawMessage
+
+// Value implements driver.Valuer
+func (p Payload) Value() (driver.Value, error) {
+	if p == nil {
+		return nil, nil
+	}
+	return string(p), nil
+}
+
+// Scan implements sql.Scanner
+func (p *Payload) Scan(src any) error {
+	switch v := src.(type) {
+	case nil:
+		*p = nil
+	case string:
+		*p = Payload(v)
+	case []byte:
+		*p = append(Payload(nil), v...)
+	default:
+		return errors.New("outbox: unsupported type of payload")
+	}
+	return nil
+}
+
+// MarshalJSON implements json.Marshaler
+func (p Payload) MarshalJSON() ([]byte, error) {
+	if p == nil {
+		return []byte("null"), nil
+	}
+	return p, nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler
+func (p *Payload) UnmarshalJSON(data []byte) error {
+	*p = append((*p)[0:0], data...)
+	return nil
+}
+
+// Event is a row of the outbox table, it's written in the same transaction of the change
+// and delivered to the sinks by the relay after the transaction is committed.
+// TenantID is the tenant of the record if the model is scoped to the tenant, see cosy.SetTenantResolver
+type Event struct {
+	ID            uint64     `gorm:"primaryKey" json:"id"`
+	Name          string     `gorm:"type:varchar(255);index" json:"name"`
+	Model         string     `gorm:"type:varchar(255)" json:"model"`
+	RecordID      string     `gorm:"type:varchar(255)" json:"record_id"`
+	TenantID      string     `gorm:"type:varchar(255)" json:"tenant_id"`
+	ActorID       string     `gorm:"type:varchar(255)" json:"actor_id"`
+	RequestID     string     `gorm:"type:varchar(255)" json:"request_id"`
+	Payload       Payload    `gorm:"type:text" json:"payload"`
+	Attempts      int        `json:"-"`
+	LastError     string     `gorm:"type:text" json:"-"`
+	NextAttemptAt time.Time  `gorm:"index:idx_outbox_pending" json:"-"`
+	DeliveredAt   *time.Time `gorm:"index:idx_outbox_pending" json:"-"`
+	FailedAt      *time.Time `gorm:"index:idx_outbox_pending" json:"-"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// TableName returns the table name of Event
+func (Event) TableName() string {
+	return "outbox"
+}
+
+// NewEvent returns the event of the record, the record is marshaled into the payload
+func NewEvent(model string, action Action, recordID string, record any) (*Event, error) {
+	payload, err := json.Marshal(record)
+	if err != nil {
+		return nil, err
+	}
+	return &Event{
+		Name:     EventName(model, action),
+		Model:    model,
+		RecordID: recordID,
+		Payload:  payload,
+	}, nil
+}
+
+// Record writes the event with the actor (resolved by the resolver of history.SetActorResolver)
+// and the request id of the request,
+// the event is written by a new session of tx, so that it's in the same transaction of tx
+// and it's never delivered if the transaction is rolled back
+func Record(tx *gorm.DB, c *gin.Context, event *Event) error {
+	if c != nil {
+		event.ActorID = history.ResolveActor(c)
+		if id, ok := c.Get(logger.CosyRequestIDKey); ok {
+			event.RequestID, _ = id.(string)
+		}
+	}
+	if event.NextAttemptAt.IsZero() {
+		event.NextAttemptAt = time.Now()
+	}
+	return tx.Session(&gorm.Session{NewDB: true}).Create(event).Error
+}
@@ -0,0 +1,196 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type outboxUser struct {
+	ID   uint64 `json:"id"`
+	Name string `json:"name"`
+}
+
+func newTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = db.AutoMigrate(&Event{}); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func setSinks(t *testing.T, s ...Sink) {
+	sinksMutex.Lock()
+	sinks = s
+	sinksMutex.Unlock()
+	t.Cleanup(func() {
+		sinksMutex.Lock()
+		sinks = nil
+		sinksMutex.Unlock()
+	})
+}
+
+func TestRecord(t *testing.T) {
+	db := newTestDB(t)
+
+	event, err := NewEvent("user", ActionCreated, "1", &outboxUser{ID: 1, Name: "Alice"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "user.created", event.Name)
+
+	// the event of the rolled back transaction is never written
+	tx := db.Begin()
+	if err = Record(tx, nil, event); err != nil {
+		t.Fatal(err)
+	}
+	tx.Rollback()
+
+	var count int64
+	db.Model(&Event{}).Count(&count)
+	assert.Equal(t, int64(0), count)
+
+	event.ID = 0
+	tx = db.Begin()
+	if err = Record(tx, nil, event); err != nil {
+		t.Fatal(err)
+	}
+	tx.Commit()
+
+	var stored Event
+	if err = db.First(&stored).Error; err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "user.created", stored.Name)
+	assert.JSONEq(t, `{"id":1,"name":"Alice"}`, string(stored.Payload))
+
+	b, err := json.Marshal(stored)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Contains(t, string(b), `"payload":{"id":1,"name":"Alice"}`)
+}
+
+func TestDeliverPending(t *testing.T) {
+	db := newTestDB(t)
+
+	for i := range 3 {
+		event, _ := NewEvent("user", ActionUpdated, "1", &outboxUser{ID: 1, Name: string(rune('A' + i))})
+		if err := Record(db, nil, event); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	fail := true
+	var delivered []uint64
+	setSinks(t, SinkFunc(func(ctx context.Context, event *Event) error {
+		if fail && event.ID == 2 {
+			return errors.New("unavailable")
+		}
+		delivered = append(delivered, event.ID)
+		return nil
+	}))
+
+	count, err := DeliverPending(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 3, count)
+	assert.Equal(t, []uint64{1, 3}, delivered)
+
+	var failed Event
+	db.First(&failed, 2)
+	assert.Nil(t, failed.DeliveredAt)
+	assert.Equal(t, 1, failed.Attempts)
+	assert.Equal(t, "unavailable", failed.LastError)
+	assert.True(t, failed.NextAttemptAt.After(time.Now()))
+
+	// the failed event isn't retried before the backoff
+	count, err = DeliverPending(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 0, count)
+
+	fail = false
+	db.Model(&failed).Update("next_attempt_at", time.Now().Add(-time.Second))
+	count, err = DeliverPending(context.Background(), db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 1, count)
+	assert.Equal(t, []uint64{1, 3, 2}, delivered)
+
+	var pending int64
+	db.Model(&Event{}).Where("delivered_at IS NULL").Count(&pending)
+	assert.Equal(t, int64(0), pending)
+}
+
+func TestDeliverPendingMaxAttempts(t *testing.T) {
+	db := newTestDB(t)
+
+	event, _ := NewEvent("user", ActionDeleted, "1", &outboxUser{ID: 1})
+	event.Attempts = relayOptions.MaxAttempts - 1
+	if err := Record(db, nil, event); err != nil {
+		t.Fatal(err)
+	}
+
+	setSinks(t, SinkFunc(func(ctx context.Context, event *Event) error {
+		return errors.New("unavailable")
+	}))
+
+	if _, err := DeliverPending(context.Background(), db); err != nil {
+		t.Fatal(err)
+	}
+
+	var failed Event
+	db.First(&failed, event.ID)
+	assert.NotNil(t, failed.FailedAt)
+	assert.Equal(t, relayOptions.MaxAttempts, failed.Attempts)
+}
+
+func TestBackoff(t *testing.T) {
+	assert.Equal(t, time.Second, backoff(1))
+	assert.Equal(t, 2*time.Second, backoff(2))
+	assert.Equal(t, 8*time.Second, backoff(4))
+	assert.Equal(t, time.Hour, backoff(100))
+}
+
+func TestHTTPSink(t *testing.T) {
+	var body []byte
+	var header http.Header
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		header = r.Header
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	sink := HTTPSink(server.URL, http.Header{"Authorization": {"Bearer token"}})
+	event, _ := NewEvent("user", ActionCreated, "1", &outboxUser{ID: 1, Name: "Alice"})
+	event.ID = 42
+
+	if err := sink.Deliver(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "42", header.Get(EventIDHeader))
+	assert.Equal(t, "user.created", header.Get(EventNameHeader))
+	assert.Equal(t, "Bearer token", header.Get("Authorization"))
+	assert.Contains(t, string(body), `"payload":{"id":1,"name":"Alice"}`)
+
+	status = http.StatusServiceUnavailable
+	assert.Error(t, sink.Deliver(context.Background(), event))
+}
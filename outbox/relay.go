@@ -0,0 +1,179 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/bsm/redislock"
+	"github.com/uozi-tech/cosy/logger"
+	"github.com/uozi-tech/cosy/model"
+	"github.com/uozi-tech/cosy/redis"
+	"gorm.io/gorm"
+)
+
+// RelayOptions is the options of the relay, the zero values are replaced by the defaults
+type RelayOptions struct {
+	// Interval is the interval of polling the pending events, default 1s
+	Interval time.Duration
+	// BatchSize is the max count of the events delivered in a query, default 100
+	BatchSize int
+	// MaxAttempts is the max count of the attempts of an event, the event is marked failed
+	// and never delivered again after that, default 10
+	MaxAttempts int
+	// MinBackoff is the delay of the first retry, which is doubled for each attempt, default 1s
+	MinBackoff time.Duration
+	// MaxBackoff is the max delay of the retries, default 1h
+	MaxBackoff time.Duration
+}
+
+// relayLockKey is the key of the lock of the relay, only one relay delivers the events at a time
+// if the relays of the instances share the redis
+const relayLockKey = "outbox:relay"
+
+// relayLockTTL is the time to live of the lock of the relay
+const relayLockTTL = time.Minute
+
+var relayOptions = RelayOptions{
+	Interval:    time.Second,
+	BatchSize:   100,
+	MaxAttempts: 10,
+	MinBackoff:  time.Second,
+	MaxBackoff:  time.Hour,
+}
+
+// SetRelayOptions sets the options of the relay, it should be called before the kernel boot
+func SetRelayOptions(options RelayOptions) {
+	if options.Interval > 0 {
+		relayOptions.Interval = options.Interval
+	}
+	if options.BatchSize > 0 {
+		relayOptions.BatchSize = options.BatchSize
+	}
+	if options.MaxAttempts > 0 {
+		relayOptions.MaxAttempts = options.MaxAttempts
+	}
+	if options.MinBackoff > 0 {
+		relayOptions.MinBackoff = options.MinBackoff
+	}
+	if options.MaxBackoff > 0 {
+		relayOptions.MaxBackoff = options.MaxBackoff
+	}
+}
+
+// backoff returns the delay of the retry after the attempts
+func backoff(attempts int) time.Duration {
+	delay := relayOptions.MinBackoff
+	for i := 1; i < attempts && delay < relayOptions.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, relayOptions.MaxBackoff)
+}
+
+// Relay delivers the pending events to the sinks until the ctx is done, it's registered into
+// the kernel goroutines by RegisterSink. The relays of the instances sharing the redis are
+// serialized by a lock, the relay works without the lock if redis isn't initialized.
+func Relay(ctx context.Context) {
+	ticker := time.NewTicker(relayOptions.Interval)
+	defer ticker.Stop()
+
+	for {
+		relay(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// relay delivers the pending events in batches until there are no more
+func relay(ctx context.Context) {
+	db := model.UseDB(ctx)
+	if db == nil {
+		return
+	}
+
+	if redis.GetClient() != nil {
+		lock, err := redis.ObtainLock(relayLockKey, relayLockTTL, nil)
+		if errors.Is(err, redislock.ErrNotObtained) {
+			return
+		}
+		if err != nil {
+			logger.Error(err)
+			return
+		}
+		defer func() {
+			if err := lock.Release(context.Background()); err != nil && !errors.Is(err, redislock.ErrLockNotHeld) {
+				logger.Error(err)
+			}
+		}()
+	}
+
+	for ctx.Err() == nil {
+		count, err := DeliverPending(ctx, db)
+		if err != nil {
+			logger.Error(err)
+			return
+		}
+		if count < relayOptions.BatchSize {
+			return
+		}
+	}
+}
+
+// DeliverPending delivers a batch of the pending events of the db to the sinks in the order of the ids,
+// and returns the count of the events tried. The failed events are retried with the exponential backoff.
+func DeliverPending(ctx context.Context, db *gorm.DB) (int, error) {
+	s := registeredSinks()
+	if len(s) == 0 {
+		return 0, nil
+	}
+
+	var events []Event
+	err := db.Where("delivered_at IS NULL AND failed_at IS NULL AND next_attempt_at <= ?", time.Now()).
+		Order("id").Limit(relayOptions.BatchSize).Find(&events).Error
+	if err != nil {
+		return 0, err
+	}
+
+	for i := range events {
+		event := &events[i]
+		err = deliver(ctx, s, event)
+
+		now := time.Now()
+		updates := map[string]any{"attempts": event.Attempts + 1}
+		if err == nil {
+			updates["delivered_at"] = now
+			updates["last_error"] = ""
+		} else {
+			updates["last_error"] = err.Error()
+			updates["next_attempt_at"] = now.Add(backoff(event.Attempts + 1))
+			if event.Attempts+1 >= relayOptions.MaxAttempts {
+				updates["failed_at"] = now
+				logger.Errorf("outbox: event %d (%s) failed after %d attempts: %v", event.ID, event.Name, event.Attempts+1, err)
+			}
+		}
+		if err = db.Model(event).Updates(updates).Error; err != nil {
+			return i, err
+		}
+	}
+	return len(events), nil
+}
+
+// deliver delivers the event to all the sinks, the event is delivered again to all the sinks
+// if any of them fails
+func deliver(ctx context.Context, sinks []Sink, event *Event) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = errors.New("outbox: sink panicked")
+			logger.Error(r)
+		}
+	}()
+	for _, sink := range sinks {
+		if err = sink.Deliver(ctx, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
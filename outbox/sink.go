@@ -0,0 +1,118 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/uozi-tech/cosy/kernel"
+	"github.com/uozi-tech/cosy/queue"
+	"github.com/uozi-tech/cosy/redis"
+)
+
+// Sink delivers the events to the other services, an error means the event is delivered again later,
+// so the sinks must tolerate the duplicates (the events are delivered at least once)
+type Sink interface {
+	Deliver(ctx context.Context, event *Event) error
+}
+
+// SinkFunc is the function adapter of Sink
+type SinkFunc func(ctx context.Context, event *Event) error
+
+// Deliver implements Sink
+func (f SinkFunc) Deliver(ctx context.Context, event *Event) error {
+	return f(ctx, event)
+}
+
+var (
+	sinks      []Sink
+	sinksMutex sync.RWMutex
+	relayOnce  sync.Once
+)
+
+// RegisterSink registers the sinks which every event is delivered to, the first registration
+// registers the relay into the kernel goroutines, so it must be called before the kernel boot
+func RegisterSink(s ...Sink) {
+	sinksMutex.Lock()
+	sinks = append(sinks, s...)
+	sinksMutex.Unlock()
+
+	relayOnce.Do(func() {
+		kernel.RegisterGoroutine(Relay)
+	})
+}
+
+// registeredSinks returns the registered sinks
+func registeredSinks() []Sink {
+	sinksMutex.RLock()
+	defer sinksMutex.RUnlock()
+	return append([]Sink(nil), sinks...)
+}
+
+// RedisSink publishes the events as JSON to the redis channel, e.g. "events",
+// the subscribers which are offline when the event is published miss it
+func RedisSink(channel string) Sink {
+	return SinkFunc(func(ctx context.Context, event *Event) error {
+		message, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		return redis.Publish(channel, message)
+	})
+}
+
+// QueueSink pushes the events into the queue of the name, which is consumed by queue.New[outbox.Event]
+func QueueSink(name string, direction queue.Direction) Sink {
+	q := queue.New[Event](name, direction)
+	return SinkFunc(func(ctx context.Context, event *Event) error {
+		return q.Produce(event)
+	})
+}
+
+// The headers of the events posted by HTTPSink
+const (
+	EventIDHeader   = "X-Event-ID"
+	EventNameHeader = "X-Event-Name"
+)
+
+// httpSinkTimeout is the timeout of posting an event
+const httpSinkTimeout = 10 * time.Second
+
+// HTTPSink posts the events as JSON to the url, the responses with 2xx status mean the events are delivered.
+// The id of the event is sent in the X-Event-ID header, so that the receiver can drop the duplicates.
+func HTTPSink(url string, header ...http.Header) Sink {
+	client := &http.Client{Timeout: httpSinkTimeout}
+	return SinkFunc(func(ctx context.Context, event *Event) error {
+		body, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		for _, h := range header {
+			for name, values := range h {
+				req.Header[name] = values
+			}
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(EventIDHeader, strconv.FormatUint(event.ID, 10))
+		req.Header.Set(EventNameHeader, event.Name)
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return fmt.Errorf("outbox: %s responded %d", url, resp.StatusCode)
+		}
+		return nil
+	})
+}
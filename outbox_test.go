@@ -0,0 +1,84 @@
+package cosy
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/uozi-tech/cosy/history"
+	"github.com/uozi-tech/cosy/logger"
+	"github.com/uozi-tech/cosy/model"
+	"github.com/uozi-tech/cosy/outbox"
+	"gorm.io/driver/sqlite"
+)
+
+type outboxItem struct {
+	model.Model
+	Code string `json:"code" gorm:"uniqueIndex" cosy:"add:required"`
+	Name string `json:"name" cosy:"add:required;update:omitempty;batch"`
+}
+
+func TestRecordBatch(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger.Init(gin.TestMode)
+	model.ClearCollection()
+	model.RegisterModels(outboxItem{}, history.Change{}, outbox.Event{})
+	db := model.Init(sqlite.Open(filepath.Join(t.TempDir(), "outbox.db")))
+
+	r := gin.New()
+	g := r.Group("")
+	Api[outboxItem]("items").WithBatchCreate().WithHistory().WithOutbox().InitRouter(g)
+	g.PUT("/items", func(c *gin.Context) {
+		Core[outboxItem](c).WithHistory().WithOutbox().BatchModify()
+	})
+	g.DELETE("/items", func(c *gin.Context) {
+		Core[outboxItem](c).WithHistory().WithOutbox().BatchDestroy()
+	})
+	g.PATCH("/items", func(c *gin.Context) {
+		Core[outboxItem](c).WithHistory().WithOutbox().BatchRecover()
+	})
+	g.POST("/items/upsert", func(c *gin.Context) {
+		Core[outboxItem](c).WithHistory().WithOutbox().Upsert("code")
+	})
+
+	request := func(method, uri string, body any) {
+		var buf bytes.Buffer
+		_ = json.NewEncoder(&buf).Encode(body)
+		req := httptest.NewRequest(method, uri, &buf)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Less(t, w.Code, http.StatusBadRequest, w.Body.String())
+	}
+
+	request(http.MethodPost, "/items/batch", []gin.H{{"code": "a", "name": "a"}, {"code": "b", "name": "b"}})
+	request(http.MethodPut, "/items", gin.H{"ids": []string{"1", "2"}, "data": gin.H{"name": "c"}})
+	request(http.MethodDelete, "/items", gin.H{"ids": []string{"1", "2"}})
+	request(http.MethodPatch, "/items", gin.H{"ids": []string{"1"}})
+	request(http.MethodPost, "/items/upsert", gin.H{"code": "a", "name": "d"})
+	request(http.MethodPost, "/items/upsert", gin.H{"code": "c", "name": "e"})
+
+	var changes []history.Change
+	db.Order("id").Find(&changes)
+	actions := make([]string, 0, len(changes))
+	for _, change := range changes {
+		actions = append(actions, string(change.Action)+":"+change.RecordID)
+	}
+	// the id of the conflicting upsert is taken by the autoincrement of sqlite
+	assert.ElementsMatch(t, []string{
+		"create:1", "create:2", "update:1", "update:2", "delete:1", "delete:2", "recover:1", "update:1", "create:4",
+	}, actions)
+
+	var events []string
+	db.Model(&outbox.Event{}).Order("id").Pluck("name", &events)
+	assert.Equal(t, []string{
+		"outbox_item.created", "outbox_item.created", "outbox_item.updated", "outbox_item.updated",
+		"outbox_item.deleted", "outbox_item.deleted", "outbox_item.recovered", "outbox_item.updated",
+		"outbox_item.created",
+	}, events)
+}
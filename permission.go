@@ -0,0 +1,197 @@
+package cosy
+
+import (
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/uozi-tech/cosy/model"
+	"gorm.io/gorm/schema"
+)
+
+var roleResolver func(c *gin.Context) []string
+
+// SetRoleResolver sets the function to resolve the roles of the request, the roles are checked
+// by the read and write directives of the cosy tags, e.g. cosy:"read:role=admin|hr;write:role=hr".
+// The request has no role if the resolver is not set.
+func SetRoleResolver(resolver func(c *gin.Context) []string) {
+	roleResolver = resolver
+}
+
+// rolesOf returns the roles of the request, the resolver is called only once
+func (c *Ctx[T]) rolesOf() []string {
+	if !c.rolesResolved {
+		c.rolesResolved = true
+		if roleResolver != nil {
+			c.roles = roleResolver(c.Context)
+		}
+	}
+	return c.roles
+}
+
+// hasAnyRole reports whether any of the roles is allowed, empty allowed roles allow everyone
+func hasAnyRole(roles []string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	for _, role := range roles {
+		if slices.Contains(allowed, role) {
+			return true
+		}
+	}
+	return false
+}
+
+// deniedKeys returns the json keys, the cosy json keys and the columns of the fields
+// whose roles of the directive don't include any of the roles of the request
+func (c *Ctx[T]) deniedKeys(directive func(*model.CosyTag) []string) map[string]bool {
+	resolved := model.GetResolvedModel[T]()
+	if resolved == nil {
+		return nil
+	}
+
+	var keys map[string]bool
+	for _, field := range resolved.OrderedFields {
+		if hasAnyRole(c.rolesOf(), directive(&field.CosyTag)) {
+			continue
+		}
+		if keys == nil {
+			keys = make(map[string]bool)
+		}
+		for _, key := range []string{field.JsonTag, field.CosyTag.GetJson(), field.DBName} {
+			if key != "" && key != "-" {
+				keys[key] = true
+			}
+		}
+	}
+	return keys
+}
+
+// unreadableKeys returns the keys of the fields which can't be read by the request
+func (c *Ctx[T]) unreadableKeys() map[string]bool {
+	return c.deniedKeys((*model.CosyTag).GetReadRoles)
+}
+
+// dropUnwritableRules removes the rules of the fields which can't be written by the request,
+// so that the fields are filtered out of the payload
+func (c *Ctx[T]) dropUnwritableRules() {
+	for key := range c.deniedKeys((*model.CosyTag).GetWriteRoles) {
+		delete(c.rules, key)
+	}
+}
+
+// refuseUnreadableQueries responds 403 if the list is filtered or sorted by the fields
+// which can't be read by the request
+func (c *Ctx[T]) refuseUnreadableQueries() {
+	unreadable := c.unreadableKeys()
+	// the columns of the associations are checked by the cosy tags of the associated models
+	denied := func(key string) bool {
+		if isRelationPath(key) {
+			col, ok := c.relationColumnOf(key)
+			return ok && !col.readable(c.rolesOf())
+		}
+		return unreadable[key] || unreadable[c.resolveColumn(key)]
+	}
+
+	l := c.listService
+	filters := slices.Concat(l.in, l.eq, l.fussy, l.orIn, l.orEq, l.orFussy, l.between,
+		slices.Collect(l.customFilters.Keys()))
+	query := c.Request.URL.Query()
+	for _, key := range filters {
+		if (query.Has(key) || query.Has(key+"[]")) && denied(key) {
+			c.JSON(http.StatusForbidden, ErrForbidden)
+			c.Abort()
+			return
+		}
+	}
+
+	// the json columns are filtered by the dotted paths
+	for _, key := range l.json {
+		if !denied(key) {
+			continue
+		}
+		for name := range query {
+			if strings.HasPrefix(name, key+".") {
+				c.JSON(http.StatusForbidden, ErrForbidden)
+				c.Abort()
+				return
+			}
+		}
+	}
+
+	for _, col := range c.sortColumns() {
+		if denied(col.key) {
+			c.JSON(http.StatusForbidden, ErrForbidden)
+			c.Abort()
+			return
+		}
+	}
+}
+
+// readRestrictedCache caches whether the models are read restricted by the types
+var readRestrictedCache sync.Map
+
+// isReadRestricted reports whether any field of the model or its associations has the read directive,
+// which is resolved once per model
+func isReadRestricted[T any]() bool {
+	t := reflect.TypeFor[T]()
+	if restricted, ok := readRestrictedCache.Load(t); ok {
+		return restricted.(bool)
+	}
+	s := schemaOf[T]()
+	restricted := s != nil && readRestricted(s, make(map[*schema.Schema]bool))
+	readRestrictedCache.Store(t, restricted)
+	return restricted
+}
+
+// readRestricted reports whether any field of the model or its associations has the read directive
+func readRestricted(s *schema.Schema, visited map[*schema.Schema]bool) bool {
+	if visited[s] {
+		return false
+	}
+	visited[s] = true
+
+	for _, field := range s.Fields {
+		tag := model.NewCosyTag(field.Tag.Get("cosy"))
+		if len(tag.GetReadRoles()) > 0 {
+			return true
+		}
+	}
+	for _, rel := range s.Relationships.Relations {
+		if readRestricted(rel.FieldSchema, visited) {
+			return true
+		}
+	}
+	return false
+}
+
+// pruneUnreadable drops the json keys of the fields which can't be read by the roles,
+// the fields of the associations are checked by the cosy tags of the associated models
+func pruneUnreadable(value any, s *schema.Schema, roles []string) any {
+	switch v := value.(type) {
+	case map[string]any:
+		for _, field := range s.Fields {
+			tag := model.NewCosyTag(field.Tag.Get("cosy"))
+			if !hasAnyRole(roles, tag.GetReadRoles()) {
+				delete(v, jsonKeyOf(field))
+				if tag.GetJson() != "" {
+					delete(v, tag.GetJson())
+				}
+			}
+		}
+		for _, rel := range s.Relationships.Relations {
+			key := jsonKeyOf(rel.Field)
+			if item, ok := v[key]; ok {
+				v[key] = pruneUnreadable(item, rel.FieldSchema, roles)
+			}
+		}
+	case []any:
+		for i := range v {
+			v[i] = pruneUnreadable(v[i], s, roles)
+		}
+	}
+	return value
+}
@@ -0,0 +1,59 @@
+package cosy
+
+import (
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/uozi-tech/cosy/model"
+)
+
+type permissionModel struct {
+	model.Model
+	Name   string `json:"name" cosy:"all:omitempty"`
+	Salary int    `json:"salary" cosy:"all:omitempty;read:role=admin|hr;write:role=hr"`
+}
+
+func TestHasAnyRole(t *testing.T) {
+	assert.True(t, hasAnyRole(nil, nil))
+	assert.True(t, hasAnyRole([]string{"hr"}, []string{"admin", "hr"}))
+	assert.False(t, hasAnyRole([]string{"user"}, []string{"admin", "hr"}))
+	assert.False(t, hasAnyRole(nil, []string{"admin"}))
+}
+
+func TestReadRestricted(t *testing.T) {
+	assert.True(t, isReadRestricted[permissionModel]())
+	assert.False(t, isReadRestricted[versionedModel]())
+
+	// the schema is parsed once per model
+	assert.Same(t, schemaOf[permissionModel](), (&Ctx[permissionModel]{}).schema())
+}
+
+func TestFieldPermissions(t *testing.T) {
+	model.RegisterModels(permissionModel{})
+	model.ResolvedModels()
+
+	SetRoleResolver(func(c *gin.Context) []string {
+		return c.QueryArray("role")
+	})
+	defer SetRoleResolver(nil)
+
+	c, _ := newTenantContext("")
+	c.Request.URL.RawQuery = "role=admin"
+	core := Core[permissionModel](c)
+
+	assert.Empty(t, core.unreadableKeys())
+
+	core.rules = gin.H{"name": "omitempty", "salary": "omitempty"}
+	core.dropUnwritableRules()
+	assert.Equal(t, gin.H{"name": "omitempty"}, core.rules)
+
+	c, _ = newTenantContext("")
+	core = Core[permissionModel](c)
+	assert.True(t, core.unreadableKeys()["salary"])
+
+	data := core.pruneWithFieldset([]permissionModel{{Name: "test", Salary: 100}})
+	item := data.([]any)[0].(map[string]any)
+	assert.Equal(t, "test", item["name"])
+	assert.NotContains(t, item, "salary")
+}
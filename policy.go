@@ -0,0 +1,91 @@
+package cosy
+
+import (
+	"net/http"
+	"reflect"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/uozi-tech/cosy/model"
+	"gorm.io/gorm"
+)
+
+// ErrForbidden is responded with 403 when the access policy denies the request
+var ErrForbidden = &Error{
+	Code:    http.StatusForbidden,
+	Message: "forbidden",
+}
+
+// Policy is the row level access policy of a model
+type Policy[T any] interface {
+	// Scope restricts the records visible to the request, the records out of the scope are not found
+	Scope(c *gin.Context, tx *gorm.DB) *gorm.DB
+	// CanModify reports whether the record can be modified by the request
+	CanModify(c *gin.Context, record *T) bool
+	// CanDelete reports whether the record can be deleted or recovered by the request
+	CanDelete(c *gin.Context, record *T) bool
+}
+
+var (
+	policies   = make(map[reflect.Type]any)
+	policiesMu sync.RWMutex
+)
+
+// RegisterPolicy registers the access policy of the model, the policy is evaluated by
+// "get", "get list", "modify", "destroy", "recover" and the batch actions
+func RegisterPolicy[T any](policy Policy[T]) {
+	policiesMu.Lock()
+	defer policiesMu.Unlock()
+	policies[reflect.TypeFor[T]()] = policy
+}
+
+// policyOf returns the access policy of the model, nil if it's not registered
+func policyOf[T any]() Policy[T] {
+	policiesMu.RLock()
+	defer policiesMu.RUnlock()
+	policy, _ := policies[reflect.TypeFor[T]()].(Policy[T])
+	return policy
+}
+
+// scopePolicy restricts the query to the records visible to the request
+func (c *Ctx[T]) scopePolicy(tx *gorm.DB) *gorm.DB {
+	policy := policyOf[T]()
+	if policy == nil {
+		return tx
+	}
+	return policy.Scope(c.Context, tx)
+}
+
+// checkPolicy responds 403 if the record is denied by the policy
+func (c *Ctx[T]) checkPolicy(record *T, can func(Policy[T], *gin.Context, *T) bool) {
+	policy := policyOf[T]()
+	if policy == nil {
+		return
+	}
+	if !can(policy, c.Context, record) {
+		c.JSON(http.StatusForbidden, ErrForbidden)
+		c.Abort()
+	}
+}
+
+// checkBatchPolicy responds 403 if any of the records is denied by the policy,
+// the records out of the scope of the policy are ignored
+func (c *Ctx[T]) checkBatchPolicy(tx *gorm.DB, ids []model.IDType, can func(Policy[T], *gin.Context, *T) bool) {
+	if policyOf[T]() == nil {
+		return
+	}
+
+	var records []T
+	err := tx.Session(&gorm.Session{}).Model(new(T)).Where(c.itemKey+" IN ?", ids).Find(&records).Error
+	if err != nil {
+		c.AbortWithError(err)
+		return
+	}
+
+	for i := range records {
+		c.checkPolicy(&records[i], can)
+		if c.abort {
+			return
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package cosy
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/uozi-tech/cosy/model"
+	"gorm.io/gorm"
+)
+
+type policyModel struct {
+	model.Model
+	OwnerID uint64 `json:"owner_id"`
+}
+
+type ownerPolicy struct{}
+
+func (ownerPolicy) Scope(c *gin.Context, tx *gorm.DB) *gorm.DB {
+	return tx.Where("owner_id = ?", c.GetHeader("X-Tenant"))
+}
+
+func (ownerPolicy) CanModify(c *gin.Context, record *policyModel) bool {
+	return record.OwnerID == 1
+}
+
+func (ownerPolicy) CanDelete(c *gin.Context, record *policyModel) bool {
+	return false
+}
+
+func TestPolicy(t *testing.T) {
+	assert.Nil(t, policyOf[policyModel]())
+
+	RegisterPolicy[policyModel](ownerPolicy{})
+	assert.NotNil(t, policyOf[policyModel]())
+	assert.Nil(t, policyOf[tenantModel]())
+
+	c, w := newTenantContext("1")
+	core := Core[policyModel](c)
+	core.checkPolicy(&policyModel{OwnerID: 1}, Policy[policyModel].CanModify)
+	assert.False(t, core.abort)
+
+	core.checkPolicy(&policyModel{OwnerID: 1}, Policy[policyModel].CanDelete)
+	assert.True(t, core.abort)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+}
@@ -15,7 +15,7 @@ func (c *Ctx[T]) resolvePreloadWithScope() {
 
 func (c *Ctx[T]) resolvePreload(tx *gorm.DB) *gorm.DB {
 	for _, v := range c.preloads {
-		tx = tx.Preload(v)
+		tx = c.preloadWithFieldset(tx, v)
 	}
 	return tx
 }
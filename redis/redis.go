@@ -38,6 +38,12 @@ func GetClient() *redis.Client {
 	return rdb
 }
 
+// SetClient sets the Redis client instead of the one of Init, e.g. the existing client of the application,
+// nil means Redis isn't initialized
+func SetClient(client *redis.Client) {
+	rdb = client
+}
+
 // buildKey builds a key with the prefix
 func buildKey(key string) string {
 	var sb strings.Builder
@@ -0,0 +1,215 @@
+package cosy
+
+import (
+	"reflect"
+	"slices"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/uozi-tech/cosy/filter"
+	"github.com/uozi-tech/cosy/logger"
+	"github.com/uozi-tech/cosy/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// relationColumn is the column of an association referenced by a dotted path, e.g. "user.name"
+type relationColumn struct {
+	relation *schema.Relationship
+	field    *schema.Field
+}
+
+// relationFilter applies a filter of the list to the column of the association
+type relationFilter func(c *gin.Context, tx *gorm.DB, col filter.Column) *gorm.DB
+
+// isRelationPath reports whether the query key is a dotted path of an association
+func isRelationPath(key string) bool {
+	return strings.Contains(key, ".")
+}
+
+// parsedSchema parses the schema of the model with the naming strategy of the database
+func (c *Ctx[T]) parsedSchema() *schema.Schema {
+	db := model.UseDB(c.Context)
+	if db == nil {
+		return c.schema()
+	}
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(&c.Model); err != nil {
+		logger.Error(err)
+		return nil
+	}
+	return stmt.Schema
+}
+
+// relationColumnOf resolves the dotted path into the column of the association,
+// only the associations marked with cosy:"list:relation" are exposed
+func (c *Ctx[T]) relationColumnOf(path string) (*relationColumn, bool) {
+	name, key, ok := strings.Cut(path, ".")
+	if !ok {
+		return nil, false
+	}
+
+	s := c.parsedSchema()
+	if s == nil {
+		return nil, false
+	}
+
+	for _, rel := range s.Relationships.Relations {
+		if rel.Field == nil || jsonKeyOf(rel.Field) != name {
+			continue
+		}
+		tag := model.NewCosyTag(rel.Field.Tag.Get("cosy"))
+		if !slices.Contains(tag.GetList(), Relation) {
+			return nil, false
+		}
+		for _, field := range rel.FieldSchema.Fields {
+			if field.DBName != "" && jsonKeyOf(field) == key {
+				return &relationColumn{relation: rel, field: field}, true
+			}
+		}
+		return nil, false
+	}
+	return nil, false
+}
+
+// readable reports whether the association and its column can be read by the roles
+func (col *relationColumn) readable(roles []string) bool {
+	for _, field := range []*schema.Field{col.relation.Field, col.field} {
+		tag := model.NewCosyTag(field.Tag.Get("cosy"))
+		if !hasAnyRole(roles, tag.GetReadRoles()) {
+			return false
+		}
+	}
+	return true
+}
+
+// toOne reports whether the association has at most one record, only these associations can be sorted by
+func (col *relationColumn) toOne() bool {
+	return col.relation.Type == schema.BelongsTo || col.relation.Type == schema.HasOne
+}
+
+// alias returns the alias of the table of the association in the subqueries
+func (col *relationColumn) alias() string {
+	return "rel_" + strings.ToLower(col.relation.Name)
+}
+
+// subquery returns a query of the association correlated with the records of the table
+func (col *relationColumn) subquery(tx *gorm.DB, table string) *gorm.DB {
+	rel := col.relation
+	alias := col.alias()
+	sub := tx.Session(&gorm.Session{NewDB: true}).
+		Model(reflect.New(rel.FieldSchema.ModelType).Interface()).
+		Table(tx.Statement.Quote(rel.FieldSchema.Table) + " AS " + alias)
+
+	column := func(table string, field *schema.Field) clause.Column {
+		return clause.Column{Table: table, Name: field.DBName}
+	}
+
+	if rel.Type == schema.Many2Many && rel.JoinTable != nil {
+		join := tx.Session(&gorm.Session{NewDB: true}).Table(tx.Statement.Quote(rel.JoinTable.Table)).Select("1")
+		for _, ref := range rel.References {
+			if ref.OwnPrimaryKey {
+				join = join.Where(clause.Eq{Column: column(rel.JoinTable.Table, ref.ForeignKey), Value: column(table, ref.PrimaryKey)})
+			} else {
+				join = join.Where(clause.Eq{Column: column(rel.JoinTable.Table, ref.ForeignKey), Value: column(alias, ref.PrimaryKey)})
+			}
+		}
+		return sub.Where("EXISTS (?)", join)
+	}
+
+	for _, ref := range rel.References {
+		switch {
+		case ref.PrimaryKey == nil:
+			// the type of the polymorphic association
+			sub = sub.Where(clause.Eq{Column: column(alias, ref.ForeignKey), Value: ref.PrimaryValue})
+		case ref.OwnPrimaryKey:
+			sub = sub.Where(clause.Eq{Column: column(alias, ref.ForeignKey), Value: column(table, ref.PrimaryKey)})
+		default:
+			sub = sub.Where(clause.Eq{Column: column(alias, ref.PrimaryKey), Value: column(table, ref.ForeignKey)})
+		}
+	}
+	return sub
+}
+
+// relationTable returns the table of the model in the query
+func (c *Ctx[T]) relationTable() string {
+	if c.table != "" {
+		return c.table
+	}
+	if s := c.parsedSchema(); s != nil {
+		return s.Table
+	}
+	return ""
+}
+
+// whereCount returns the count of the conditions of the query
+func whereCount(tx *gorm.DB) int {
+	if where, ok := tx.Statement.Clauses["WHERE"].Expression.(clause.Where); ok {
+		return len(where.Exprs)
+	}
+	return 0
+}
+
+// setRelationFilter registers the filter of the dotted path as a gorm scope,
+// the records are matched if any record of the association matches the filter
+func (c *Ctx[T]) setRelationFilter(key string, apply relationFilter) {
+	col, ok := c.relationColumnOf(key)
+	if !ok {
+		logger.Errorf("Relation not found: %s", key)
+		return
+	}
+
+	c.gormScopes = append(c.gormScopes, func(tx *gorm.DB) *gorm.DB {
+		cond := apply(c.Context, tx.Session(&gorm.Session{NewDB: true}).Table(col.alias()), filter.Col(key, col.field.DBName))
+		if whereCount(cond) == 0 {
+			return tx
+		}
+		return tx.Where("EXISTS (?)", col.subquery(tx, c.relationTable()).Select("1").Where(cond))
+	})
+}
+
+// setRelationFilters registers the filters of the columns of the association by their own list directives,
+// e.g. the "user.name" fussy filter for the name field of the user marked with cosy:"list:fussy"
+func (c *Ctx[T]) setRelationFilters(name string) {
+	s := c.parsedSchema()
+	if s == nil {
+		return
+	}
+
+	for _, rel := range s.Relationships.Relations {
+		if rel.Field == nil || jsonKeyOf(rel.Field) != name {
+			continue
+		}
+		for _, field := range rel.FieldSchema.Fields {
+			if field.DBName == "" {
+				continue
+			}
+			key := name + "." + jsonKeyOf(field)
+			tag := model.NewCosyTag(field.Tag.Get("cosy"))
+			for _, dir := range tag.GetList() {
+				switch dir {
+				case In:
+					c.SetIn(key)
+				case Equal:
+					c.SetEqual(key)
+				case Fussy:
+					c.SetFussy(key)
+				}
+			}
+		}
+	}
+}
+
+// relationSortTarget returns the subquery of the column of the to-one association to sort by,
+// e.g. sort_by=user.name
+func (c *Ctx[T]) relationSortTarget(db *gorm.DB, key string) (*gorm.DB, bool) {
+	col, ok := c.relationColumnOf(key)
+	if !ok || !col.toOne() {
+		return nil, false
+	}
+
+	return col.subquery(db, c.relationTable()).
+		Select("?", clause.Column{Table: col.alias(), Name: col.field.DBName}).
+		Limit(1), true
+}
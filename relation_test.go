@@ -0,0 +1,78 @@
+package cosy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/uozi-tech/cosy/model"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type relationUser struct {
+	model.Model
+	Name   string `json:"name" cosy:"list:fussy"`
+	Secret string `json:"secret" cosy:"read:role=admin"`
+}
+
+type relationTag struct {
+	model.Model
+	Name string `json:"name"`
+}
+
+type relationOrder struct {
+	model.Model
+	UserID  uint64        `json:"user_id"`
+	User    *relationUser `json:"user" cosy:"list:relation"`
+	Tags    []relationTag `json:"tags" gorm:"many2many:relation_order_tags" cosy:"list:relation"`
+	OwnerID uint64        `json:"owner_id"`
+	Owner   *relationUser `json:"owner"`
+}
+
+func TestRelationColumn(t *testing.T) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	core := Core[relationOrder](c)
+
+	col, ok := core.relationColumnOf("user.name")
+	assert.True(t, ok)
+	assert.Equal(t, "name", col.field.DBName)
+	assert.True(t, col.toOne())
+	assert.True(t, col.readable(nil))
+
+	col, ok = core.relationColumnOf("user.secret")
+	assert.True(t, ok)
+	assert.False(t, col.readable(nil))
+	assert.True(t, col.readable([]string{"admin"}))
+
+	col, ok = core.relationColumnOf("tags.id")
+	assert.True(t, ok)
+	assert.False(t, col.toOne())
+
+	// the association isn't marked
+	_, ok = core.relationColumnOf("owner.name")
+	assert.False(t, ok)
+	// the field doesn't exist
+	_, ok = core.relationColumnOf("user.unknown")
+	assert.False(t, ok)
+	_, ok = core.relationColumnOf("name")
+	assert.False(t, ok)
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{DryRun: true})
+	assert.NoError(t, err)
+
+	sql := func(col *relationColumn) string {
+		return db.Model(&relationOrder{}).
+			Where("EXISTS (?)", col.subquery(db, "relation_orders").Select("1")).
+			Find(&[]relationOrder{}).Statement.SQL.String()
+	}
+
+	col, _ = core.relationColumnOf("user.name")
+	assert.Contains(t, sql(col), "EXISTS (SELECT 1 FROM `relation_users` AS rel_user WHERE `rel_user`.`id` = `relation_orders`.`user_id`")
+
+	col, _ = core.relationColumnOf("tags.id")
+	assert.Contains(t, sql(col), "EXISTS (SELECT 1 FROM `relation_order_tags` WHERE `relation_order_tags`.`relation_order_id` = `relation_orders`.`id` AND `relation_order_tags`.`relation_tag_id` = `rel_tags`.`id`)")
+}
@@ -7,6 +7,8 @@ type DataBase struct {
 	Password    string `json:"-,omitempty"`
 	Name        string `json:"name"`
 	TablePrefix string `json:"table_prefix"`
+	// FullTextLanguage is the text search configuration of postgres for the full-text search, e.g. english
+	FullTextLanguage string `json:"full_text_language"`
 }
 
 var DataBaseSettings = &DataBase{}
@@ -1,42 +1,239 @@
 package cosy
 
 import (
+	"reflect"
 	"strings"
 	"sync"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 	"gorm.io/gorm/schema"
 )
 
-func (c *Ctx[T]) sortOrder(db *gorm.DB) *gorm.DB {
-	if c.itemKey == "" {
-		return db
+// The positions of the nulls in the sort order
+const (
+	NullsFirst = "first"
+	NullsLast  = "last"
+)
+
+// sortColumn is a column of the sort order requested by the query
+type sortColumn struct {
+	// key is the query key of the column, e.g. "created_at", "createdAt" or "user.name"
+	key   string
+	desc  bool
+	nulls string
+}
+
+// parseSortOrder parses the order of the sort column, e.g. "desc", the default is used if it's invalid
+func parseSortOrder(order string, defaultDesc bool) bool {
+	switch order {
+	case "desc":
+		return true
+	case "asc":
+		return false
+	default:
+		return defaultDesc
 	}
+}
 
-	order := c.DefaultQuery("order", "desc")
-	if order != "desc" && order != "asc" {
-		order = "desc"
+// parseSortNulls parses the position of the nulls, it's empty if not specified or invalid
+func parseSortNulls(nulls string) string {
+	if nulls == NullsFirst || nulls == NullsLast {
+		return nulls
+	}
+	return ""
+}
+
+// sortColumns returns the columns of the sort order requested by the query, in the forms of
+//
+//	?sort=-priority,created_at:nulls_last
+//	?sort_by[]=priority&order[]=desc&nulls[]=last&sort_by[]=created_at&order[]=asc
+//	?sort_by=priority&order=desc&nulls=last
+//
+// the columns are sorted in descending order by default except in the sort form,
+// in which the "-" prefix means descending order.
+func (c *Ctx[T]) sortColumns() (columns []sortColumn) {
+	if sort := c.Query("sort"); sort != "" {
+		for item := range strings.SplitSeq(sort, ",") {
+			item = strings.TrimSpace(item)
+			key, nulls, _ := strings.Cut(item, ":")
+			col := sortColumn{key: key, nulls: parseSortNulls(strings.TrimPrefix(nulls, "nulls_"))}
+			if strings.HasPrefix(key, "-") {
+				col.key, col.desc = key[1:], true
+			}
+			col.key = strings.TrimPrefix(col.key, "+")
+			if col.key != "" {
+				columns = append(columns, col)
+			}
+		}
+		return
 	}
 
-	sortBy := c.DefaultQuery("sort_by", c.itemKey)
+	if sortBy := c.QueryArray("sort_by[]"); len(sortBy) > 0 {
+		orders := c.QueryArray("order[]")
+		nulls := c.QueryArray("nulls[]")
+		for i, key := range sortBy {
+			if key == "" {
+				continue
+			}
+			col := sortColumn{key: key, desc: true}
+			if i < len(orders) {
+				col.desc = parseSortOrder(orders[i], true)
+			}
+			if i < len(nulls) {
+				col.nulls = parseSortNulls(nulls[i])
+			}
+			columns = append(columns, col)
+		}
+		return
+	}
 
+	sortBy := c.DefaultQuery("sort_by", c.itemKey)
 	if sortBy == "" {
 		sortBy = c.itemKey
 	}
+	return []sortColumn{{
+		key:   sortBy,
+		desc:  parseSortOrder(c.DefaultQuery("order", "desc"), true),
+		nulls: parseSortNulls(c.Query("nulls")),
+	}}
+}
 
-	sortBy = c.resolveColumn(sortBy)
+// resolveSortColumn resolves the query key of the sort column into the column of the table,
+// ok is false if the column is neither a model field nor whitelisted
+func (c *Ctx[T]) resolveSortColumn(s *schema.Schema, key string) (column string, ok bool) {
+	column = c.resolveColumn(key)
+	if _, exist := s.FieldsByDBName[column]; !exist && column != c.itemKey && !c.columnWhiteList[column] {
+		return "", false
+	}
+	return column, true
+}
 
-	s, _ := schema.Parse(c.Model, &sync.Map{}, schema.NamingStrategy{})
-	if _, ok := s.FieldsByDBName[sortBy]; !ok && sortBy != c.itemKey && !c.columnWhiteList[sortBy] {
+// sortTarget returns the column of the sort order, the columns of the model are qualified by the table,
+// so that they're not ambiguous with the joined tables, the whitelisted columns are used as they are
+func sortTarget(s *schema.Schema, column string) clause.Column {
+	if _, ok := s.FieldsByDBName[column]; ok {
+		return clause.Column{Table: clause.CurrentTable, Name: column}
+	}
+	return clause.Column{Name: column}
+}
+
+// sortOrder sorts the list by the columns requested by the query, the invalid columns are ignored
+// and the item key is appended as the tiebreaker. The position of the nulls is expressed by sorting
+// by "column IS NULL" first, which is supported by all the databases.
+func (c *Ctx[T]) sortOrder(db *gorm.DB) *gorm.DB {
+	if c.itemKey == "" {
+		return db
+	}
+	s := c.schema()
+	if s == nil {
 		return db
 	}
 
-	var sb strings.Builder
-	sb.WriteString(sortBy)
-	sb.WriteString(" ")
-	sb.WriteString(order)
+	var exprs []clause.Expression
+	add := func(target any, sql string, col sortColumn) {
+		direction := " ASC"
+		if col.desc {
+			direction = " DESC"
+		}
+		switch col.nulls {
+		case NullsFirst:
+			exprs = append(exprs, clause.Expr{SQL: sql + " IS NULL DESC", Vars: []any{target}})
+		case NullsLast:
+			exprs = append(exprs, clause.Expr{SQL: sql + " IS NULL ASC", Vars: []any{target}})
+		}
+		exprs = append(exprs, clause.Expr{SQL: sql + direction, Vars: []any{target}})
+	}
 
-	return db.Order(sb.String())
+	tiebreaker := true
+	last := sortColumn{desc: true}
+	for _, col := range c.sortColumns() {
+		if col.key == SortRelevance {
+			if relevance, ok := c.fullTextRelevance(db); ok {
+				add(relevance, "?", col)
+				last = col
+			}
+			continue
+		}
+		// the whitelisted columns of the joined tables are not the paths of the associations, e.g. "users.name"
+		if isRelationPath(col.key) && !c.columnWhiteList[c.resolveColumn(col.key)] {
+			sub, ok := c.relationSortTarget(db, col.key)
+			if !ok {
+				continue
+			}
+			add(sub, "(?)", col)
+			last = col
+			continue
+		}
+
+		column, ok := c.resolveSortColumn(s, col.key)
+		if !ok {
+			continue
+		}
+		add(sortTarget(s, column), "?", col)
+		last = col
+		if column == c.itemKey {
+			tiebreaker = false
+		}
+	}
+
+	if tiebreaker {
+		add(clause.Column{Table: clause.CurrentTable, Name: c.itemKey}, "?", sortColumn{desc: last.desc})
+	}
+
+	// keep the orders added by the scopes before
+	if prev, ok := db.Statement.Clauses["ORDER BY"]; ok && prev.Expression != nil {
+		exprs = append([]clause.Expression{prev.Expression}, exprs...)
+	}
+
+	return db.Order(clause.OrderBy{Expression: clause.CommaExpression{Exprs: exprs}})
+}
+
+// resolveSortBy resolves the first requested sort column and direction,
+// ok is false if the column is neither a model field nor whitelisted
+func (c *Ctx[T]) resolveSortBy() (sortBy string, order string, ok bool) {
+	if c.itemKey == "" {
+		return
+	}
+
+	columns := c.sortColumns()
+	if len(columns) == 0 {
+		columns = []sortColumn{{key: c.itemKey, desc: true}}
+	}
+
+	order = "asc"
+	if columns[0].desc {
+		order = "desc"
+	}
+
+	s := c.schema()
+	if s == nil {
+		return
+	}
+	sortBy, ok = c.resolveSortColumn(s, columns[0].key)
+	return
+}
+
+// schemaCache caches the parsed gorm schemas of the models by the types
+var schemaCache sync.Map
+
+// schema returns the gorm schema of the model, which is parsed once per model
+func (c *Ctx[T]) schema() *schema.Schema {
+	return schemaOf[T]()
+}
+
+// schemaOf returns the cached gorm schema of the model, nil if it can't be parsed
+func schemaOf[T any]() *schema.Schema {
+	t := reflect.TypeFor[T]()
+	if s, ok := schemaCache.Load(t); ok {
+		return s.(*schema.Schema)
+	}
+	s, err := schema.Parse(new(T), &sync.Map{}, schema.NamingStrategy{})
+	if err != nil {
+		return nil
+	}
+	actual, _ := schemaCache.LoadOrStore(t, s)
+	return actual.(*schema.Schema)
 }
 
 func (c *Ctx[T]) paginate(db *gorm.DB) *gorm.DB {
@@ -0,0 +1,55 @@
+package cosy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func newSortCore(query string) *Ctx[relationOrder] {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/orders?"+query, nil)
+	return Core[relationOrder](c)
+}
+
+func TestSortColumns(t *testing.T) {
+	assert.Equal(t, []sortColumn{{key: "id", desc: true}}, newSortCore("").sortColumns())
+	assert.Equal(t, []sortColumn{{key: "user_id", nulls: NullsLast}},
+		newSortCore("sort_by=user_id&order=asc&nulls=last").sortColumns())
+	assert.Equal(t, []sortColumn{{key: "user_id", desc: true, nulls: NullsFirst}, {key: "created_at"}},
+		newSortCore("sort=-user_id:nulls_first,created_at").sortColumns())
+	assert.Equal(t, []sortColumn{{key: "user_id"}, {key: "created_at", desc: true, nulls: NullsLast}},
+		newSortCore("sort_by[]=user_id&order[]=asc&nulls[]=&sort_by[]=created_at&nulls[]=last").sortColumns())
+}
+
+func TestSortOrder(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{DryRun: true})
+	assert.NoError(t, err)
+
+	sql := func(query string) string {
+		return db.Model(&relationOrder{}).Scopes(newSortCore(query).sortOrder).
+			Find(&[]relationOrder{}).Statement.SQL.String()
+	}
+
+	assert.Contains(t, sql(""), "ORDER BY `relation_orders`.`id` DESC")
+	assert.Contains(t, sql("sort=-user_id,created_at"),
+		"ORDER BY `relation_orders`.`user_id` DESC, `relation_orders`.`created_at` ASC, `relation_orders`.`id` ASC")
+	assert.Contains(t, sql("sort_by[]=user_id&order[]=asc&nulls[]=last&sort_by[]=id"),
+		"ORDER BY `relation_orders`.`user_id` IS NULL ASC, `relation_orders`.`user_id` ASC, `relation_orders`.`id` DESC")
+	// the invalid columns are ignored
+	assert.Contains(t, sql("sort=unknown,-user_id"), "ORDER BY `relation_orders`.`user_id` DESC, `relation_orders`.`id` DESC")
+	// the columns of the to-one associations
+	assert.Contains(t, sql("sort=user.name"), "ORDER BY (SELECT `rel_user`.`name` FROM `relation_users` AS rel_user")
+
+	// the whitelisted columns of the joined tables are used as they are
+	core := newSortCore("sort_by=User.name&order=asc")
+	core.AddColWhiteList("User.name")
+	assert.Contains(t, db.Model(&relationOrder{}).Joins("User").Scopes(core.sortOrder).
+		Find(&[]relationOrder{}).Statement.SQL.String(),
+		"ORDER BY `User`.`name` ASC, `relation_orders`.`id` ASC")
+}
@@ -0,0 +1,133 @@
+package cosy
+
+import (
+	"net/http"
+	"reflect"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cast"
+	"github.com/uozi-tech/cosy/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrTenantRequired is responded with 403 when the tenant of the request can't be resolved
+var ErrTenantRequired = &Error{
+	Code:    http.StatusForbidden,
+	Message: "tenant is required",
+}
+
+var tenantResolver func(c *gin.Context) (tenant any, ok bool)
+
+// SetTenantResolver sets the function to resolve the tenant of the request, e.g. from a header,
+// a JWT claim or the subdomain. The models with a field marked with cosy:"tenant" are scoped to the tenant,
+// the requests are responded with 403 if the resolver returns false.
+func SetTenantResolver(resolver func(c *gin.Context) (tenant any, ok bool)) {
+	tenantResolver = resolver
+}
+
+// TenantOf returns the tenant of the request for the handlers outside of Ctx, the tenant is nil if the resolver
+// isn't set, and ErrTenantRequired is returned if the resolver can't resolve the tenant
+func TenantOf(c *gin.Context) (any, error) {
+	if tenantResolver == nil {
+		return nil, nil
+	}
+	tenant, ok := tenantResolver(c)
+	if !ok || tenant == nil {
+		return nil, ErrTenantRequired
+	}
+	return tenant, nil
+}
+
+// WithoutTenant disables the tenant scope of the model, e.g. for the administrators of the platform
+func (c *Ctx[T]) WithoutTenant() *Ctx[T] {
+	c.withoutTenant = true
+	return c
+}
+
+// tenantField returns the field marked with cosy:"tenant",
+// nil means the model is not scoped to the tenant
+func tenantField[T any]() *model.ResolvedModelField {
+	resolved := model.GetResolvedModel[T]()
+	if resolved == nil {
+		return nil
+	}
+	for _, field := range resolved.OrderedFields {
+		if field.CosyTag.GetTenant() {
+			return field
+		}
+	}
+	return nil
+}
+
+// tenantScopeField returns the tenant field if the tenant scope is enabled
+func (c *Ctx[T]) tenantScopeField() *model.ResolvedModelField {
+	if tenantResolver == nil || c.withoutTenant {
+		return nil
+	}
+	return tenantField[T]()
+}
+
+// tenantOf returns the tenant of the request, the resolver is called only once
+func (c *Ctx[T]) tenantOf() (any, bool) {
+	if c.tenant == nil && tenantResolver != nil {
+		if tenant, ok := tenantResolver(c.Context); ok {
+			c.tenant = tenant
+		}
+	}
+	return c.tenant, c.tenant != nil
+}
+
+// resolveTenant responds 403 if the model is scoped to the tenant and the tenant can't be resolved
+func (c *Ctx[T]) resolveTenant() {
+	if c.tenantScopeField() == nil {
+		return
+	}
+	if _, ok := c.tenantOf(); !ok {
+		c.JSON(http.StatusForbidden, ErrTenantRequired)
+		c.Abort()
+	}
+}
+
+// scopeTenant restricts the query to the records of the tenant
+func (c *Ctx[T]) scopeTenant(tx *gorm.DB) *gorm.DB {
+	field := c.tenantScopeField()
+	if field == nil {
+		return tx
+	}
+	// an unresolved tenant matches nothing but the records without tenant
+	return tx.Where(clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: c.tenantValue(field)})
+}
+
+// tenantValue returns the tenant of the request as a string if the tenant field is a string, e.g. the numeric
+// tenants of the models shared by the applications, since postgres doesn't compare them with the strings
+func (c *Ctx[T]) tenantValue(field *model.ResolvedModelField) any {
+	tenant, ok := c.tenantOf()
+	if !ok {
+		return tenant
+	}
+	if s := c.schema(); s != nil {
+		if f := s.LookUpField(field.Name); f != nil && f.IndirectFieldType.Kind() == reflect.String {
+			return cast.ToString(tenant)
+		}
+	}
+	return tenant
+}
+
+// setTenant sets the tenant of the record, so that the tenant can't be changed by the payload
+func (c *Ctx[T]) setTenant(record *T) error {
+	field := c.tenantScopeField()
+	if field == nil {
+		return nil
+	}
+	s := c.schema()
+	if s == nil {
+		return nil
+	}
+	f := s.LookUpField(field.Name)
+	if f == nil {
+		return nil
+	}
+	tenant, _ := c.tenantOf()
+	return f.Set(c.Request.Context(), reflect.ValueOf(record).Elem(), tenant)
+}
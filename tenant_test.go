@@ -0,0 +1,150 @@
+package cosy
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/uozi-tech/cosy/logger"
+	"github.com/uozi-tech/cosy/model"
+	"gorm.io/driver/sqlite"
+)
+
+type tenantModel struct {
+	model.Model
+	TenantID uint64 `json:"tenant_id" cosy:"tenant"`
+	Name     string `json:"name"`
+}
+
+type tenantItem struct {
+	model.Model
+	TenantID uint64 `json:"tenant_id" cosy:"tenant"`
+	Name     string `json:"name" cosy:"add:required;update:omitempty"`
+}
+
+func newTenantContext(tenant string) (*gin.Context, *httptest.ResponseRecorder) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/", nil)
+	if tenant != "" {
+		c.Request.Header.Set("X-Tenant", tenant)
+	}
+	return c, w
+}
+
+func TestTenant(t *testing.T) {
+	model.RegisterModels(tenantModel{})
+	model.ResolvedModels()
+
+	assert.Equal(t, "TenantID", tenantField[tenantModel]().Name)
+	assert.Nil(t, tenantField[versionedModel]())
+
+	// disabled without resolver
+	c, _ := newTenantContext("")
+	assert.Nil(t, Core[tenantModel](c).tenantScopeField())
+	tenant, err := TenantOf(c)
+	assert.NoError(t, err)
+	assert.Nil(t, tenant)
+
+	SetTenantResolver(func(c *gin.Context) (any, bool) {
+		tenant := c.GetHeader("X-Tenant")
+		return tenant, tenant != ""
+	})
+	defer SetTenantResolver(nil)
+
+	c, w := newTenantContext("")
+	core := Core[tenantModel](c)
+	core.resolveTenant()
+	assert.True(t, core.abort)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	_, err = TenantOf(c)
+	assert.ErrorIs(t, err, ErrTenantRequired)
+
+	c, _ = newTenantContext("")
+	core = Core[tenantModel](c).WithoutTenant()
+	core.resolveTenant()
+	assert.False(t, core.abort)
+
+	c, _ = newTenantContext("2")
+	core = Core[tenantModel](c)
+	core.resolveTenant()
+	assert.False(t, core.abort)
+	tenant, err = TenantOf(c)
+	assert.NoError(t, err)
+	assert.Equal(t, "2", tenant)
+
+	// the tenant in the payload is overwritten
+	record := tenantModel{TenantID: 1, Name: "test"}
+	assert.NoError(t, core.setTenant(&record))
+	assert.Equal(t, uint64(2), record.TenantID)
+}
+
+func TestTenantApi(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger.Init(gin.TestMode)
+	model.ClearCollection()
+	model.RegisterModels(tenantItem{})
+	db := model.Init(sqlite.Open(filepath.Join(t.TempDir(), "tenant.db")))
+
+	SetTenantResolver(func(c *gin.Context) (any, bool) {
+		tenant := c.GetHeader("X-Tenant")
+		return tenant, tenant != ""
+	})
+	defer SetTenantResolver(nil)
+
+	r := gin.New()
+	Api[tenantItem]("items").InitRouter(r.Group(""))
+
+	request := func(tenant, method, uri string, body any) (int, string) {
+		var buf bytes.Buffer
+		if body != nil {
+			_ = json.NewEncoder(&buf).Encode(body)
+		}
+		req := httptest.NewRequest(method, uri, &buf)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Tenant", tenant)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code, w.Body.String()
+	}
+
+	code, resp := request("1", http.MethodPost, "/items", gin.H{"name": "first", "tenant_id": 2})
+	assert.Equal(t, http.StatusOK, code, resp)
+	assert.Contains(t, resp, `"tenant_id":1`)
+	code, resp = request("2", http.MethodPost, "/items", gin.H{"name": "second"})
+	assert.Equal(t, http.StatusOK, code, resp)
+
+	// the record of the other tenant is neither readable nor writable
+	code, _ = request("2", http.MethodGet, "/items/1", nil)
+	assert.Equal(t, http.StatusNotFound, code)
+	code, resp = request("2", http.MethodGet, "/items", nil)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, resp, `"name":"second"`)
+	assert.NotContains(t, resp, `"name":"first"`)
+	code, _ = request("2", http.MethodPost, "/items/1", gin.H{"name": "changed"})
+	assert.Equal(t, http.StatusNotFound, code)
+	code, _ = request("2", http.MethodDelete, "/items/1", nil)
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, _ = request("1", http.MethodDelete, "/items/1", nil)
+	assert.Equal(t, http.StatusNoContent, code)
+	code, _ = request("2", http.MethodPatch, "/items/1", nil)
+	assert.Equal(t, http.StatusNotFound, code)
+
+	var item tenantItem
+	assert.NoError(t, db.Unscoped().First(&item, 1).Error)
+	assert.Equal(t, "first", item.Name)
+	assert.NotNil(t, item.DeletedAt)
+
+	// the owner can still read and recover it
+	code, _ = request("1", http.MethodPatch, "/items/1", nil)
+	assert.Equal(t, http.StatusNoContent, code)
+	code, resp = request("1", http.MethodGet, "/items/1", nil)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, resp, `"name":"first"`)
+}
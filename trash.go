@@ -0,0 +1,351 @@
+package cosy
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bsm/redislock"
+	"github.com/gin-gonic/gin"
+	"github.com/go-co-op/gocron/v2"
+	"github.com/uozi-tech/cosy/cron"
+	"github.com/uozi-tech/cosy/kernel"
+	"github.com/uozi-tech/cosy/logger"
+	"github.com/uozi-tech/cosy/model"
+	"github.com/uozi-tech/cosy/redis"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// TrashPurgeJob is the name of the built-in cron job which purges the expired deleted records
+const TrashPurgeJob = "trash_purge"
+
+const trashPurgeLockKey = "trash:purge"
+
+// TrashPurgeOptions is the options of the purge of the expired deleted records
+type TrashPurgeOptions struct {
+	// Interval is the interval of the cron job
+	Interval time.Duration
+	// BatchSize is the count of the records purged in a transaction
+	BatchSize int
+}
+
+var trashPurgeOptions = TrashPurgeOptions{
+	Interval:  time.Hour,
+	BatchSize: 500,
+}
+
+// SetTrashPurgeOptions sets the options of the purge, the zero fields are left unchanged,
+// it should be called before the cron is started
+func SetTrashPurgeOptions(o TrashPurgeOptions) {
+	if o.Interval > 0 {
+		trashPurgeOptions.Interval = o.Interval
+	}
+	if o.BatchSize > 0 {
+		trashPurgeOptions.BatchSize = o.BatchSize
+	}
+}
+
+// trashPolicy is the retention and the purge hooks of a model
+type trashPolicy struct {
+	retention time.Duration
+	hooks     []func(tx *gorm.DB, records any) error
+}
+
+var (
+	trashPolicies   = make(map[reflect.Type]*trashPolicy)
+	trashPoliciesMu sync.RWMutex
+)
+
+func init() {
+	cron.RegisterJob(TrashPurgeJob, func(s gocron.Scheduler) {
+		_, err := s.NewJob(
+			gocron.DurationJob(trashPurgeOptions.Interval),
+			gocron.NewTask(runTrashPurge),
+			gocron.WithSingletonMode(gocron.LimitModeReschedule),
+		)
+		if err != nil {
+			logger.Error(err)
+		}
+	})
+}
+
+// trashPolicyOf returns the policy of the type, the caller must hold the lock
+func trashPolicyOf(t reflect.Type) *trashPolicy {
+	p, ok := trashPolicies[t]
+	if !ok {
+		p = &trashPolicy{}
+		trashPolicies[t] = p
+	}
+	return p
+}
+
+// RegisterTrashRetention sets the retention of the deleted records of the model, after which the records
+// are purged permanently, it overrides the trash_retention directive of the cosy tag
+func RegisterTrashRetention[T any](retention time.Duration) {
+	trashPoliciesMu.Lock()
+	defer trashPoliciesMu.Unlock()
+	trashPolicyOf(reflect.TypeFor[T]()).retention = retention
+}
+
+// BeforePurge registers the hooks called with each batch of the expired deleted records before they're purged,
+// e.g. to clean up the files and the associations. The hooks run in the transaction of the purge,
+// an error rolls back the batch and stops the purge of the model.
+func BeforePurge[T any](hooks ...func(tx *gorm.DB, records []*T) error) {
+	trashPoliciesMu.Lock()
+	defer trashPoliciesMu.Unlock()
+	p := trashPolicyOf(reflect.TypeFor[T]())
+	for _, hook := range hooks {
+		p.hooks = append(p.hooks, func(tx *gorm.DB, records any) error {
+			return hook(tx, *records.(*[]*T))
+		})
+	}
+}
+
+// trashRetentionTag returns the retention of the trash_retention directive, which is in the cosy tag
+// of the DeletedAt field or of an embedded struct, e.g. model.Model `cosy:"trash_retention:30d"`
+func trashRetentionTag(t reflect.Type) (time.Duration, bool) {
+	tag, ok := model.LookupCosyTag(t, func(tag model.CosyTag) bool {
+		_, ok := tag.GetTrashRetention()
+		return ok
+	})
+	if !ok {
+		return 0, false
+	}
+	return tag.GetTrashRetention()
+}
+
+// trashTarget is a model whose expired deleted records are purged
+type trashTarget struct {
+	typ       reflect.Type
+	retention time.Duration
+	hooks     []func(tx *gorm.DB, records any) error
+}
+
+// trashTargets returns the registered models with a retention, ordered by the name
+func trashTargets() (targets []trashTarget) {
+	trashPoliciesMu.RLock()
+	defer trashPoliciesMu.RUnlock()
+
+	seen := make(map[reflect.Type]bool)
+	add := func(t reflect.Type) {
+		if seen[t] {
+			return
+		}
+		seen[t] = true
+		target := trashTarget{typ: t}
+		if retention, ok := trashRetentionTag(t); ok {
+			target.retention = retention
+		}
+		if p, ok := trashPolicies[t]; ok {
+			if p.retention > 0 {
+				target.retention = p.retention
+			}
+			target.hooks = p.hooks
+		}
+		if target.retention > 0 {
+			targets = append(targets, target)
+		}
+	}
+
+	for _, m := range model.GenerateAllModel() {
+		t := reflect.TypeOf(m)
+		for t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		if t.Kind() == reflect.Struct {
+			add(t)
+		}
+	}
+	for t := range trashPolicies {
+		add(t)
+	}
+
+	slices.SortFunc(targets, func(a, b trashTarget) int {
+		return strings.Compare(a.typ.Name(), b.typ.Name())
+	})
+	return
+}
+
+// expiredTrash returns the query of the records of the model deleted before the time, ok is false if the model
+// has no primary key or no soft delete field. The integer deleted_at is compared in the unit of the softDelete tag.
+func expiredTrash(db *gorm.DB, t reflect.Type, before time.Time) (tx *gorm.DB, s *schema.Schema, ok bool) {
+	stmt := &gorm.Statement{DB: db}
+	if err := stmt.Parse(reflect.New(t).Interface()); err != nil {
+		logger.Error(err)
+		return nil, nil, false
+	}
+	s = stmt.Schema
+	if s.PrioritizedPrimaryField == nil {
+		return nil, nil, false
+	}
+
+	field := s.LookUpField("DeletedAt")
+	if field == nil {
+		return nil, nil, false
+	}
+	column := clause.Column{Name: field.DBName}
+	tx = db.Unscoped().Model(reflect.New(t).Interface())
+
+	switch field.DataType {
+	case schema.Int, schema.Uint:
+		unit := strings.ToLower(field.TagSettings["SOFTDELETE"])
+		var cutoff int64
+		switch {
+		case strings.Contains(unit, "flag"):
+			logger.Warnf("trash retention of %s is skipped, the soft delete flag has no deletion time", t.Name())
+			return nil, nil, false
+		case strings.Contains(unit, "nano"):
+			cutoff = before.UnixNano()
+		case strings.Contains(unit, "milli"):
+			cutoff = before.UnixMilli()
+		default:
+			cutoff = before.Unix()
+		}
+		tx = tx.Where("? <> 0 AND ? < ?", column, column, cutoff)
+	default:
+		tx = tx.Where("? IS NOT NULL AND ? < ?", column, column, before)
+	}
+	return tx, s, true
+}
+
+// TrashPurgeReport is the report of the expired deleted records of a model
+type TrashPurgeReport struct {
+	Model     string    `json:"model"`
+	Table     string    `json:"table"`
+	Retention string    `json:"retention"`
+	Before    time.Time `json:"before"`
+	Count     int64     `json:"count"`
+}
+
+// PurgeTrash permanently deletes the expired deleted records of the models with a retention in batches,
+// and reports the count of the records of each model. If dryRun is true, nothing is deleted and the reports
+// are the counts of the records which would be purged.
+func PurgeTrash(ctx context.Context, dryRun bool) ([]TrashPurgeReport, error) {
+	reports := make([]TrashPurgeReport, 0)
+	db := model.UseDB(ctx)
+	if db == nil {
+		return reports, nil
+	}
+
+	now := time.Now()
+	var errs []error
+	for _, target := range trashTargets() {
+		before := now.Add(-target.retention)
+		tx, s, ok := expiredTrash(db, target.typ, before)
+		if !ok {
+			continue
+		}
+		report := TrashPurgeReport{
+			Model:     target.typ.Name(),
+			Table:     s.Table,
+			Retention: target.retention.String(),
+			Before:    before,
+		}
+
+		var err error
+		if dryRun {
+			err = tx.Count(&report.Count).Error
+		} else {
+			report.Count, err = purgeTrash(db, target, before)
+			if report.Count > 0 {
+				invalidateCache(target.typ.Name())
+			}
+		}
+		if err != nil {
+			errs = append(errs, err)
+		}
+		reports = append(reports, report)
+	}
+	return reports, errors.Join(errs...)
+}
+
+// purgeTrash purges the expired deleted records of the model in batches, each batch is selected and deleted
+// in a transaction with the hooks
+func purgeTrash(db *gorm.DB, target trashTarget, before time.Time) (purged int64, err error) {
+	for {
+		var count int
+		err = db.Transaction(func(tx *gorm.DB) error {
+			expired, s, _ := expiredTrash(tx, target.typ, before)
+			// the statements below must not share the conditions
+			expired = expired.Session(&gorm.Session{})
+
+			// the batch is locked, so that the records can't be recovered before they are deleted
+			records := reflect.New(reflect.SliceOf(reflect.PointerTo(target.typ)))
+			err := expired.Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate}).
+				Order(clause.OrderByColumn{Column: clause.Column{Name: s.PrioritizedPrimaryField.DBName}}).
+				Limit(trashPurgeOptions.BatchSize).Find(records.Interface()).Error
+			if err != nil {
+				return err
+			}
+			count = records.Elem().Len()
+			if count == 0 {
+				return nil
+			}
+
+			for _, hook := range target.hooks {
+				if err := hook(tx, records.Interface()); err != nil {
+					return err
+				}
+			}
+			// the expiration is checked again for the databases without the row locks, e.g. sqlite,
+			// so that the records recovered after the batch is selected aren't deleted
+			result := expired.Delete(records.Interface())
+			if result.Error != nil {
+				return result.Error
+			}
+			purged += result.RowsAffected
+			return nil
+		})
+		if err != nil || count < trashPurgeOptions.BatchSize {
+			return
+		}
+	}
+}
+
+// runTrashPurge runs the purge by the cron job, only one instance runs it if redis is initialized
+func runTrashPurge() {
+	kernel.Run(context.Background(), TrashPurgeJob, func(ctx context.Context) {
+		if redis.GetClient() != nil {
+			lock, err := redis.ObtainLock(trashPurgeLockKey, trashPurgeOptions.Interval, nil)
+			if errors.Is(err, redislock.ErrNotObtained) {
+				return
+			}
+			if err != nil {
+				logger.Error(err)
+				return
+			}
+			defer func() {
+				if err := lock.Release(context.Background()); err != nil && !errors.Is(err, redislock.ErrLockNotHeld) {
+					logger.Error(err)
+				}
+			}()
+		}
+
+		reports, err := PurgeTrash(ctx, false)
+		if err != nil {
+			logger.Error(err)
+		}
+		for _, report := range reports {
+			if report.Count > 0 {
+				logger.Infof("purged %d deleted records of %s before %s", report.Count, report.Table, report.Before.Format(time.RFC3339))
+			}
+		}
+	})
+}
+
+// TrashReport responds the reports of the expired deleted records which would be purged, nothing is deleted
+func TrashReport(c *gin.Context) {
+	reports, err := PurgeTrash(c, true)
+	if err != nil {
+		errHandler(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, reports)
+}
@@ -0,0 +1,131 @@
+package cosy
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/uozi-tech/cosy/logger"
+	"github.com/uozi-tech/cosy/model"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type trashNote struct {
+	model.Model `cosy:"trash_retention:1h"`
+	Name        string `json:"name"`
+}
+
+type trashTicket struct {
+	ID        uint64 `json:"id" gorm:"primaryKey"`
+	Name      string `json:"name"`
+	DeletedAt int64  `json:"deleted_at" gorm:"default:0;index"`
+}
+
+type trashDraft struct {
+	model.Model
+	Name string `json:"name"`
+}
+
+func TestTrashRetentionTag(t *testing.T) {
+	retention, ok := trashRetentionTag(reflect.TypeFor[trashNote]())
+	assert.True(t, ok)
+	assert.Equal(t, time.Hour, retention)
+
+	_, ok = trashRetentionTag(reflect.TypeFor[trashDraft]())
+	assert.False(t, ok)
+}
+
+func TestPurgeTrash(t *testing.T) {
+	logger.Init(gin.TestMode)
+	model.ClearCollection()
+	model.RegisterModels(trashNote{}, trashTicket{}, trashDraft{})
+	db := model.Init(sqlite.Open(filepath.Join(t.TempDir(), "trash.db")))
+
+	SetTrashPurgeOptions(TrashPurgeOptions{BatchSize: 2})
+	defer SetTrashPurgeOptions(TrashPurgeOptions{BatchSize: 500})
+	RegisterTrashRetention[trashTicket](24 * time.Hour)
+
+	var purged []string
+	BeforePurge(func(tx *gorm.DB, records []*trashNote) error {
+		for _, record := range records {
+			purged = append(purged, record.Name)
+		}
+		return nil
+	})
+
+	now := time.Now()
+	expired := &gorm.DeletedAt{Time: now.Add(-2 * time.Hour), Valid: true}
+	recent := &gorm.DeletedAt{Time: now.Add(-time.Minute), Valid: true}
+	db.Create(&[]trashNote{
+		{Model: model.Model{DeletedAt: expired}, Name: "expired-1"},
+		{Model: model.Model{DeletedAt: expired}, Name: "expired-2"},
+		{Model: model.Model{DeletedAt: expired}, Name: "expired-3"},
+		{Model: model.Model{DeletedAt: recent}, Name: "recent"},
+		{Name: "alive"},
+	})
+	db.Create(&[]trashTicket{
+		{Name: "expired", DeletedAt: now.Add(-48 * time.Hour).Unix()},
+		{Name: "recent", DeletedAt: now.Add(-time.Hour).Unix()},
+		{Name: "alive"},
+	})
+	db.Create(&trashDraft{Model: model.Model{DeletedAt: expired}, Name: "kept"})
+
+	ctx := context.Background()
+	reports, err := PurgeTrash(ctx, true)
+	assert.NoError(t, err)
+	if assert.Len(t, reports, 2) {
+		assert.Equal(t, "trashNote", reports[0].Model)
+		assert.Equal(t, int64(3), reports[0].Count)
+		assert.Equal(t, "trashTicket", reports[1].Model)
+		assert.Equal(t, int64(1), reports[1].Count)
+	}
+
+	var count int64
+	db.Unscoped().Model(&trashNote{}).Count(&count)
+	assert.Equal(t, int64(5), count)
+
+	reports, err = PurgeTrash(ctx, false)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), reports[0].Count)
+	assert.Equal(t, int64(1), reports[1].Count)
+	assert.ElementsMatch(t, []string{"expired-1", "expired-2", "expired-3"}, purged)
+
+	var notes []string
+	db.Unscoped().Model(&trashNote{}).Order("id").Pluck("name", &notes)
+	assert.Equal(t, []string{"recent", "alive"}, notes)
+	var tickets []string
+	db.Model(&trashTicket{}).Order("id").Pluck("name", &tickets)
+	assert.Equal(t, []string{"recent", "alive"}, tickets)
+	db.Unscoped().Model(&trashDraft{}).Count(&count)
+	assert.Equal(t, int64(1), count)
+
+	// the records recovered after the batch is selected aren't purged
+	BeforePurge(func(tx *gorm.DB, records []*trashNote) error {
+		return tx.Unscoped().Model(&trashNote{}).Where("name = ?", "recovered").Update("deleted_at", nil).Error
+	})
+	db.Create(&[]trashNote{
+		{Model: model.Model{DeletedAt: expired}, Name: "recovered"},
+		{Model: model.Model{DeletedAt: expired}, Name: "expired-4"},
+	})
+	reports, err = PurgeTrash(ctx, false)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), reports[0].Count)
+	db.Model(&trashNote{}).Order("id").Pluck("name", &notes)
+	assert.Equal(t, []string{"alive", "recovered"}, notes)
+
+	// the batch is rolled back if a hook fails
+	BeforePurge(func(tx *gorm.DB, records []*trashTicket) error {
+		return errors.New("cleanup failed")
+	})
+	db.Create(&trashTicket{Name: "expired", DeletedAt: now.Add(-48 * time.Hour).Unix()})
+	_, err = PurgeTrash(ctx, false)
+	assert.Error(t, err)
+	db.Model(&trashTicket{}).Count(&count)
+	assert.Equal(t, int64(3), count)
+}
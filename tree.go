@@ -0,0 +1,280 @@
+package cosy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"reflect"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cast"
+	"github.com/uozi-tech/cosy/history"
+	"github.com/uozi-tech/cosy/model"
+	"github.com/uozi-tech/cosy/outbox"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ErrTreeCycle is responded with 409 when a node is moved under itself or one of its descendants
+var ErrTreeCycle = &Error{
+	Code:    http.StatusConflict,
+	Message: "the node can't be moved under itself or its descendants",
+}
+
+// isTree reports whether the model embeds model.Tree
+func isTree[T any]() bool {
+	_, ok := any(new(T)).(model.TreeNode)
+	return ok
+}
+
+// treeOf returns the tree of the record, nil if the model doesn't embed model.Tree
+func treeOf[T any](record *T) *model.Tree {
+	if node, ok := any(record).(model.TreeNode); ok {
+		return node.TreeNode()
+	}
+	return nil
+}
+
+// treeDeletePolicy returns the policy of the children of the deleted node, which is set by the tree_delete
+// directive, e.g. model.Tree `cosy:"tree_delete:orphan"`
+func treeDeletePolicy[T any]() string {
+	tag, ok := model.LookupCosyTag(reflect.TypeFor[T](), func(tag model.CosyTag) bool {
+		return tag.GetTreeDelete() != ""
+	})
+	if !ok {
+		return model.TreeDeleteCascade
+	}
+	return tag.GetTreeDelete()
+}
+
+// isTreeList reports whether the list is responded as the nested nodes, e.g. ?tree=true
+func (c *Ctx[T]) isTreeList() bool {
+	return isTree[T]() && cast.ToBool(c.Query("tree"))
+}
+
+// checkTreeParent aborts with 404 if the parent isn't visible to the request
+func (c *Ctx[T]) checkTreeParent(parentID model.IDType) {
+	var count int64
+	tx := c.scopePolicy(c.scopeTenant(c.Tx.Session(&gorm.Session{NewDB: true}).Model(new(T))))
+	if err := tx.Where("id = ?", parentID).Count(&count).Error; err != nil {
+		c.AbortWithError(err)
+		return
+	}
+	if count == 0 {
+		c.AbortWithError(gorm.ErrRecordNotFound)
+	}
+}
+
+// setTreePath checks the parent of the node and sets its path before it's created
+func (c *Ctx[T]) setTreePath(record *T) {
+	tree := treeOf(record)
+	if tree == nil {
+		return
+	}
+	if tree.ParentID != nil {
+		c.checkTreeParent(*tree.ParentID)
+		if c.abort {
+			return
+		}
+	}
+	if err := model.SetTreePath(c.Tx, record); err != nil {
+		c.AbortWithError(err)
+	}
+}
+
+// deleteTreeChildren applies the delete policy to the children of the deleted node by tx,
+// which must be the transaction of deleting the node
+func (c *Ctx[T]) deleteTreeChildren(tx *gorm.DB, id any) error {
+	if !isTree[T]() {
+		return nil
+	}
+
+	var err error
+	switch treeDeletePolicy[T]() {
+	case model.TreeDeleteOrphan:
+		err = model.OrphanTreeChildren[T](tx, model.ParseTreeID(id))
+	default:
+		err = model.DeleteTreeDescendants[T](tx, model.ParseTreeID(id))
+	}
+	// the node has been deleted permanently with its ancestor in the same batch
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	return err
+}
+
+// resolveTreeFilter filters the descendants of the node of the request, e.g. ?under=1,
+// and keeps the parent in the projection of the nested list
+func (c *Ctx[T]) resolveTreeFilter() {
+	if !isTree[T]() {
+		return
+	}
+
+	if c.isTreeList() && c.fieldset != nil {
+		c.fieldset.addColumn("parent_id")
+	}
+
+	under := c.Query("under")
+	if under == "" {
+		return
+	}
+	// the node is loaded in the scopes of the request, so the nodes of the other tenants can't be probed
+	tx := c.scopePolicy(c.scopeTenant(model.UseDB(c.Context).Model(new(T))))
+	if c.table != "" {
+		tx = tx.Table(c.table, c.tableArgs...)
+	}
+	var node T
+	if err := tx.Where(clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: "id"}, Value: under}).
+		Take(&node).Error; err != nil {
+		c.AbortWithError(err)
+		return
+	}
+	c.GormScope(model.DescendantsOf(treeOf(&node), model.ParseTreeID(under)))
+}
+
+// treeListNode is a node of the nested list, the children are appended to the json object of the data
+type treeListNode struct {
+	data     any
+	children []*treeListNode
+}
+
+func (n *treeListNode) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(n.data)
+	if err != nil {
+		return nil, err
+	}
+	children, err := json.Marshal(n.children)
+	if err != nil {
+		return nil, err
+	}
+
+	data = bytes.TrimSpace(data)
+	if len(data) < 2 || data[len(data)-1] != '}' {
+		return nil, errors.New("the node of the tree must be a json object")
+	}
+	var buf bytes.Buffer
+	buf.Write(data[:len(data)-1])
+	if len(data) > 2 {
+		buf.WriteByte(',')
+	}
+	buf.WriteString(`"children":`)
+	buf.Write(children)
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// resolveTreeData resolves the records as the nested nodes, the records whose parent isn't listed are the roots
+func (c *Ctx[T]) resolveTreeData(result *gorm.DB) any {
+	models := make([]*T, 0)
+	result.Find(&models)
+
+	nodes := make(map[string]*treeListNode, len(models))
+	ordered := make([]*treeListNode, 0, len(models))
+	for _, record := range models {
+		var data any = record
+		if c.transformer != nil {
+			data = c.transformer(record)
+		}
+		node := &treeListNode{data: c.pruneWithFieldset(data), children: make([]*treeListNode, 0)}
+		nodes[cast.ToString(c.primaryKeyOf(record))] = node
+		ordered = append(ordered, node)
+	}
+
+	roots := make([]*treeListNode, 0)
+	for i, record := range models {
+		if parentID := treeOf(record).ParentID; parentID != nil {
+			if parent, ok := nodes[cast.ToString(*parentID)]; ok {
+				parent.children = append(parent.children, ordered[i])
+				continue
+			}
+		}
+		roots = append(roots, ordered[i])
+	}
+	return roots
+}
+
+// Move moves the node under the parent of the payload, e.g. {"parent_id": 1}, null moves it to the root.
+// The paths of its descendants are updated in a transaction, and it responds 409 if the parent is the node itself
+// or one of its descendants.
+func (c *Ctx[T]) Move() {
+	NewProcessChain(c).
+		SetPrepare(func(ctx *Ctx[T]) {
+			c.ID = c.GetParamID()
+			if !isTree[T]() {
+				ctx.AbortWithError(errors.New(reflect.TypeFor[T]().String() + " doesn't embed model.Tree"))
+				return
+			}
+			c.SetValidRules(gin.H{"parent_id": "omitempty"})
+			prepareHook(ctx)
+		}).
+		SetValidate(func(ctx *Ctx[T]) {
+			errs := c.validate()
+			if len(errs) > 0 {
+				c.JSON(http.StatusNotAcceptable, NewValidateError(errs))
+				c.Abort()
+				return
+			}
+		}).
+		SetBeforeDecode(func(ctx *Ctx[T]) {
+			tx := c.applyGormScopes(c.Tx)
+			if err := tx.First(&c.OriginModel, "id = ?", c.ID).Error; err != nil {
+				ctx.AbortWithError(err)
+				return
+			}
+			c.checkPolicy(&c.OriginModel, Policy[T].CanModify)
+			if c.abort {
+				return
+			}
+			beforeDecodeHook(ctx)
+		}).
+		SetBeforeExecute(beforeExecuteHook[T]).
+		SetGormAction(func(ctx *Ctx[T]) {
+			var parentID *model.IDType
+			if v := c.Payload["parent_id"]; v != nil {
+				id := model.ParseTreeID(v)
+				parentID = &id
+				c.checkTreeParent(id)
+				if c.abort {
+					return
+				}
+			}
+
+			// the node and its descendants are moved in a transaction with the node and the parent locked
+			err := c.transaction(func(tx *gorm.DB) error {
+				tx = tx.Session(&gorm.Session{})
+				if err := model.MoveTreeNode[T](tx, model.ParseTreeID(c.ID), parentID); err != nil {
+					return err
+				}
+
+				reload := tx.Preload(clause.Associations)
+				reload = c.resolvePreload(reload)
+				reload = c.resolveJoins(reload)
+				if err := reload.Table(c.table, c.tableArgs...).First(&c.Model, "id = ?", c.ID).Error; err != nil {
+					return err
+				}
+
+				if err := c.writeHistory(tx, history.ActionUpdate, c.ID, &c.OriginModel, &c.Model); err != nil {
+					return err
+				}
+				return c.writeEvent(tx, outbox.ActionUpdated, c.ID, &c.Model)
+			})
+			if errors.Is(err, model.ErrTreeCycle) {
+				c.JSON(http.StatusConflict, ErrTreeCycle)
+				c.Abort()
+				return
+			}
+			if err != nil {
+				ctx.AbortWithError(err)
+				return
+			}
+		}).
+		SetExecuted(executedHook[T]).
+		SetResponse(func(ctx *Ctx[T]) {
+			if c.nextHandler != nil {
+				(*c.nextHandler)(c.Context)
+			} else {
+				c.JSON(http.StatusOK, c.pruneWithFieldset(c.Model))
+			}
+		}).CreateOrModify()
+}
@@ -0,0 +1,248 @@
+package cosy
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cast"
+	"github.com/stretchr/testify/assert"
+	"github.com/uozi-tech/cosy/logger"
+	"github.com/uozi-tech/cosy/model"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type treeMenu struct {
+	model.Model
+	model.Tree `cosy:"tree_delete:orphan"`
+	Name       string `json:"name" cosy:"add:required;update:omitempty"`
+}
+
+type treeCategory struct {
+	model.Model
+	model.Tree
+	Name string `json:"name" cosy:"add:required;update:omitempty;item:selectable"`
+}
+
+type treeTag struct {
+	model.Model
+	model.Tree
+	Code string `json:"code" gorm:"uniqueIndex" cosy:"add:required"`
+	Name string `json:"name" cosy:"add:required;update:omitempty"`
+}
+
+// BeforeDelete fails to delete the locked tag, the descendants are deleted by the conditions without the names
+func (t *treeTag) BeforeDelete(tx *gorm.DB) error {
+	if t.Name == "locked" {
+		return errors.New("the tag is locked")
+	}
+	return nil
+}
+
+type treeTenantNode struct {
+	model.Model
+	model.Tree
+	TenantID uint64 `json:"tenant_id" cosy:"tenant"`
+	Name     string `json:"name"`
+}
+
+func TestTreeDeletePolicy(t *testing.T) {
+	assert.Equal(t, model.TreeDeleteOrphan, treeDeletePolicy[treeMenu]())
+	assert.Equal(t, model.TreeDeleteCascade, treeDeletePolicy[treeCategory]())
+	assert.False(t, isTree[relationUser]())
+}
+
+func TestTreeListNode(t *testing.T) {
+	node := &treeListNode{data: gin.H{"id": 1}, children: []*treeListNode{
+		{data: struct{}{}, children: make([]*treeListNode, 0)},
+	}}
+	data, err := json.Marshal(node)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"id":1,"children":[{"children":[]}]}`, string(data))
+
+	_, err = json.Marshal(&treeListNode{data: []int{1}})
+	assert.Error(t, err)
+}
+
+func TestTreeApi(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger.Init(gin.TestMode)
+	model.ClearCollection()
+	model.RegisterModels(treeCategory{})
+	model.Init(sqlite.Open(filepath.Join(t.TempDir(), "tree.db")))
+
+	r := gin.New()
+	Api[treeCategory]("categories").InitRouter(r.Group(""))
+
+	request := func(method, uri string, body any) (int, string) {
+		var buf bytes.Buffer
+		if body != nil {
+			_ = json.NewEncoder(&buf).Encode(body)
+		}
+		req := httptest.NewRequest(method, uri, &buf)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code, w.Body.String()
+	}
+
+	for _, body := range []gin.H{
+		{"name": "a"},
+		{"name": "b", "parent_id": 1},
+		{"name": "c", "parent_id": 2},
+		{"name": "d"},
+	} {
+		code, resp := request(http.MethodPost, "/categories", body)
+		assert.Equal(t, http.StatusOK, code, resp)
+	}
+	code, _ := request(http.MethodPost, "/categories", gin.H{"name": "e", "parent_id": 100})
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, resp := request(http.MethodGet, "/categories?tree=true&fields=name&sort_by=id&order=asc", nil)
+	assert.Equal(t, http.StatusOK, code)
+	assert.JSONEq(t, `{"data":[
+		{"id":1,"name":"a","children":[{"id":2,"name":"b","children":[{"id":3,"name":"c","children":[]}]}]},
+		{"id":4,"name":"d","children":[]}
+	]}`, resp)
+
+	code, resp = request(http.MethodGet, "/categories?under=1&fields=name&sort_by=id&order=asc", nil)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, resp, `"data":[{"id":2,"name":"b"},{"id":3,"name":"c"}]`)
+
+	code, _ = request(http.MethodPost, "/categories/1/move", gin.H{"parent_id": 3})
+	assert.Equal(t, http.StatusConflict, code)
+
+	code, resp = request(http.MethodPost, "/categories/2/move", gin.H{"parent_id": 4})
+	assert.Equal(t, http.StatusOK, code, resp)
+	code, resp = request(http.MethodGet, "/categories/3", nil)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, resp, `"path":"/4/2/"`)
+
+	// the parent isn't changed by modifying
+	code, resp = request(http.MethodPost, "/categories/2", gin.H{"name": "bb", "parent_id": 1})
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, resp, `"parent_id":4`)
+
+	// the descendants are deleted with the node by default
+	code, _ = request(http.MethodDelete, "/categories/2", nil)
+	assert.Equal(t, http.StatusNoContent, code)
+	code, resp = request(http.MethodGet, "/categories?trash=true&fields=name&sort_by=id&order=asc", nil)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, resp, `"data":[{"id":2,"name":"bb"},{"id":3,"name":"c"}]`)
+}
+
+func TestTreeWrites(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger.Init(gin.TestMode)
+	model.ClearCollection()
+	model.RegisterModels(treeTag{})
+	db := model.Init(sqlite.Open(filepath.Join(t.TempDir(), "tree.db")))
+
+	r := gin.New()
+	Api[treeTag]("tags").InitRouter(r.Group(""))
+	r.POST("/tags/upsert", func(c *gin.Context) {
+		Core[treeTag](c).Upsert("code")
+	})
+	r.POST("/tags/import", func(c *gin.Context) {
+		Core[treeTag](c).Import()
+	})
+
+	request := func(method, uri string, body any) (int, string) {
+		var buf bytes.Buffer
+		_ = json.NewEncoder(&buf).Encode(body)
+		req := httptest.NewRequest(method, uri, &buf)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code, w.Body.String()
+	}
+	tree := func(code string) (parentID *model.IDType, path string, depth int) {
+		var tag treeTag
+		assert.NoError(t, db.Unscoped().Take(&tag, "code = ?", code).Error)
+		return tag.ParentID, tag.Path, tag.Depth
+	}
+
+	code, resp := request(http.MethodPost, "/tags", gin.H{"code": "a", "name": "locked"})
+	assert.Equal(t, http.StatusOK, code, resp)
+
+	// the paths are set on upserting and importing
+	code, resp = request(http.MethodPost, "/tags/upsert", gin.H{"code": "b", "name": "b", "parent_id": 1})
+	assert.Equal(t, http.StatusOK, code, resp)
+	_, path, depth := tree("b")
+	assert.Equal(t, "/1/", path)
+	assert.Equal(t, 1, depth)
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	file, err := form.CreateFormFile("file", "tags.csv")
+	assert.NoError(t, err)
+	_, _ = file.Write([]byte("code,name,parent_id\nc,c,2\n"))
+	assert.NoError(t, form.Close())
+	req := httptest.NewRequest(http.MethodPost, "/tags/import", &body)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	_, path, depth = tree("c")
+	assert.Equal(t, "/1/2/", path)
+	assert.Equal(t, 2, depth)
+
+	// the parent of the existing node isn't changed by upserting
+	code, resp = request(http.MethodPost, "/tags/upsert", gin.H{"code": "b", "name": "bb", "parent_id": nil})
+	assert.Equal(t, http.StatusOK, code, resp)
+	parentID, path, _ := tree("b")
+	assert.Equal(t, "1", cast.ToString(*parentID))
+	assert.Equal(t, "/1/", path)
+
+	// the descendants are kept if the node fails to be deleted
+	code, _ = request(http.MethodDelete, "/tags/1", nil)
+	assert.Equal(t, http.StatusInternalServerError, code)
+	var count int64
+	db.Model(&treeTag{}).Count(&count)
+	assert.Equal(t, int64(3), count)
+}
+
+func TestTreeUnderTenant(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger.Init(gin.TestMode)
+	model.ClearCollection()
+	model.RegisterModels(treeTenantNode{})
+	db := model.Init(sqlite.Open(filepath.Join(t.TempDir(), "tree.db")))
+
+	root := &treeTenantNode{TenantID: 1, Name: "root"}
+	assert.NoError(t, db.Create(root).Error)
+	child := &treeTenantNode{Tree: model.Tree{ParentID: &root.ID}, TenantID: 1, Name: "child"}
+	assert.NoError(t, model.SetTreePath(db, child))
+	assert.NoError(t, db.Create(child).Error)
+
+	SetTenantResolver(func(c *gin.Context) (any, bool) {
+		tenant := c.GetHeader("X-Tenant")
+		return tenant, tenant != ""
+	})
+	defer SetTenantResolver(nil)
+
+	r := gin.New()
+	Api[treeTenantNode]("nodes").InitRouter(r.Group(""))
+	list := func(tenant string) (int, string) {
+		req := httptest.NewRequest(http.MethodGet, "/nodes?under="+cast.ToString(root.ID), nil)
+		req.Header.Set("X-Tenant", tenant)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code, w.Body.String()
+	}
+
+	code, resp := list("1")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, resp, `"name":"child"`)
+
+	// the node of the other tenant isn't found, so its existence can't be probed
+	code, _ = list("2")
+	assert.Equal(t, http.StatusNotFound, code)
+}
@@ -5,7 +5,9 @@ import (
 	"reflect"
 
 	"github.com/gin-gonic/gin"
+	"github.com/uozi-tech/cosy/history"
 	"github.com/uozi-tech/cosy/map2struct"
+	"github.com/uozi-tech/cosy/outbox"
 	"gorm.io/gorm/clause"
 )
 
@@ -15,6 +17,7 @@ func (c *Ctx[T]) SetNextHandler(handler gin.HandlerFunc) *Ctx[T] {
 }
 
 func (c *Ctx[T]) Modify() {
+	version := versionField[T]()
 	NewProcessChain(c).
 		SetPrepare(func(ctx *Ctx[T]) {
 			c.ID = c.GetParamID()
@@ -35,6 +38,20 @@ func (c *Ctx[T]) Modify() {
 				ctx.AbortWithError(err)
 				return
 			}
+			if version != nil {
+				c.checkIfMatch(version)
+				if c.abort {
+					return
+				}
+				c.checkPayloadVersion(version)
+				if c.abort {
+					return
+				}
+			}
+			c.checkPolicy(&c.OriginModel, Policy[T].CanModify)
+			if c.abort {
+				return
+			}
 			beforeDecodeHook(ctx)
 		}).
 		SetDecode(func(ctx *Ctx[T]) {
@@ -46,6 +63,10 @@ func (c *Ctx[T]) Modify() {
 				ctx.AbortWithError(err)
 				return
 			}
+			if err := c.setTenant(&c.Model); err != nil {
+				ctx.AbortWithError(err)
+				return
+			}
 		}).
 		SetBeforeExecute(beforeExecuteHook[T]).
 		SetGormAction(func(ctx *Ctx[T]) {
@@ -64,22 +85,44 @@ func (c *Ctx[T]) Modify() {
 				}
 			}
 
-			if err := c.Tx.Select(c.GetSelectedFields()).Save(&c.Model).Error; err != nil {
-				ctx.AbortWithError(err)
-				return
+			tx := c.Tx
+			if version != nil {
+				tx = c.withVersion(tx, version)
+			}
+
+			// nothing is modified if no field is selected, e.g. the fields of the payload are not writable,
+			// otherwise Save writes all the fields of the model
+			if selected := c.GetSelectedFields(); len(selected) > 0 {
+				result := tx.Select(selected).Save(&c.Model)
+				if result.Error != nil {
+					ctx.AbortWithError(result.Error)
+					return
+				}
+				// the record has been modified after it was read
+				if version != nil && result.RowsAffected == 0 {
+					c.JSON(http.StatusConflict, ErrVersionConflict)
+					c.Abort()
+					return
+				}
 			}
 
-			tx := c.Tx.Preload(clause.Associations)
+			tx = c.Tx.Preload(clause.Associations)
 			tx = c.resolvePreload(tx)
 			tx = c.resolveJoins(tx)
 			tx.Table(c.table, c.tableArgs...).First(&c.Model, "id = ?", c.ID)
+
+			c.recordHistory(history.ActionUpdate, c.ID, &c.OriginModel, &c.Model)
+			c.recordEvent(outbox.ActionUpdated, c.ID, &c.Model)
 		}).
 		SetExecuted(executedHook[T]).
 		SetResponse(func(ctx *Ctx[T]) {
+			if version != nil {
+				c.setETag(&c.Model, version)
+			}
 			if c.nextHandler != nil {
 				(*c.nextHandler)(c.Context)
 			} else {
-				c.JSON(http.StatusOK, c.Model)
+				c.JSON(http.StatusOK, c.pruneWithFieldset(c.Model))
 			}
 		}).CreateOrModify()
 }
@@ -0,0 +1,283 @@
+package cosy
+
+import (
+	"errors"
+	"net/http"
+	"reflect"
+	"slices"
+
+	"github.com/spf13/cast"
+	"github.com/uozi-tech/cosy/history"
+	"github.com/uozi-tech/cosy/map2struct"
+	"github.com/uozi-tech/cosy/model"
+	"github.com/uozi-tech/cosy/outbox"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"gorm.io/gorm/schema"
+)
+
+// ErrUnknownConflictColumns is returned when none of the conflict columns of Upsert is a field of the model
+var ErrUnknownConflictColumns = errors.New("unknown conflict columns")
+
+// Upsert creates the record, or updates the fields present in the payload of the record
+// which conflicts on the conflictColumns, the primary keys are used if no column is given.
+// The conflict columns must be covered by a primary key or unique index in PostgreSQL and SQLite,
+// MySQL resolves the conflict by any of the unique indexes. For the models scoped to the tenant,
+// the record of another tenant is never updated, and it responds 404 on MySQL if the record conflicts with it.
+// The payload is validated by the add directives of the cosy tags as Create does.
+func (c *Ctx[T]) Upsert(conflictColumns ...string) {
+	NewProcessChain(c).
+		SetPrepare(func(ctx *Ctx[T]) {
+			createHook[T]()(ctx)
+			// the conflicting record is updated instead of being rejected by db_unique
+			c.unique = nil
+			prepareHook(ctx)
+		}).
+		SetValidate(func(ctx *Ctx[T]) {
+			errs := c.validate()
+			if len(errs) > 0 {
+				c.JSON(http.StatusNotAcceptable, NewValidateError(errs))
+				c.Abort()
+				return
+			}
+		}).
+		SetBeforeDecode(beforeDecodeHook[T]).
+		SetDecode(func(ctx *Ctx[T]) {
+			for k := range c.Payload {
+				c.AddSelectedFields(c.resolveColumn(k))
+			}
+			if err := map2struct.WeakDecode(c.Payload, &c.Model); err != nil {
+				ctx.AbortWithError(err)
+				return
+			}
+			if err := c.setTenant(&c.Model); err != nil {
+				ctx.AbortWithError(err)
+				return
+			}
+		}).
+		SetBeforeExecute(beforeExecuteHook[T]).
+		SetGormAction(func(ctx *Ctx[T]) {
+			s := c.schema()
+			if s == nil {
+				return
+			}
+
+			conflictFields := upsertConflictFields(s, conflictColumns, c.resolveColumn)
+			if len(conflictFields) == 0 {
+				ctx.AbortWithError(ErrUnknownConflictColumns)
+				return
+			}
+			selected := c.GetSelectedFields()
+			if isTree[T]() {
+				// the path of the created node is set by its parent, and the parent of the existing node
+				// is changed by Move only
+				c.setTreePath(&c.Model)
+				if c.abort {
+					return
+				}
+				selected = slices.DeleteFunc(slices.Clone(selected), func(name string) bool {
+					field := s.LookUpField(name)
+					return field != nil && (field.DBName == "parent_id" || field.DBName == "path" || field.DBName == "depth")
+				})
+			}
+			onConflict := clause.OnConflict{
+				DoUpdates: clause.AssignmentColumns(upsertUpdateColumns(s, selected, conflictFields)),
+			}
+			for _, field := range conflictFields {
+				onConflict.Columns = append(onConflict.Columns, clause.Column{Name: field.DBName})
+			}
+			if len(onConflict.DoUpdates) == 0 {
+				onConflict.DoNothing = true
+			}
+			// the record of another tenant is not updated, and since MySQL ignores the condition,
+			// the conflicting records are checked in the transaction before the upsert
+			tenantField := c.tenantScopeField()
+			if tenantField != nil && !onConflict.DoNothing {
+				onConflict.Where = clause.Where{Exprs: []clause.Expression{clause.Eq{
+					Column: clause.Column{Table: clause.CurrentTable, Name: tenantField.DBName},
+					Value:  c.tenantValue(tenantField),
+				}}}
+			}
+
+			// the returned primary key is not reliable when the record is updated (e.g. MySQL),
+			// so the final row is queried by the conflict columns
+			conds := make([]clause.Expression, 0, len(conflictFields))
+			rv := reflect.ValueOf(&c.Model).Elem()
+			for _, field := range conflictFields {
+				value, _ := field.ValueOf(c.Request.Context(), rv)
+				conds = append(conds, clause.Eq{
+					Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName},
+					Value:  value,
+				})
+			}
+
+			upsert := func(tx *gorm.DB) error {
+				if c.table != "" {
+					tx = tx.Table(c.table, c.tableArgs...)
+				}
+				// the statements below must not share the conditions
+				tx = tx.Session(&gorm.Session{})
+				if len(onConflict.Where.Exprs) > 0 && tx.Dialector.Name() == "mysql" {
+					if err := c.checkUpsertTenant(tx, s, tenantField); err != nil {
+						return err
+					}
+				}
+
+				// the conflicting record is read to tell whether the record is created or updated
+				var origin []T
+				if c.recordsChanges() {
+					if err := c.scopeTenant(tx).Where(clause.And(conds...)).Limit(1).Find(&origin).Error; err != nil {
+						return err
+					}
+				}
+
+				create := tx
+				if c.skipAssociationsOnCreate {
+					create = tx.Omit(clause.Associations)
+				}
+				if err := create.Clauses(onConflict).Create(&c.Model).Error; err != nil {
+					return err
+				}
+
+				var zero T
+				c.Model = zero
+				query := c.resolveJoins(c.resolvePreload(tx.Preload(clause.Associations)))
+				if err := c.scopeTenant(query).Where(clause.And(conds...)).First(&c.Model).Error; err != nil {
+					return err
+				}
+
+				if len(origin) == 0 {
+					return c.recordBatch(tx, history.ActionCreate, outbox.ActionCreated, nil, []T{c.Model})
+				}
+				return c.recordBatch(tx, history.ActionUpdate, outbox.ActionUpdated, origin, []T{c.Model})
+			}
+
+			if err := c.transaction(upsert); err != nil {
+				ctx.AbortWithError(err)
+				return
+			}
+		}).
+		SetExecuted(executedHook[T]).
+		SetResponse(func(ctx *Ctx[T]) {
+			if c.nextHandler != nil {
+				(*c.nextHandler)(c.Context)
+			} else {
+				c.JSON(http.StatusOK, c.pruneWithFieldset(c.Model))
+			}
+		}).CreateOrModify()
+}
+
+// checkUpsertTenant locks the records which conflict with the record on the primary key or any unique index,
+// and returns gorm.ErrRecordNotFound if any of them belongs to another tenant. MySQL resolves the conflict
+// of ON DUPLICATE KEY UPDATE by any unique index and ignores its condition, so it must be called
+// in the transaction of the upsert.
+func (c *Ctx[T]) checkUpsertTenant(tx *gorm.DB, s *schema.Schema, field *model.ResolvedModelField) error {
+	rv := reflect.ValueOf(&c.Model).Elem()
+	conds := make([]clause.Expression, 0)
+	for _, key := range upsertUniqueKeys(s) {
+		eqs := make([]clause.Expression, 0, len(key))
+		for _, f := range key {
+			value, zero := f.ValueOf(c.Request.Context(), rv)
+			// the auto increment primary key doesn't conflict
+			if zero && f.PrimaryKey {
+				eqs = nil
+				break
+			}
+			eqs = append(eqs, clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: f.DBName}, Value: value})
+		}
+		if len(eqs) > 0 {
+			conds = append(conds, clause.And(eqs...))
+		}
+	}
+	if len(conds) == 0 {
+		return nil
+	}
+
+	// the deleted records conflict as well
+	var tenants []any
+	err := tx.Session(&gorm.Session{}).Unscoped().Model(new(T)).
+		Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate}).
+		Where(clause.Or(conds...)).
+		Pluck(field.DBName, &tenants).Error
+	if err != nil {
+		return err
+	}
+
+	tenant, _ := c.tenantOf()
+	for _, v := range tenants {
+		if cast.ToString(v) != cast.ToString(tenant) {
+			return gorm.ErrRecordNotFound
+		}
+	}
+	return nil
+}
+
+// upsertUniqueKeys returns the fields of the primary key and of the unique indexes
+func upsertUniqueKeys(s *schema.Schema) (keys [][]*schema.Field) {
+	if len(s.PrimaryFields) > 0 {
+		keys = append(keys, s.PrimaryFields)
+	}
+	for _, field := range s.Fields {
+		if field.Unique && !field.PrimaryKey {
+			keys = append(keys, []*schema.Field{field})
+		}
+	}
+	for _, index := range s.ParseIndexes() {
+		if index.Class != "UNIQUE" {
+			continue
+		}
+		key := make([]*schema.Field, 0, len(index.Fields))
+		for _, option := range index.Fields {
+			if option.Field == nil {
+				key = nil
+				break
+			}
+			key = append(key, option.Field)
+		}
+		if len(key) > 0 {
+			keys = append(keys, key)
+		}
+	}
+	return
+}
+
+// upsertConflictFields returns the fields of the conflict columns, the primary fields by default
+func upsertConflictFields(s *schema.Schema, columns []string, resolve func(string) string) (fields []*schema.Field) {
+	if len(columns) == 0 {
+		return s.PrimaryFields
+	}
+	for _, column := range columns {
+		if field := s.LookUpField(resolve(column)); field != nil {
+			fields = append(fields, field)
+		}
+	}
+	return
+}
+
+// upsertUpdateColumns returns the columns updated on conflict, which are the selected fields
+// and the auto update time fields, excepting the conflict columns and the primary keys
+func upsertUpdateColumns(s *schema.Schema, selected []string, conflictFields []*schema.Field) (columns []string) {
+	skip := make(map[string]bool, len(conflictFields))
+	for _, field := range conflictFields {
+		skip[field.DBName] = true
+	}
+
+	updates := make(map[string]bool, len(selected))
+	for _, name := range selected {
+		if field := s.LookUpField(name); field != nil {
+			updates[field.DBName] = true
+		}
+	}
+
+	// follow the order of the fields, so that the statement is stable
+	for _, field := range s.Fields {
+		if field.DBName == "" || field.PrimaryKey || skip[field.DBName] {
+			continue
+		}
+		if updates[field.DBName] || field.AutoUpdateTime > 0 {
+			columns = append(columns, field.DBName)
+		}
+	}
+
+	return
+}
@@ -0,0 +1,167 @@
+package cosy
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/uozi-tech/cosy/logger"
+	"github.com/uozi-tech/cosy/model"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+type upsertModel struct {
+	model.Model
+	Code  string `json:"code" gorm:"uniqueIndex"`
+	Name  string `json:"name"`
+	Stock int    `json:"stock" gorm:"column:stock_count"`
+}
+
+type upsertProduct struct {
+	model.Model
+	Code  string `json:"code" gorm:"uniqueIndex" cosy:"add:required"`
+	Name  string `json:"name" cosy:"add:omitempty"`
+	Stock int    `json:"stock" gorm:"column:stock_count" cosy:"add:omitempty,min=0"`
+}
+
+func TestUpsert(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	logger.Init(gin.TestMode)
+	model.ClearCollection()
+	model.RegisterModels(upsertProduct{})
+	db := model.Init(sqlite.Open(filepath.Join(t.TempDir(), "upsert.db")))
+
+	r := gin.New()
+	r.POST("/products", func(c *gin.Context) {
+		Core[upsertProduct](c).Upsert("code")
+	})
+	upsert := func(body gin.H) (int, upsertProduct) {
+		var buf bytes.Buffer
+		_ = json.NewEncoder(&buf).Encode(body)
+		req := httptest.NewRequest(http.MethodPost, "/products", &buf)
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		var product upsertProduct
+		_ = json.Unmarshal(w.Body.Bytes(), &product)
+		return w.Code, product
+	}
+
+	code, created := upsert(gin.H{"code": "A1", "name": "apple", "stock": 3})
+	assert.Equal(t, http.StatusOK, code)
+	assert.NotZero(t, created.ID)
+	assert.Equal(t, "apple", created.Name)
+	assert.Equal(t, 3, created.Stock)
+
+	// only the fields of the payload are updated, the json key of the renamed column included
+	code, updated := upsert(gin.H{"code": "A1", "stock": 5})
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, created.ID, updated.ID)
+	assert.Equal(t, "apple", updated.Name)
+	assert.Equal(t, 5, updated.Stock)
+
+	var products []upsertProduct
+	db.Find(&products)
+	if assert.Len(t, products, 1) {
+		assert.Equal(t, "apple", products[0].Name)
+		assert.Equal(t, 5, products[0].Stock)
+	}
+
+	// the payload is validated by the add directives
+	code, _ = upsert(gin.H{"name": "banana"})
+	assert.Equal(t, http.StatusNotAcceptable, code)
+	code, _ = upsert(gin.H{"code": "A2", "stock": -1})
+	assert.Equal(t, http.StatusNotAcceptable, code)
+}
+
+func TestUpsertColumns(t *testing.T) {
+	s, err := schema.Parse(&upsertModel{}, &sync.Map{}, schema.NamingStrategy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	resolve := func(key string) string {
+		return key
+	}
+
+	fields := upsertConflictFields(s, nil, resolve)
+	assert.Len(t, fields, 1)
+	assert.Equal(t, "id", fields[0].DBName)
+
+	fields = upsertConflictFields(s, []string{"code", "unknown"}, resolve)
+	assert.Len(t, fields, 1)
+	assert.Equal(t, "code", fields[0].DBName)
+
+	// the conflict columns and the primary key are never updated, updated_at is always updated
+	assert.Equal(t, []string{"updated_at", "stock_count"},
+		upsertUpdateColumns(s, []string{"id", "code", "Stock"}, fields))
+	assert.Equal(t, []string{"updated_at", "name"},
+		upsertUpdateColumns(s, []string{"name", "unknown"}, fields))
+}
+
+type upsertTenantModel struct {
+	model.Model
+	TenantID uint64 `json:"tenant_id" cosy:"tenant"`
+	Code     string `json:"code" gorm:"uniqueIndex"`
+	Serial   string `json:"serial" gorm:"uniqueIndex:idx_serial_name"`
+	Name     string `json:"name" gorm:"uniqueIndex:idx_serial_name"`
+}
+
+func TestUpsertUniqueKeys(t *testing.T) {
+	s, err := schema.Parse(&upsertTenantModel{}, &sync.Map{}, schema.NamingStrategy{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var keys [][]string
+	for _, key := range upsertUniqueKeys(s) {
+		var columns []string
+		for _, field := range key {
+			columns = append(columns, field.DBName)
+		}
+		keys = append(keys, columns)
+	}
+	assert.ElementsMatch(t, [][]string{{"id"}, {"code"}, {"serial", "name"}}, keys)
+}
+
+func TestCheckUpsertTenant(t *testing.T) {
+	model.RegisterModels(upsertTenantModel{})
+	model.ResolvedModels()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "upsert.db")), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&upsertTenantModel{}))
+	db.Create(&[]upsertTenantModel{
+		{TenantID: 1, Code: "A", Serial: "S", Name: "a"},
+		{TenantID: 2, Code: "B", Serial: "S", Name: "b"},
+	})
+
+	SetTenantResolver(func(c *gin.Context) (any, bool) {
+		return uint64(2), true
+	})
+	defer SetTenantResolver(nil)
+
+	c, _ := newTenantContext("")
+	core := Core[upsertTenantModel](c)
+	s := core.schema()
+	field := core.tenantScopeField()
+
+	// the record conflicts with the record of another tenant on a unique index
+	core.Model = upsertTenantModel{Code: "A"}
+	assert.ErrorIs(t, core.checkUpsertTenant(db, s, field), gorm.ErrRecordNotFound)
+	core.Model = upsertTenantModel{Code: "C", Serial: "S", Name: "a"}
+	assert.ErrorIs(t, core.checkUpsertTenant(db, s, field), gorm.ErrRecordNotFound)
+
+	// the record conflicts with the record of the tenant, or nothing
+	core.Model = upsertTenantModel{Code: "B"}
+	assert.NoError(t, core.checkUpsertTenant(db, s, field))
+	core.Model = upsertTenantModel{Code: "C", Serial: "S", Name: "c"}
+	assert.NoError(t, core.checkUpsertTenant(db, s, field))
+}
@@ -19,20 +19,24 @@ func resolveColumn(columns map[string]string, key string) string {
 	return key
 }
 
-// DbUnique checks if the value is unique in the table of the database
-func DbUnique[T any](ctx context.Context, payload gin.H, columns []string, columnMapping map[string]string) (conflicts []string, err error) {
+// DbUnique checks if the value is unique in the table of the database,
+// the scopes narrow the records to check, e.g. the records of the current tenant
+func DbUnique[T any](ctx context.Context, payload gin.H, columns []string, columnMapping map[string]string,
+	scopes ...func(*gorm.DB) *gorm.DB) (conflicts []string, err error) {
 	db := model.UseDB(ctx)
 
 	var m T
 
 	db = db.Model(&m)
 
+	// the conditions of the columns are grouped, so that they are not mixed with the scopes
+	conds := db.Session(&gorm.Session{NewDB: true})
 	dbColumns := make([]string, 0, len(columns))
 	for _, v := range columns {
 		if payload[v] != nil {
 			dbColumn := resolveColumn(columnMapping, v)
 			dbColumns = append(dbColumns, dbColumn)
-			db = db.Or(dbColumn, payload[v])
+			conds = conds.Or(dbColumn, payload[v])
 		}
 	}
 
@@ -40,6 +44,8 @@ func DbUnique[T any](ctx context.Context, payload gin.H, columns []string, colum
 		return nil, nil
 	}
 
+	db = db.Scopes(scopes...).Where(conds)
+
 	result := map[string]any{}
 	err = db.Unscoped().Select(strings.Join(append([]string{"id"}, dbColumns...), ", ")).First(&result).Error
 	if err != nil {
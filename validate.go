@@ -64,6 +64,7 @@ type ValidError struct {
 
 func (c *Ctx[T]) validate() (errs gin.H) {
 	c.Payload = make(gin.H)
+	c.dropUnwritableRules()
 
 	if err := c.ShouldBindJSON(&c.Payload); err != nil {
 		logJSONBindError(c.Context, err)
@@ -88,7 +89,7 @@ func (c *Ctx[T]) validate() (errs gin.H) {
 	}
 
 	if len(c.unique) > 0 {
-		conflicts, err := valid.DbUnique[T](c.Context, c.Payload, c.unique, c.columnMapping)
+		conflicts, err := valid.DbUnique[T](c.Context, c.Payload, c.unique, c.columnMapping, c.scopeTenant)
 		if err != nil {
 			c.AbortWithError(err)
 			return
@@ -116,6 +117,7 @@ func (c *Ctx[T]) validate() (errs gin.H) {
 
 func validateBatchUpdate[T any](c *Ctx[T]) (errs gin.H) {
 	c.Payload = make(gin.H)
+	c.dropUnwritableRules()
 
 	if err := c.ShouldBindJSON(&c.Payload); err != nil {
 		logJSONBindError(c.Context, err)
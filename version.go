@@ -0,0 +1,183 @@
+package cosy
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/spf13/cast"
+	"github.com/uozi-tech/cosy/model"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	// ErrVersionConflict is responded with 409 when the record has been modified since it was read
+	ErrVersionConflict = &Error{
+		Code:    http.StatusConflict,
+		Message: "the record has been modified by others",
+	}
+	// ErrPreconditionFailed is responded with 412 when If-Match doesn't match the current ETag
+	ErrPreconditionFailed = &Error{
+		Code:    http.StatusPreconditionFailed,
+		Message: "precondition failed",
+	}
+)
+
+// versionField returns the field marked with cosy:"version",
+// nil means optimistic locking is not enabled for the model
+func versionField[T any]() *model.ResolvedModelField {
+	resolved := model.GetResolvedModel[T]()
+	if resolved == nil {
+		return nil
+	}
+	for _, field := range resolved.OrderedFields {
+		if field.CosyTag.GetVersion() {
+			return field
+		}
+	}
+	return nil
+}
+
+// versionOf returns the version of the record
+func versionOf[T any](record *T, field *model.ResolvedModelField) int64 {
+	v := reflect.ValueOf(record).Elem().FieldByName(field.Name)
+	if !v.IsValid() {
+		return 0
+	}
+	return cast.ToInt64(v.Interface())
+}
+
+// setVersion sets the version of the record
+func setVersion[T any](record *T, field *model.ResolvedModelField, version int64) {
+	v := reflect.ValueOf(record).Elem().FieldByName(field.Name)
+	if !v.IsValid() || !v.CanSet() {
+		return
+	}
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		v.SetInt(version)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		v.SetUint(uint64(version))
+	}
+}
+
+// etagOf returns the ETag of a record version
+func etagOf(id any, version int64) string {
+	return fmt.Sprintf(`"%v-%d"`, id, version)
+}
+
+// etagMatch reports whether the ETag matches the If-Match / If-None-Match header,
+// weak validators are compared as strong ones since the version changes on every modification
+func etagMatch(header string, etag string) bool {
+	for v := range strings.SplitSeq(header, ",") {
+		v = strings.TrimPrefix(strings.TrimSpace(v), "W/")
+		if v == "*" || v == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// checkIfMatch responds 412 if the If-Match header doesn't match the ETag of the origin record
+func (c *Ctx[T]) checkIfMatch(field *model.ResolvedModelField) {
+	header := c.GetHeader("If-Match")
+	if header == "" {
+		return
+	}
+	if !etagMatch(header, etagOf(c.ID, versionOf(&c.OriginModel, field))) {
+		c.JSON(http.StatusPreconditionFailed, ErrPreconditionFailed)
+		c.Abort()
+	}
+}
+
+// checkPayloadVersion responds 409 if the version in the request body is not the version of the origin record
+func (c *Ctx[T]) checkPayloadVersion(field *model.ResolvedModelField) {
+	value, ok := c.Payload[field.JsonTag]
+	if !ok && field.CosyTag.GetJson() != "" {
+		value, ok = c.Payload[field.CosyTag.GetJson()]
+	}
+	if !ok {
+		return
+	}
+	if cast.ToInt64(value) != versionOf(&c.OriginModel, field) {
+		c.JSON(http.StatusConflict, ErrVersionConflict)
+		c.Abort()
+	}
+}
+
+// withVersion bumps the version of the model, and only updates the record of the origin version
+func (c *Ctx[T]) withVersion(tx *gorm.DB, field *model.ResolvedModelField) *gorm.DB {
+	origin := versionOf(&c.OriginModel, field)
+	setVersion(&c.Model, field, origin+1)
+	c.AddSelectedFields(field.DBName)
+	return tx.Session(&gorm.Session{}).Where(clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: origin})
+}
+
+// setETag sets the ETag header of the record
+func (c *Ctx[T]) setETag(record *T, field *model.ResolvedModelField) string {
+	etag := etagOf(c.ID, versionOf(record, field))
+	c.Header("ETag", etag)
+	return etag
+}
+
+// checkBatchIfMatch responds 412 unless the ETag of each record is listed in the If-Match header,
+// and returns the checked versions of the records by their ids, nil if the header is absent
+func (c *Ctx[T]) checkBatchIfMatch(tx *gorm.DB, field *model.ResolvedModelField, ids []model.IDType) (versions map[any]int64) {
+	header := c.GetHeader("If-Match")
+	if header == "" {
+		return
+	}
+
+	s := c.schema()
+	if s == nil {
+		return
+	}
+	keyField := s.FieldsByDBName[c.itemKey]
+	if keyField == nil {
+		return
+	}
+
+	var records []T
+	err := tx.Session(&gorm.Session{}).Model(new(T)).
+		Select(c.itemKey, field.DBName).
+		Where(c.itemKey+" IN ?", ids).
+		Find(&records).Error
+	if err != nil {
+		c.AbortWithError(err)
+		return
+	}
+
+	versions = make(map[any]int64, len(records))
+	for i := range records {
+		id, _ := keyField.ValueOf(c.Request.Context(), reflect.ValueOf(&records[i]).Elem())
+		version := versionOf(&records[i], field)
+		if !etagMatch(header, etagOf(id, version)) {
+			c.JSON(http.StatusPreconditionFailed, ErrPreconditionFailed)
+			c.Abort()
+			return nil
+		}
+		versions[id] = version
+	}
+	return
+}
+
+// whereBatchVersions returns the condition of the records of the checked versions,
+// e.g. (id = 1 AND version = 2) OR (id = 3 AND version = 1)
+func (c *Ctx[T]) whereBatchVersions(field *model.ResolvedModelField, versions map[any]int64) clause.Expression {
+	conds := make([]clause.Expression, 0, len(versions))
+	for id, version := range versions {
+		conds = append(conds, clause.And(
+			clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: c.itemKey}, Value: id},
+			clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: field.DBName}, Value: version},
+		))
+	}
+	return clause.Or(conds...)
+}
+
+// bumpBatchVersion increases the version of the records
+func bumpBatchVersion(tx *gorm.DB, field *model.ResolvedModelField) *gorm.DB {
+	column := clause.Column{Table: clause.CurrentTable, Name: field.DBName}
+	return tx.UpdateColumn(field.DBName, gorm.Expr("? + 1", column))
+}
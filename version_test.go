@@ -0,0 +1,62 @@
+package cosy
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uozi-tech/cosy/model"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type versionedModel struct {
+	model.Model
+	Revision uint `json:"revision" cosy:"version"`
+}
+
+func TestETagMatch(t *testing.T) {
+	etag := etagOf(uint64(1), 3)
+	assert.Equal(t, `"1-3"`, etag)
+
+	assert.True(t, etagMatch(`"1-3"`, etag))
+	assert.True(t, etagMatch(`W/"1-3"`, etag))
+	assert.True(t, etagMatch(`"1-2", "1-3"`, etag))
+	assert.True(t, etagMatch(`*`, etag))
+	assert.False(t, etagMatch(`"1-2"`, etag))
+	assert.False(t, etagMatch(``, etag))
+}
+
+func TestVersionOf(t *testing.T) {
+	field := &model.ResolvedModelField{Name: "Revision"}
+
+	m := versionedModel{Revision: 2}
+	assert.Equal(t, int64(2), versionOf(&m, field))
+
+	setVersion(&m, field, 3)
+	assert.Equal(t, uint(3), m.Revision)
+}
+
+func TestWhereBatchVersions(t *testing.T) {
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "version.db")), &gorm.Config{})
+	assert.NoError(t, err)
+	assert.NoError(t, db.AutoMigrate(&versionedModel{}))
+
+	records := []versionedModel{{Revision: 1}, {Revision: 1}}
+	assert.NoError(t, db.Create(&records).Error)
+
+	c := &Ctx[versionedModel]{itemKey: "id"}
+	field := &model.ResolvedModelField{Name: "Revision", DBName: "revision"}
+	versions := map[any]int64{records[0].ID: 1, records[1].ID: 1}
+
+	// the second record is modified after the versions are checked
+	assert.NoError(t, db.Model(&records[1]).UpdateColumn("revision", 2).Error)
+
+	result := bumpBatchVersion(db.Model(new(versionedModel)).Where(c.whereBatchVersions(field, versions)), field)
+	assert.NoError(t, result.Error)
+	assert.Equal(t, int64(1), result.RowsAffected)
+
+	var revisions []uint
+	db.Model(new(versionedModel)).Order("id").Pluck("revision", &revisions)
+	assert.Equal(t, []uint{2, 2}, revisions)
+}
@@ -0,0 +1,438 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/bsm/redislock"
+	"github.com/google/uuid"
+	"github.com/uozi-tech/cosy/kernel"
+	"github.com/uozi-tech/cosy/logger"
+	"github.com/uozi-tech/cosy/model"
+	"github.com/uozi-tech/cosy/outbox"
+	"github.com/uozi-tech/cosy/redis"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Options is the options of the worker, the zero values are replaced by the defaults
+type Options struct {
+	// Interval is the interval of polling the due deliveries, default 1s
+	Interval time.Duration
+	// BatchSize is the max count of the deliveries attempted in a query, default 100
+	BatchSize int
+	// Concurrency is the max count of the concurrent requests, default 10
+	Concurrency int
+	// Timeout is the timeout of a request, default 10s
+	Timeout time.Duration
+	// MaxAttempts is the max count of the attempts of a delivery, the delivery is marked failed after that, default 8
+	MaxAttempts int
+	// DisableAfter is the count of the consecutive failed attempts of a subscription
+	// after which the subscription is disabled, default 50
+	DisableAfter int
+	// MinBackoff is the delay of the first retry, which is doubled for each attempt, default 10s
+	MinBackoff time.Duration
+	// MaxBackoff is the max delay of the retries, default 6h
+	MaxBackoff time.Duration
+	// AllowPrivateNetwork allows the deliveries to the private, loopback and link-local addresses,
+	// which are refused by default, e.g. for the receivers in the same network in development
+	AllowPrivateNetwork bool
+}
+
+var options = Options{
+	Interval:     time.Second,
+	BatchSize:    100,
+	Concurrency:  10,
+	Timeout:      10 * time.Second,
+	MaxAttempts:  8,
+	DisableAfter: 50,
+	MinBackoff:   10 * time.Second,
+	MaxBackoff:   6 * time.Hour,
+}
+
+// SetOptions sets the options of the worker, it should be called before the kernel boot
+func SetOptions(o Options) {
+	if o.Interval > 0 {
+		options.Interval = o.Interval
+	}
+	if o.BatchSize > 0 {
+		options.BatchSize = o.BatchSize
+	}
+	if o.Concurrency > 0 {
+		options.Concurrency = o.Concurrency
+	}
+	if o.Timeout > 0 {
+		options.Timeout = o.Timeout
+	}
+	if o.MaxAttempts > 0 {
+		options.MaxAttempts = o.MaxAttempts
+	}
+	if o.DisableAfter > 0 {
+		options.DisableAfter = o.DisableAfter
+	}
+	if o.MinBackoff > 0 {
+		options.MinBackoff = o.MinBackoff
+	}
+	if o.MaxBackoff > 0 {
+		options.MaxBackoff = o.MaxBackoff
+	}
+	options.AllowPrivateNetwork = o.AllowPrivateNetwork
+}
+
+// backoff returns the delay of the retry after the attempts
+func backoff(attempts int) time.Duration {
+	delay := options.MinBackoff
+	for i := 1; i < attempts && delay < options.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, options.MaxBackoff)
+}
+
+// Message is the body posted to the subscriptions
+type Message struct {
+	ID        string         `json:"id"`
+	Event     string         `json:"event"`
+	CreatedAt time.Time      `json:"created_at"`
+	Data      outbox.Payload `json:"data"`
+}
+
+// Dispatch creates the deliveries of the event to the enabled subscriptions of the tenant which subscribe it,
+// the tenant is empty for the events of the models which aren't scoped to the tenant. The deliveries are
+// attempted by the worker. The event id is generated if it's empty, dispatching the same event id again
+// creates no duplicates.
+func Dispatch(db *gorm.DB, tenant string, event string, eventID string, data any) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	if eventID == "" {
+		eventID = uuid.NewString()
+	}
+
+	var subscriptions []Subscription
+	if err = db.Where("enabled = ? AND tenant_id = ?", true, tenant).Find(&subscriptions).Error; err != nil {
+		return err
+	}
+
+	now := time.Now()
+	var deliveries []Delivery
+	for i := range subscriptions {
+		if !subscriptions[i].Subscribes(event) {
+			continue
+		}
+		deliveries = append(deliveries, Delivery{
+			SubscriptionID: subscriptions[i].ID,
+			EventID:        eventID,
+			Event:          event,
+			Payload:        payload,
+			Status:         DeliveryPending,
+			NextAttemptAt:  now,
+		})
+	}
+	if len(deliveries) == 0 {
+		return nil
+	}
+	return db.Clauses(clause.OnConflict{DoNothing: true}).Create(&deliveries).Error
+}
+
+// Sink returns the outbox sink which dispatches the outbox events to the subscriptions,
+// e.g. outbox.RegisterSink(webhook.Sink())
+func Sink() outbox.Sink {
+	return outbox.SinkFunc(func(ctx context.Context, event *outbox.Event) error {
+		db := model.UseDB(ctx)
+		if db == nil {
+			return errors.New("webhook: db is not initialized")
+		}
+		return Dispatch(db, event.TenantID, event.Name, "outbox:"+strconv.FormatUint(event.ID, 10), event.Payload)
+	})
+}
+
+// workerLockKey is the key of the lock of the worker, only one worker attempts the deliveries at a time
+// if the workers of the instances share the redis
+const workerLockKey = "webhook:worker"
+
+var workerOnce sync.Once
+
+// RegisterWorker registers the worker into the kernel goroutines, it must be called before the kernel boot
+func RegisterWorker() {
+	workerOnce.Do(func() {
+		kernel.RegisterGoroutine(Worker)
+	})
+}
+
+// Worker attempts the due deliveries until the ctx is done, each attempt runs in a tracked goroutine of kernel.Run,
+// so it's shown in the goroutine monitor of debug. The workers of the instances sharing the redis are
+// serialized by a lock, the worker works without the lock if redis isn't initialized.
+func Worker(ctx context.Context) {
+	ticker := time.NewTicker(options.Interval)
+	defer ticker.Stop()
+
+	for {
+		work(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// work attempts the due deliveries in batches until there are no more
+func work(ctx context.Context) {
+	db := model.UseDB(ctx)
+	if db == nil {
+		return
+	}
+
+	if redis.GetClient() != nil {
+		lock, err := redis.ObtainLock(workerLockKey, time.Minute, nil)
+		if errors.Is(err, redislock.ErrNotObtained) {
+			return
+		}
+		if err != nil {
+			logger.Error(err)
+			return
+		}
+		defer func() {
+			if err := lock.Release(context.Background()); err != nil && !errors.Is(err, redislock.ErrLockNotHeld) {
+				logger.Error(err)
+			}
+		}()
+	}
+
+	for ctx.Err() == nil {
+		count, err := DeliverDue(ctx, db)
+		if err != nil {
+			logger.Error(err)
+			return
+		}
+		if count < options.BatchSize {
+			return
+		}
+	}
+}
+
+// DeliverDue attempts a batch of the due deliveries of the db and returns the count of them,
+// it returns after all the attempts are finished
+func DeliverDue(ctx context.Context, db *gorm.DB) (int, error) {
+	now := time.Now()
+	var deliveries []Delivery
+	err := db.Where("status = ? AND next_attempt_at <= ?", DeliveryPending, now).
+		Order("id").Limit(options.BatchSize).Find(&deliveries).Error
+	if err != nil || len(deliveries) == 0 {
+		return 0, err
+	}
+
+	ids := make([]uint64, 0, len(deliveries))
+	subscriptionIDs := make([]model.IDType, 0, len(deliveries))
+	for _, d := range deliveries {
+		ids = append(ids, d.ID)
+		subscriptionIDs = append(subscriptionIDs, d.SubscriptionID)
+	}
+
+	// the deliveries aren't picked again before the attempts are finished, even if the attempts panic
+	err = db.Model(&Delivery{}).Where("id IN ?", ids).
+		Update("next_attempt_at", now.Add(2*options.Timeout)).Error
+	if err != nil {
+		return 0, err
+	}
+
+	var subscriptions []Subscription
+	if err = db.Where("id IN ?", subscriptionIDs).Find(&subscriptions).Error; err != nil {
+		return 0, err
+	}
+	subscriptionMap := make(map[model.IDType]*Subscription, len(subscriptions))
+	for i := range subscriptions {
+		subscriptionMap[subscriptions[i].ID] = &subscriptions[i]
+	}
+
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, options.Concurrency)
+	for i := range deliveries {
+		delivery := &deliveries[i]
+		subscription, ok := subscriptionMap[delivery.SubscriptionID]
+		if !ok || !subscription.Enabled {
+			err = db.Model(delivery).Update("status", DeliveryCanceled).Error
+			if err != nil {
+				logger.Error(err)
+			}
+			continue
+		}
+
+		wg.Add(1)
+		semaphore <- struct{}{}
+		go kernel.Run(ctx, "webhook-delivery", func(ctx context.Context) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+			attempt(ctx, db, subscription, delivery)
+		})
+	}
+	wg.Wait()
+
+	return len(deliveries), nil
+}
+
+// ErrForbiddenAddress is returned when the url of a subscription resolves to an internal address
+var ErrForbiddenAddress = errors.New("webhook: forbidden address")
+
+// sharedAddressSpace is the carrier-grade NAT range of RFC 6598, which isn't reported by netip as private
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// checkAddress refuses to dial the internal addresses, it's checked after the host is resolved,
+// so that the hosts resolving to the internal addresses are refused as well
+func checkAddress(network, address string, _ syscall.RawConn) error {
+	if options.AllowPrivateNetwork {
+		return nil
+	}
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	addr := addrPort.Addr().Unmap()
+	if addr.IsPrivate() || addr.IsLoopback() || addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() ||
+		addr.IsInterfaceLocalMulticast() || addr.IsMulticast() || addr.IsUnspecified() ||
+		sharedAddressSpace.Contains(addr) {
+		return fmt.Errorf("%w: %s", ErrForbiddenAddress, addr)
+	}
+	return nil
+}
+
+// client is the client of the deliveries, the redirects aren't followed and the proxies of the environment
+// aren't used, so that the deliveries can't reach the internal services
+var client = &http.Client{
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+			Control:   checkAddress,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	},
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// post posts the delivery to the subscription and returns the status code of the response
+func post(ctx context.Context, subscription *Subscription, delivery *Delivery) (int, error) {
+	body, err := json.Marshal(Message{
+		ID:        delivery.EventID,
+		Event:     delivery.Event,
+		CreatedAt: delivery.CreatedAt,
+		Data:      delivery.Payload,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, options.Timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, subscription.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventIDHeader, delivery.EventID)
+	req.Header.Set(EventHeader, delivery.Event)
+	req.Header.Set(SignatureHeader, Sign(subscription.Secret, time.Now(), body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("webhook: responded %d", resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
+
+// attempt posts the delivery and records the attempt, the failed delivery is retried with the exponential backoff
+// and the subscription is disabled if the consecutive failures reach the limit
+func attempt(ctx context.Context, db *gorm.DB, subscription *Subscription, delivery *Delivery) {
+	start := time.Now()
+	statusCode, err := post(ctx, subscription, delivery)
+	now := time.Now()
+
+	record := &Attempt{
+		DeliveryID:     delivery.ID,
+		SubscriptionID: subscription.ID,
+		StatusCode:     statusCode,
+		Duration:       now.Sub(start).Milliseconds(),
+	}
+	if err != nil {
+		record.Error = err.Error()
+	}
+	if dbErr := db.Create(record).Error; dbErr != nil {
+		logger.Error(dbErr)
+	}
+
+	attempts := delivery.Attempts + 1
+	updates := map[string]any{
+		"attempts":         attempts,
+		"last_status_code": statusCode,
+		"last_error":       record.Error,
+	}
+	switch {
+	case err == nil:
+		updates["status"] = DeliverySucceeded
+	case attempts >= options.MaxAttempts:
+		updates["status"] = DeliveryFailed
+	default:
+		updates["next_attempt_at"] = now.Add(backoff(attempts))
+	}
+	if dbErr := db.Model(delivery).Updates(updates).Error; dbErr != nil {
+		logger.Error(dbErr)
+	}
+
+	if err == nil {
+		if subscription.Failures > 0 {
+			if dbErr := db.Model(subscription).Update("failures", 0).Error; dbErr != nil {
+				logger.Error(dbErr)
+			}
+		}
+		return
+	}
+	if dbErr := recordFailure(db, subscription, now); dbErr != nil {
+		logger.Error(dbErr)
+	}
+}
+
+// recordFailure increases the consecutive failures of the subscription, and disables the subscription
+// and cancels its pending deliveries if the failures reach the limit
+func recordFailure(db *gorm.DB, subscription *Subscription, now time.Time) error {
+	err := db.Model(&Subscription{}).Where("id = ?", subscription.ID).
+		Update("failures", gorm.Expr("failures + 1")).Error
+	if err != nil {
+		return err
+	}
+
+	result := db.Model(&Subscription{}).
+		Where("id = ? AND enabled = ? AND failures >= ?", subscription.ID, true, options.DisableAfter).
+		Updates(map[string]any{"enabled": false, "disabled_at": now})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return result.Error
+	}
+
+	logger.Warnf("webhook: subscription %v is disabled after %d consecutive failures", subscription.ID, options.DisableAfter)
+	return db.Model(&Delivery{}).
+		Where("subscription_id = ? AND status = ?", subscription.ID, DeliveryPending).
+		Update("status", DeliveryCanceled).Error
+}
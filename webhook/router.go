@@ -0,0 +1,132 @@
+package webhook
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/spf13/cast"
+	"github.com/uozi-tech/cosy"
+	"github.com/uozi-tech/cosy/model"
+	"gorm.io/gorm"
+)
+
+// createdSubscription is the response of creating a subscription, the only response with the secret
+type createdSubscription struct {
+	Subscription
+	Secret string `json:"secret"`
+}
+
+// Api returns the Curd of the subscriptions, the secret is generated if it's not set on creating,
+// and the failures of the subscription are reset when it's enabled again
+func Api(baseUrl string) cosy.ICurd[Subscription] {
+	c := cosy.Api[Subscription](baseUrl)
+	c.CreateHook(func(c *cosy.Ctx[Subscription]) {
+		c.BeforeExecuteHook(func(c *cosy.Ctx[Subscription]) {
+			if c.Model.Secret == "" {
+				c.Model.Secret = NewSecret()
+			}
+			if _, ok := c.Payload["enabled"]; !ok {
+				c.Model.Enabled = true
+			}
+		})
+		c.SetNextHandler(func(g *gin.Context) {
+			g.JSON(http.StatusOK, createdSubscription{Subscription: c.Model, Secret: c.Model.Secret})
+		})
+	})
+	c.ModifyHook(func(c *cosy.Ctx[Subscription]) {
+		c.BeforeExecuteHook(func(c *cosy.Ctx[Subscription]) {
+			if c.Model.Enabled && !c.OriginModel.Enabled {
+				c.Model.Failures = 0
+				c.Model.DisabledAt = nil
+				c.AddSelectedFields("failures", "disabled_at")
+			}
+		})
+	})
+	return c
+}
+
+// InitRouter registers the routes of the subscriptions at /webhooks, and the routes of the deliveries
+// of a subscription and the attempts of a delivery
+func InitRouter(r *gin.RouterGroup, middleware ...gin.HandlerFunc) {
+	Api("webhooks").InitRouter(r, middleware...)
+
+	g := r.Group("webhooks", middleware...)
+	{
+		g.GET("/:id/deliveries", GetDeliveries)
+		g.GET("/:id/deliveries/:delivery_id/attempts", GetAttempts)
+	}
+}
+
+// pagingList responds the records of the query in pages, the latest first
+func pagingList[T any](c *gin.Context, tx *gorm.DB) {
+	page, offset, pageSize := cosy.GetPagingParams(c)
+
+	var total int64
+	if err := tx.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		cosy.ErrHandler(c, err)
+		return
+	}
+
+	data := make([]T, 0)
+	if err := tx.Session(&gorm.Session{}).Order("id desc").Offset(offset).Limit(pageSize).Find(&data).Error; err != nil {
+		cosy.ErrHandler(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, model.DataList{
+		Data: data,
+		Pagination: model.Pagination{
+			Total:       total,
+			PerPage:     pageSize,
+			CurrentPage: page,
+			TotalPages:  model.TotalPage(total, pageSize),
+		},
+	})
+}
+
+// ownSubscription reports whether the subscription of the id param belongs to the tenant of the request,
+// it responds 403 if the tenant can't be resolved and 404 if the subscription isn't found
+func ownSubscription(c *gin.Context) bool {
+	tenant, err := cosy.TenantOf(c)
+	if err != nil {
+		c.JSON(http.StatusForbidden, err)
+		c.Abort()
+		return false
+	}
+
+	var count int64
+	err = model.UseDB(c).Model(&Subscription{}).
+		Where("id = ? AND tenant_id = ?", c.Param("id"), cast.ToString(tenant)).Count(&count).Error
+	if err == nil && count == 0 {
+		err = gorm.ErrRecordNotFound
+	}
+	if err != nil {
+		cosy.ErrHandler(c, err)
+		c.Abort()
+		return false
+	}
+	return true
+}
+
+// GetDeliveries responds the deliveries of the subscription in pages, the latest first,
+// the deliveries can be filtered by the status, e.g. ?status=failed
+func GetDeliveries(c *gin.Context) {
+	if !ownSubscription(c) {
+		return
+	}
+	tx := model.UseDB(c).Model(&Delivery{}).Where("subscription_id = ?", c.Param("id"))
+	if status := c.Query("status"); status != "" {
+		tx = tx.Where("status = ?", status)
+	}
+	pagingList[Delivery](c, tx)
+}
+
+// GetAttempts responds the attempts of the delivery of the subscription in pages, the latest first
+func GetAttempts(c *gin.Context) {
+	if !ownSubscription(c) {
+		return
+	}
+	tx := model.UseDB(c).Model(&Attempt{}).
+		Where("subscription_id = ? AND delivery_id = ?", c.Param("id"), c.Param("delivery_id"))
+	pagingList[Attempt](c, tx)
+}
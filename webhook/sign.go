@@ -0,0 +1,78 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The headers of the deliveries
+const (
+	EventIDHeader   = "X-Webhook-ID"
+	EventHeader     = "X-Webhook-Event"
+	SignatureHeader = "X-Webhook-Signature"
+)
+
+// ErrInvalidSignature is returned by Verify if the signature doesn't match the body
+var ErrInvalidSignature = errors.New("webhook: invalid signature")
+
+// ErrSignatureExpired is returned by Verify if the timestamp of the signature is out of the tolerance
+var ErrSignatureExpired = errors.New("webhook: signature expired")
+
+// NewSecret returns a random secret of the subscription
+func NewSecret() string {
+	b := make([]byte, 24)
+	_, _ = rand.Read(b)
+	return "whsec_" + hex.EncodeToString(b)
+}
+
+// signature returns the hex HMAC-SHA256 of "timestamp.body" by the secret
+func signature(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Sign returns the value of the X-Webhook-Signature header of the body, e.g. "t=1700000000,v1=5257a869...",
+// v1 is the hex HMAC-SHA256 of the unix timestamp, a "." and the body, by the secret of the subscription
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	t := timestamp.Unix()
+	return "t=" + strconv.FormatInt(t, 10) + ",v1=" + signature(secret, t, body)
+}
+
+// Verify verifies the X-Webhook-Signature header of the body received by the receivers,
+// the signatures older than the tolerance are rejected to prevent the replay attacks, 0 means no limit
+func Verify(secret string, header string, body []byte, tolerance time.Duration) error {
+	var timestamp int64
+	var signatures []string
+	for item := range strings.SplitSeq(header, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(item), "=")
+		switch key {
+		case "t":
+			timestamp, _ = strconv.ParseInt(value, 10, 64)
+		case "v1":
+			signatures = append(signatures, value)
+		}
+	}
+	if timestamp == 0 || len(signatures) == 0 {
+		return ErrInvalidSignature
+	}
+
+	expected := signature(secret, timestamp, body)
+	for _, s := range signatures {
+		if hmac.Equal([]byte(s), []byte(expected)) {
+			if tolerance > 0 && time.Since(time.Unix(timestamp, 0)).Abs() > tolerance {
+				return ErrSignatureExpired
+			}
+			return nil
+		}
+	}
+	return ErrInvalidSignature
+}
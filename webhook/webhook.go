@@ -0,0 +1,96 @@
+package webhook
+
+import (
+	"strings"
+	"time"
+
+	"github.com/uozi-tech/cosy/model"
+	"github.com/uozi-tech/cosy/outbox"
+)
+
+// Subscription is a callback url of the events, the deliveries are signed by the secret.
+// The subscription is disabled after the consecutive failed attempts reach the limit.
+// It belongs to the tenant of the request which creates it, and receives only the events of the tenant,
+// see cosy.SetTenantResolver. The secret is responded only on creating.
+type Subscription struct {
+	model.Model
+	TenantID    string     `json:"tenant_id" gorm:"type:varchar(255);index" cosy:"tenant"`
+	Name        string     `json:"name" cosy:"add:omitempty;update:omitempty;list:fussy"`
+	URL         string     `json:"url" gorm:"type:varchar(2048)" cosy:"add:required,url;update:omitempty,url;list:fussy"`
+	Secret      string     `json:"-" gorm:"type:varchar(255)" cosy:"json:secret;add:omitempty,min=16;update:omitempty,min=16"`
+	Events      []string   `json:"events" gorm:"serializer:json;type:text" cosy:"add:required,min=1;update:omitempty,min=1"`
+	Enabled     bool       `json:"enabled" cosy:"add:omitempty;update:omitempty;list:eq"`
+	Failures    int        `json:"failures"`
+	DisabledAt  *time.Time `json:"disabled_at"`
+	Description string     `json:"description" gorm:"type:text" cosy:"add:omitempty;update:omitempty"`
+}
+
+// TableName returns the table name of Subscription
+func (Subscription) TableName() string {
+	return "webhook_subscriptions"
+}
+
+// Subscribes reports whether the subscription subscribes the event, the patterns of the events are
+// the event names, e.g. "user.created", the prefixes ending with ".*", e.g. "user.*", or "*" for all
+func (s *Subscription) Subscribes(event string) bool {
+	for _, pattern := range s.Events {
+		if pattern == "*" || pattern == event {
+			return true
+		}
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok && strings.HasSuffix(prefix, ".") &&
+			strings.HasPrefix(event, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// DeliveryStatus is the status of the delivery
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliverySucceeded DeliveryStatus = "succeeded"
+	DeliveryFailed    DeliveryStatus = "failed"
+	// DeliveryCanceled is the status of the pending deliveries of the disabled subscriptions
+	DeliveryCanceled DeliveryStatus = "canceled"
+)
+
+// Delivery is an event to be delivered to a subscription, it's retried until it succeeds
+// or the attempts reach the limit
+type Delivery struct {
+	ID             uint64         `gorm:"primaryKey" json:"id"`
+	SubscriptionID model.IDType   `gorm:"uniqueIndex:idx_webhook_deliveries_event" json:"subscription_id"`
+	EventID        string         `gorm:"type:varchar(255);uniqueIndex:idx_webhook_deliveries_event" json:"event_id"`
+	Event          string         `gorm:"type:varchar(255)" json:"event"`
+	Payload        outbox.Payload `gorm:"type:text" json:"payload"`
+	Status         DeliveryStatus `gorm:"type:varchar(16);index:idx_webhook_deliveries_due" json:"status"`
+	Attempts       int            `json:"attempts"`
+	NextAttemptAt  time.Time      `gorm:"index:idx_webhook_deliveries_due" json:"next_attempt_at"`
+	LastStatusCode int            `json:"last_status_code"`
+	LastError      string         `gorm:"type:text" json:"last_error"`
+	CreatedAt      time.Time      `json:"created_at"`
+	UpdatedAt      time.Time      `json:"updated_at"`
+}
+
+// TableName returns the table name of Delivery
+func (Delivery) TableName() string {
+	return "webhook_deliveries"
+}
+
+// Attempt is an attempt of a delivery, StatusCode is 0 if the request isn't responded
+type Attempt struct {
+	ID             uint64       `gorm:"primaryKey" json:"id"`
+	DeliveryID     uint64       `gorm:"index" json:"delivery_id"`
+	SubscriptionID model.IDType `gorm:"index" json:"subscription_id"`
+	StatusCode     int          `json:"status_code"`
+	Error          string       `gorm:"type:text" json:"error"`
+	// Duration is the duration of the request in milliseconds
+	Duration  int64     `json:"duration"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TableName returns the table name of Attempt
+func (Attempt) TableName() string {
+	return "webhook_attempts"
+}
@@ -0,0 +1,291 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/uozi-tech/cosy"
+	"github.com/uozi-tech/cosy/logger"
+	"github.com/uozi-tech/cosy/model"
+	"github.com/uozi-tech/cosy/settings"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type received struct {
+	header http.Header
+	body   []byte
+}
+
+// receiver is a local receiver of the deliveries, it responds the status
+type receiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	status   int
+	received []received
+}
+
+func newReceiver(t *testing.T) *receiver {
+	r := &receiver{status: http.StatusOK}
+	r.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		body, _ := io.ReadAll(req.Body)
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		r.received = append(r.received, received{header: req.Header, body: body})
+		w.WriteHeader(r.status)
+	}))
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *receiver) setStatus(status int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.status = status
+}
+
+func (r *receiver) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.received)
+}
+
+func setup(t *testing.T) (*gin.Engine, *gorm.DB) {
+	gin.SetMode(gin.TestMode)
+	logger.Init(gin.TestMode)
+	settings.AppSettings.PageSize = 20
+	model.ClearCollection()
+	model.RegisterModels(Subscription{}, Delivery{}, Attempt{})
+	db := model.Init(sqlite.Open(filepath.Join(t.TempDir(), "webhook.db")))
+
+	r := gin.New()
+	InitRouter(r.Group(""))
+	return r, db
+}
+
+func request(r *gin.Engine, method, uri string, body any) (int, map[string]any) {
+	var buf bytes.Buffer
+	if body != nil {
+		_ = json.NewEncoder(&buf).Encode(body)
+	}
+	req := httptest.NewRequest(method, uri, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	var resp map[string]any
+	_ = json.Unmarshal(w.Body.Bytes(), &resp)
+	return w.Code, resp
+}
+
+func TestSubscribes(t *testing.T) {
+	s := &Subscription{Events: []string{"user.*", "order.paid"}}
+	assert.True(t, s.Subscribes("user.created"))
+	assert.True(t, s.Subscribes("order.paid"))
+	assert.False(t, s.Subscribes("order.created"))
+	assert.False(t, s.Subscribes("users.created"))
+	assert.True(t, (&Subscription{Events: []string{"*"}}).Subscribes("order.created"))
+}
+
+func TestSignAndVerify(t *testing.T) {
+	body := []byte(`{"id":"1"}`)
+	header := Sign("secret", time.Now(), body)
+
+	assert.NoError(t, Verify("secret", header, body, 5*time.Minute))
+	assert.ErrorIs(t, Verify("other", header, body, 5*time.Minute), ErrInvalidSignature)
+	assert.ErrorIs(t, Verify("secret", header, []byte(`{"id":"2"}`), 5*time.Minute), ErrInvalidSignature)
+	assert.ErrorIs(t, Verify("secret", "", body, 0), ErrInvalidSignature)
+
+	old := Sign("secret", time.Now().Add(-time.Hour), body)
+	assert.ErrorIs(t, Verify("secret", old, body, 5*time.Minute), ErrSignatureExpired)
+	assert.NoError(t, Verify("secret", old, body, 0))
+}
+
+func TestWebhook(t *testing.T) {
+	r, db := setup(t)
+	rcv := newReceiver(t)
+
+	// the receiver listens on the loopback address
+	SetOptions(Options{MaxAttempts: 3, DisableAfter: 4, AllowPrivateNetwork: true})
+	defer SetOptions(Options{MaxAttempts: 8, DisableAfter: 50})
+
+	code, resp := request(r, http.MethodPost, "/webhooks", map[string]any{
+		"url":    rcv.URL,
+		"events": []string{"user.*"},
+	})
+	assert.Equal(t, http.StatusOK, code, resp)
+	assert.Equal(t, true, resp["enabled"])
+	secret, _ := resp["secret"].(string)
+	assert.NotEmpty(t, secret)
+	id := resp["id"]
+
+	// the secret is responded only on creating
+	code, resp = request(r, http.MethodGet, "/webhooks/"+toString(id), nil)
+	assert.Equal(t, http.StatusOK, code)
+	assert.NotContains(t, resp, "secret")
+
+	ctx := context.Background()
+	assert.NoError(t, Dispatch(db, "", "order.created", "", map[string]any{"id": 1}))
+	assert.NoError(t, Dispatch(db, "", "user.created", "event-1", map[string]any{"id": 1, "name": "Alice"}))
+	// the duplicated event isn't delivered again
+	assert.NoError(t, Dispatch(db, "", "user.created", "event-1", map[string]any{"id": 1, "name": "Alice"}))
+
+	count, err := DeliverDue(ctx, db)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+	if !assert.Equal(t, 1, rcv.count()) {
+		return
+	}
+
+	got := rcv.received[0]
+	assert.Equal(t, "event-1", got.header.Get(EventIDHeader))
+	assert.Equal(t, "user.created", got.header.Get(EventHeader))
+	assert.NoError(t, Verify(secret, got.header.Get(SignatureHeader), got.body, time.Minute))
+
+	var message Message
+	assert.NoError(t, json.Unmarshal(got.body, &message))
+	assert.Equal(t, "user.created", message.Event)
+	assert.JSONEq(t, `{"id":1,"name":"Alice"}`, string(message.Data))
+
+	code, resp = request(r, http.MethodGet, "/webhooks/"+toString(id)+"/deliveries", nil)
+	assert.Equal(t, http.StatusOK, code)
+	deliveries := resp["data"].([]any)
+	assert.Len(t, deliveries, 1)
+	assert.Equal(t, string(DeliverySucceeded), deliveries[0].(map[string]any)["status"])
+
+	// the failed delivery is retried with the backoff until the attempts reach the limit
+	rcv.setStatus(http.StatusInternalServerError)
+	assert.NoError(t, Dispatch(db, "", "user.updated", "event-2", map[string]any{"id": 1}))
+	for range 3 {
+		_, err = DeliverDue(ctx, db)
+		assert.NoError(t, err)
+		db.Model(&Delivery{}).Where("status = ?", DeliveryPending).Update("next_attempt_at", time.Now())
+	}
+
+	var delivery Delivery
+	db.First(&delivery, "event_id = ?", "event-2")
+	assert.Equal(t, DeliveryFailed, delivery.Status)
+	assert.Equal(t, 3, delivery.Attempts)
+	assert.Equal(t, http.StatusInternalServerError, delivery.LastStatusCode)
+
+	code, resp = request(r, http.MethodGet, "/webhooks/"+toString(id)+"/deliveries/"+toString(delivery.ID)+"/attempts", nil)
+	assert.Equal(t, http.StatusOK, code)
+	attempts := resp["data"].([]any)
+	assert.Len(t, attempts, 3)
+	assert.Equal(t, float64(http.StatusInternalServerError), attempts[0].(map[string]any)["status_code"])
+
+	// the subscription is disabled after the consecutive failures reach the limit
+	assert.NoError(t, Dispatch(db, "", "user.deleted", "event-3", map[string]any{"id": 1}))
+	_, err = DeliverDue(ctx, db)
+	assert.NoError(t, err)
+
+	var disabled Subscription
+	db.First(&disabled, id)
+	assert.False(t, disabled.Enabled)
+	assert.NotNil(t, disabled.DisabledAt)
+	var canceled Delivery
+	db.First(&canceled, "event_id = ?", "event-3")
+	assert.Equal(t, DeliveryCanceled, canceled.Status)
+
+	// the disabled subscription receives no deliveries
+	received := rcv.count()
+	assert.NoError(t, Dispatch(db, "", "user.created", "event-4", map[string]any{"id": 2}))
+	_, err = DeliverDue(ctx, db)
+	assert.NoError(t, err)
+	assert.Equal(t, received, rcv.count())
+
+	// the failures are reset when the subscription is enabled again
+	code, resp = request(r, http.MethodPost, "/webhooks/"+toString(id), map[string]any{"enabled": true})
+	assert.Equal(t, http.StatusOK, code, resp)
+	var enabled Subscription
+	db.First(&enabled, id)
+	assert.True(t, enabled.Enabled)
+	assert.Zero(t, enabled.Failures)
+	assert.Nil(t, enabled.DisabledAt)
+}
+
+func TestTenantSubscriptions(t *testing.T) {
+	r, db := setup(t)
+	cosy.SetTenantResolver(func(c *gin.Context) (any, bool) {
+		tenant := c.GetHeader("X-Tenant")
+		return tenant, tenant != ""
+	})
+	defer cosy.SetTenantResolver(nil)
+
+	subscribe := func(tenant string) any {
+		var buf bytes.Buffer
+		_ = json.NewEncoder(&buf).Encode(map[string]any{"url": "https://example.com/" + tenant, "events": []string{"*"}})
+		req := httptest.NewRequest(http.MethodPost, "/webhooks", &buf)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Tenant", tenant)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+		var resp map[string]any
+		_ = json.Unmarshal(w.Body.Bytes(), &resp)
+		assert.Equal(t, tenant, resp["tenant_id"])
+		return resp["id"]
+	}
+	a := subscribe("a")
+	subscribe("b")
+
+	// the events are delivered only to the subscriptions of the tenant
+	assert.NoError(t, Dispatch(db, "a", "user.created", "event-1", map[string]any{"id": 1}))
+	var deliveries []Delivery
+	db.Find(&deliveries)
+	if assert.Len(t, deliveries, 1) {
+		assert.Equal(t, toString(a), toString(deliveries[0].SubscriptionID))
+	}
+
+	// the deliveries of the other tenants aren't found
+	get := func(tenant string) int {
+		req := httptest.NewRequest(http.MethodGet, "/webhooks/"+toString(a)+"/deliveries", nil)
+		req.Header.Set("X-Tenant", tenant)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+	assert.Equal(t, http.StatusOK, get("a"))
+	assert.Equal(t, http.StatusNotFound, get("b"))
+	assert.Equal(t, http.StatusForbidden, get(""))
+}
+
+func TestForbiddenAddress(t *testing.T) {
+	rcv := newReceiver(t)
+	redirect := httptest.NewServer(http.RedirectHandler(rcv.URL, http.StatusFound))
+	t.Cleanup(redirect.Close)
+
+	delivery := &Delivery{EventID: "event-1", Event: "user.created", Payload: []byte(`{}`)}
+	_, err := post(context.Background(), &Subscription{URL: rcv.URL}, delivery)
+	assert.ErrorIs(t, err, ErrForbiddenAddress)
+	assert.Zero(t, rcv.count())
+
+	for _, address := range []string{"10.0.0.1:80", "[::1]:80", "169.254.169.254:80", "[::ffff:192.168.0.1]:80", "100.64.0.1:80"} {
+		assert.ErrorIs(t, checkAddress("tcp", address, nil), ErrForbiddenAddress, address)
+	}
+	assert.NoError(t, checkAddress("tcp", "93.184.216.34:443", nil))
+
+	// the redirects aren't followed
+	SetOptions(Options{AllowPrivateNetwork: true})
+	defer SetOptions(Options{})
+	statusCode, err := post(context.Background(), &Subscription{URL: redirect.URL}, delivery)
+	assert.Error(t, err)
+	assert.Equal(t, http.StatusFound, statusCode)
+	assert.Zero(t, rcv.count())
+}
+
+func toString(v any) string {
+	b, _ := json.Marshal(v)
+	return string(b)
+}